@@ -0,0 +1,156 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+)
+
+/*
+applyQueryDefaults - merges the top level defaults and the named profile of each ffs query into the query
+Merging is done on the JSON so that fields which are left out of a query are inherited, even if their zero value is meaningful
+Precedence is query, then its profile, then defaults. Objects are merged field by field, any other value (including arrays) is replaced
+fileBytes - the bytes of the configuration file
+Returns
+[]byte - the configuration file with the defaults and profiles applied to every query
+error - any errors which have been caught
+*/
+func applyQueryDefaults(fileBytes []byte) ([]byte, error) {
+	var rawConfig map[string]interface{}
+	err := json.Unmarshal(fileBytes, &rawConfig)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defaults, err := getObject(rawConfig, "defaults")
+
+	if err != nil {
+		return nil, err
+	}
+
+	profiles, err := getObject(rawConfig, "profiles")
+
+	if err != nil {
+		return nil, err
+	}
+
+	//nothing to merge, leave the file untouched
+	if defaults == nil && profiles == nil {
+		return fileBytes, nil
+	}
+
+	rawQueries, found := rawConfig["ffsQueries"]
+	if !found || rawQueries == nil {
+		return fileBytes, nil
+	}
+
+	queries, ok := rawQueries.([]interface{})
+	if !ok {
+		return nil, errors.New("ffsQueries must be a list")
+	}
+
+	for i, rawQuery := range queries {
+		query, ok := rawQuery.(map[string]interface{})
+		if !ok {
+			return nil, errors.New("ffs query " + strconv.Itoa(i+1) + " must be an object")
+		}
+
+		merged := mergeObjects(map[string]interface{}{}, defaults)
+
+		if rawProfile, found := query["profile"]; found && rawProfile != nil {
+			profileName, ok := rawProfile.(string)
+			if !ok {
+				return nil, errors.New("profile of ffs query " + strconv.Itoa(i+1) + " must be a string")
+			}
+
+			if profileName != "" {
+				rawProfileObject, found := profiles[profileName]
+				if !found {
+					return nil, errors.New("unknown profile: " + profileName + " in ffs query " + strconv.Itoa(i+1))
+				}
+
+				profile, ok := rawProfileObject.(map[string]interface{})
+				if !ok {
+					return nil, errors.New("profile: " + profileName + " must be an object")
+				}
+
+				merged = mergeObjects(merged, profile)
+			}
+		}
+
+		queries[i] = mergeObjects(merged, query)
+	}
+
+	return json.Marshal(rawConfig)
+}
+
+//getObject gets an optional object from the top level of the configuration
+func getObject(rawConfig map[string]interface{}, key string) (map[string]interface{}, error) {
+	value, found := rawConfig[key]
+	if !found || value == nil {
+		return nil, nil
+	}
+
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, errors.New(key + " must be an object")
+	}
+
+	return object, nil
+}
+
+//mergeObjects merges override into base, recursing into objects which are in both
+func mergeObjects(base map[string]interface{}, override map[string]interface{}) map[string]interface{} {
+	for key, overrideValue := range override {
+		baseObject, baseIsObject := base[key].(map[string]interface{})
+		overrideObject, overrideIsObject := overrideValue.(map[string]interface{})
+
+		if baseIsObject && overrideIsObject {
+			base[key] = mergeObjects(baseObject, overrideObject)
+		} else if overrideIsObject {
+			//copy so that queries sharing defaults do not share maps
+			base[key] = mergeObjects(map[string]interface{}{}, overrideObject)
+		} else {
+			base[key] = overrideValue
+		}
+	}
+
+	return base
+}
+
+/*
+MaskedConfigJson - gets the effective configuration, after defaults and profiles have been applied, with passwords, API keys, and tokens masked
+configuration - the configuration to print
+Returns
+[]byte - indented JSON of the configuration
+error - any errors which have been caught
+*/
+func MaskedConfigJson(configuration Config) ([]byte, error) {
+	//the defaults and profiles have already been merged into the queries
+	configuration.Defaults = nil
+	configuration.Profiles = nil
+
+	maskSecret(&configuration.IPAPI.APIKey)
+
+	queries := make([]FFSQuery, len(configuration.FFSQueries))
+	for i, query := range configuration.FFSQueries {
+		maskSecret(&query.Password)
+		maskSecret(&query.Elasticsearch.BasicAuth.Password)
+		maskSecret(&query.Elasticsearch.APIKey)
+		maskSecret(&query.Elasticsearch.BearerToken)
+		queries[i] = query
+	}
+	configuration.FFSQueries = queries
+
+	return json.MarshalIndent(configuration, "", "  ")
+}
+
+const maskedValue = "********"
+
+//maskSecret replaces a credential with maskedValue, unset credentials are left empty to show they are not set
+func maskSecret(secret *string) {
+	if *secret != "" {
+		*secret = maskedValue
+	}
+}
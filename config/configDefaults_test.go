@@ -0,0 +1,135 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+//secretFieldName matches the json names of fields which hold credentials, file paths like tls.clientKey are not credentials
+var secretFieldName = regexp.MustCompile(`(?i)password|apikey|token|secret|credential`)
+
+//fillSecrets sets every secret string field reachable from value to a unique value, recording the path of each field by its value
+func fillSecrets(value reflect.Value, path string, secrets map[string]string) {
+	switch value.Kind() {
+	case reflect.Ptr:
+		if value.IsNil() {
+			value.Set(reflect.New(value.Type().Elem()))
+		}
+		fillSecrets(value.Elem(), path, secrets)
+	case reflect.Slice:
+		//raw json defaults are dropped when printing
+		if value.Type().Elem().Kind() != reflect.Struct {
+			return
+		}
+		if value.Len() == 0 {
+			value.Set(reflect.MakeSlice(value.Type(), 1, 1))
+		}
+		for i := 0; i < value.Len(); i++ {
+			fillSecrets(value.Index(i), path+"[]", secrets)
+		}
+	case reflect.Struct:
+		//types from other packages, like the ffs query's paging token, are not configuration credentials
+		if value.Type().PkgPath() != reflect.TypeOf(Config{}).PkgPath() {
+			return
+		}
+		for i := 0; i < value.NumField(); i++ {
+			field := value.Type().Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if name == "" {
+				name = field.Name
+			}
+			fieldPath := strings.TrimPrefix(path+"."+name, ".")
+
+			if field.Type.Kind() == reflect.String {
+				if secretFieldName.MatchString(name) {
+					secret := "secret-" + fieldPath
+					value.Field(i).SetString(secret)
+					secrets[secret] = fieldPath
+				}
+				continue
+			}
+
+			fillSecrets(value.Field(i), fieldPath, secrets)
+		}
+	}
+}
+
+func TestMaskedConfigJsonMasksEverySecret(t *testing.T) {
+	var configuration Config
+	secrets := map[string]string{}
+	fillSecrets(reflect.ValueOf(&configuration), "", secrets)
+
+	if len(secrets) == 0 {
+		t.Fatal("found no secret fields to check")
+	}
+
+	configuration.FFSQueries[0].Username = "user@example.com"
+
+	configJson, err := MaskedConfigJson(configuration)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for secret, path := range secrets {
+		if strings.Contains(string(configJson), secret) {
+			t.Errorf("%s is printed unmasked, mask it in MaskedConfigJson", path)
+		}
+	}
+
+	if !strings.Contains(string(configJson), "user@example.com") {
+		t.Error("username was masked")
+	}
+}
+
+func TestMaskedConfigJsonLeavesUnsetSecretsEmpty(t *testing.T) {
+	configuration := Config{FFSQueries: []FFSQuery{{Name: "test"}}}
+
+	configJson, err := MaskedConfigJson(configuration)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(string(configJson), maskedValue) {
+		t.Errorf("unset secrets were masked: %s", configJson)
+	}
+}
+
+func TestMaskedConfigJsonElasticsearchCredentials(t *testing.T) {
+	configuration := Config{FFSQueries: []FFSQuery{
+		{Name: "apiKey", Elasticsearch: Elasticsearch{APIKey: "id:key"}},
+		{Name: "bearerToken", Elasticsearch: Elasticsearch{BearerToken: "token"}},
+	}}
+
+	configJson, err := MaskedConfigJson(configuration)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var printed Config
+	if err := json.Unmarshal(configJson, &printed); err != nil {
+		t.Fatal(err)
+	}
+
+	if printed.FFSQueries[0].Elasticsearch.APIKey != maskedValue || printed.FFSQueries[0].Elasticsearch.BearerToken != "" {
+		t.Errorf("apiKey query printed with apiKey %q and bearerToken %q, want %q and empty", printed.FFSQueries[0].Elasticsearch.APIKey, printed.FFSQueries[0].Elasticsearch.BearerToken, maskedValue)
+	}
+
+	if printed.FFSQueries[1].Elasticsearch.BearerToken != maskedValue || printed.FFSQueries[1].Elasticsearch.APIKey != "" {
+		t.Errorf("bearerToken query printed with bearerToken %q and apiKey %q, want %q and empty", printed.FFSQueries[1].Elasticsearch.BearerToken, printed.FFSQueries[1].Elasticsearch.APIKey, maskedValue)
+	}
+
+	//the configuration being printed is not changed
+	if configuration.FFSQueries[0].Elasticsearch.APIKey != "id:key" || configuration.FFSQueries[1].Elasticsearch.BearerToken != "token" {
+		t.Error("masking changed the configuration it was given")
+	}
+}
@@ -12,27 +12,38 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"time"
 )
 
 //Configuration File structs
 type Config struct {
-	AuthURI    string     `json:"authURI"`
-	FFSURI     string     `json:"ffsURI"`
-	FFSQueries []FFSQuery `json:"ffsQueries"`
-	Prometheus Prometheus `json:"prometheus,omitempty"`
-	Debugging  bool       `json:"debugging,omitempty"`
-	IPAPI      IPAPI      `json:"ip-api,omitempty"`
+	AuthURI    string                     `json:"authURI"`
+	FFSURI     string                     `json:"ffsURI"`
+	APIVersion string                     `json:"apiVersion,omitempty"`
+	Defaults   json.RawMessage            `json:"defaults,omitempty"`
+	Profiles   map[string]json.RawMessage `json:"profiles,omitempty"`
+	FFSQueries []FFSQuery                 `json:"ffsQueries"`
+	RateLimit  RateLimit                  `json:"rateLimit,omitempty"`
+	Scheduler  Scheduler                  `json:"scheduler,omitempty"`
+	Prometheus Prometheus                 `json:"prometheus,omitempty"`
+	Debugging  bool                       `json:"debugging,omitempty"`
+	IPAPI      IPAPI                      `json:"ip-api,omitempty"`
 }
 
 type FFSQuery struct {
 	Name                 string        `json:"name"`
+	Profile              string        `json:"profile,omitempty"`
+	AuthType             string        `json:"authType,omitempty"`
 	Username             string        `json:"username"`
 	Password             string        `json:"password"`
 	Interval             string        `json:"interval"`
 	TimeGap              string        `json:"timeGap"`
 	Query                ffs.Query     `json:"query"`
+	Filter               string        `json:"filter,omitempty"`
+	TimestampTerm        string        `json:"timestampTerm,omitempty"`
+	FetchMode            string        `json:"fetchMode,omitempty"`
 	OutputType           string        `json:"outputType"`
 	OutputLocation       string        `json:"outputLocation,omitempty"`
 	Elasticsearch        Elasticsearch `json:"elasticsearch,omitempty"`
@@ -40,6 +51,42 @@ type FFSQuery struct {
 	EsStandardized       string        `json:"esStandardized,omitempty"`
 	ValidIpAddressesOnly bool          `json:"validIpAddressesOnly"`
 	MaxConcurrentQueries *int          `json:"max_concurrent_queries,omitempty"`
+	Priority             int           `json:"priority,omitempty"`
+	Weight               int           `json:"weight,omitempty"`
+	AuditInterval        string        `json:"auditInterval,omitempty"`
+	Schedule             Schedule      `json:"schedule,omitempty"`
+}
+
+type Schedule struct {
+	Type     string `json:"type,omitempty"`
+	Cron     string `json:"cron,omitempty"`
+	At       string `json:"at,omitempty"`
+	Window   string `json:"window,omitempty"`
+	Delay    string `json:"delay,omitempty"`
+	Timezone string `json:"timezone,omitempty"`
+}
+
+/*
+AtTime - gets the time a once schedule runs at
+An at time with an offset (ex: 2019-08-30T01:00:00Z) is used as it is, one without an offset (ex: 2019-08-30T01:00:00) is in the schedule's timezone
+Returns
+time.Time - the time to run at
+error - any errors which have been caught
+*/
+func (schedule Schedule) AtTime() (time.Time, error) {
+	at, err := time.Parse(time.RFC3339Nano, schedule.At)
+
+	if err == nil {
+		return at, nil
+	}
+
+	location, err := time.LoadLocation(schedule.Timezone)
+
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.ParseInLocation("2006-01-02T15:04:05", schedule.At, location)
 }
 
 type IPAPI struct {
@@ -64,29 +111,110 @@ type LocalCache struct {
 }
 
 type Elasticsearch struct {
-	NumberOfShards        int       `json:"numberOfShards,omitempty"`
-	NumberOfReplicas      int       `json:"numberOfReplicas,omitempty"`
-	IndexName             string    `json:"indexName,omitempty"`
-	IndexTimeAppend       string    `json:"indexTimeAppend,omitempty"`
-	IndexTimeGen          string    `json:"indexTimeGen,omitempty"`
-	ElasticURL            []string  `json:"elasticUrl,omitempty"`
-	UseCustomIndexPattern bool      `json:"useCustomIndexPattern"`
-	BasicAuth             BasicAuth `json:"basicAuth,omitempty"`
-	Sniffing              bool      `json:"sniffing,omitempty"`
-	BestCompression       bool      `json:"bestCompression,omitempty"`
-	RefreshInterval       int       `json:"refreshInterval,omitempty"`
-	Aliases               []string  `json:"aliases,omitempty"`
+	NumberOfShards        int         `json:"numberOfShards,omitempty"`
+	NumberOfReplicas      int         `json:"numberOfReplicas,omitempty"`
+	IndexName             string      `json:"indexName,omitempty"`
+	IndexTimeAppend       string      `json:"indexTimeAppend,omitempty"`
+	IndexTimeGen          string      `json:"indexTimeGen,omitempty"`
+	ElasticURL            []string    `json:"elasticUrl,omitempty"`
+	UseCustomIndexPattern bool        `json:"useCustomIndexPattern"`
+	BasicAuth             BasicAuth   `json:"basicAuth,omitempty"`
+	APIKey                string      `json:"apiKey,omitempty"`
+	BearerToken           string      `json:"bearerToken,omitempty"`
+	CloudID               string      `json:"cloudId,omitempty"`
+	TLS                   TLS         `json:"tls,omitempty"`
+	HealthCheck           HealthCheck `json:"healthCheck,omitempty"`
+	Retry                 Retry       `json:"retry,omitempty"`
+	Bulk                  Bulk        `json:"bulk,omitempty"`
+	Pipeline              string      `json:"pipeline,omitempty"`
+	PipelineFile          string      `json:"pipelineFile,omitempty"`
+	Sniffing              bool        `json:"sniffing,omitempty"`
+	BestCompression       bool        `json:"bestCompression,omitempty"`
+	RefreshInterval       int         `json:"refreshInterval,omitempty"`
+	Aliases               []string    `json:"aliases,omitempty"`
+	IndexCacheTTL         string      `json:"indexCacheTtl,omitempty"`
+	ILM                   ILM         `json:"ilm,omitempty"`
+	ISM                   ILM         `json:"ism,omitempty"`
+	DataStream            DataStream  `json:"dataStream,omitempty"`
+}
+
+type DataStream struct {
+	Enabled   bool   `json:"enabled,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+//ISM policies are built from the same hot, warm, and delete phases as ILM policies
+type ILM struct {
+	Enabled    bool      `json:"enabled,omitempty"`
+	PolicyName string    `json:"policyName,omitempty"`
+	Hot        ILMHot    `json:"hot,omitempty"`
+	Warm       ILMWarm   `json:"warm,omitempty"`
+	Delete     ILMDelete `json:"delete,omitempty"`
+}
+
+type ILMHot struct {
+	RolloverMaxSize string `json:"rolloverMaxSize,omitempty"`
+	RolloverMaxAge  string `json:"rolloverMaxAge,omitempty"`
+}
+
+type ILMWarm struct {
+	MinAge             string `json:"minAge,omitempty"`
+	NumberOfReplicas   *int   `json:"numberOfReplicas,omitempty"`
+	ShrinkShards       int    `json:"shrinkShards,omitempty"`
+	ForceMergeSegments int    `json:"forceMergeSegments,omitempty"`
+}
+
+type ILMDelete struct {
+	MinAge string `json:"minAge,omitempty"`
 }
 
 type Logstash struct {
 	LogstashURL []string `json:"logstashURL"`
 }
 
+type TLS struct {
+	CACert             string `json:"caCert,omitempty"`
+	ClientCert         string `json:"clientCert,omitempty"`
+	ClientKey          string `json:"clientKey,omitempty"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify,omitempty"`
+}
+
+type HealthCheck struct {
+	Enabled  *bool  `json:"enabled,omitempty"`
+	Interval string `json:"interval,omitempty"`
+	Timeout  string `json:"timeout,omitempty"`
+}
+
+type Retry struct {
+	MaxRetries     int    `json:"maxRetries,omitempty"`
+	InitialBackoff string `json:"initialBackoff,omitempty"`
+	MaxBackoff     string `json:"maxBackoff,omitempty"`
+}
+
+type Bulk struct {
+	Workers        int    `json:"workers,omitempty"`
+	Actions        int    `json:"actions,omitempty"`
+	Size           int    `json:"size,omitempty"`
+	FlushInterval  string `json:"flushInterval,omitempty"`
+	Gzip           bool   `json:"gzip,omitempty"`
+	InitialBackoff string `json:"initialBackoff,omitempty"`
+	MaxBackoff     string `json:"maxBackoff,omitempty"`
+}
+
 type BasicAuth struct {
 	User     string `json:"user,omitempty"`
 	Password string `json:"password,omitempty"`
 }
 
+type RateLimit struct {
+	RequestsPerMinute     int `json:"requestsPerMinute,omitempty"`
+	MaxConcurrentRequests int `json:"maxConcurrentRequests,omitempty"`
+}
+
+type Scheduler struct {
+	MaxConcurrentWindows int `json:"maxConcurrentWindows,omitempty"`
+}
+
 type Prometheus struct {
 	Enabled bool `json:"enabled,omitempty"`
 	Port    int  `json:"port,omitempty"`
@@ -153,8 +281,16 @@ error - any errors which have been caught
 func validateConfigJson(fileBytes []byte) (*Config, error) {
 	//create config struct
 	var config Config
+
+	//Apply the defaults and profiles to each query
+	fileBytes, err := applyQueryDefaults(fileBytes)
+
+	if err != nil {
+		panic("error applying defaults to JSON configuration file: " + err.Error())
+	}
+
 	//Make sure file is valid JSON
-	err := json.Unmarshal(fileBytes, &config)
+	err = json.Unmarshal(fileBytes, &config)
 
 	//return error if unmarshal fails
 	if err != nil {
@@ -186,6 +322,14 @@ func validateConfigJson(fileBytes []byte) (*Config, error) {
 		}
 	}
 
+	//Validate APIVersion
+	//default to v1 if empty
+	if config.APIVersion == "" {
+		config.APIVersion = "v1"
+	} else if config.APIVersion != "v1" && config.APIVersion != "v2" {
+		panic("error: apiVersion must be v1 or v2")
+	}
+
 	//Validate prometheus
 	defaultPrometheusPort := 8080
 	if config.Prometheus.Enabled {
@@ -199,6 +343,23 @@ func validateConfigJson(fileBytes []byte) (*Config, error) {
 		}
 	}
 
+	//Validate rate limit
+	//0 means no limit
+	if config.RateLimit.RequestsPerMinute < 0 {
+		panic("error: rate limit requests per minute cannot be negative")
+	}
+	if config.RateLimit.MaxConcurrentRequests < 0 {
+		panic("error: rate limit max concurrent requests cannot be negative")
+	}
+
+	//Validate scheduler
+	//default to 4 windows at once, so that query priority and weight apply, -1 means no limit
+	if config.Scheduler.MaxConcurrentWindows == 0 {
+		config.Scheduler.MaxConcurrentWindows = 4
+	} else if config.Scheduler.MaxConcurrentWindows < -1 {
+		panic("error: scheduler max concurrent windows must be -1 (no limit) or above 0")
+	}
+
 	//Create queryName slice
 	var queryNames []string
 
@@ -228,12 +389,20 @@ func validateConfigJson(fileBytes []byte) (*Config, error) {
 				}
 			}
 
-			//Validate username
+			//Validate auth type
+			//default to basic if empty
+			if query.AuthType == "" {
+				config.FFSQueries[i].AuthType = "basic"
+			} else if query.AuthType != "basic" && query.AuthType != "apiClient" {
+				panic("error: auth type in ffs query: " + query.Name + ", must be basic or apiClient")
+			}
+
+			//Validate username, this is the client ID for API clients
 			//check if empty
 			if query.Username == "" {
 				panic("error: username in ffs query: " + query.Name + ", is blank")
-			} else {
-				//check if valid email address
+			} else if config.FFSQueries[i].AuthType == "basic" {
+				//check if valid email address, API client IDs are not email addresses
 				err = utils.ValidateUsernameRegexp(query.Username)
 				if err != nil {
 					panic("error: in ffs query: " + query.Name + ", " + err.Error())
@@ -246,10 +415,75 @@ func validateConfigJson(fileBytes []byte) (*Config, error) {
 				panic("error: password in ffs query: " + query.Name + ", is blank")
 			}
 
+			//Validate schedule
+			//default to continuous if empty
+			switch query.Schedule.Type {
+			case "":
+				config.FFSQueries[i].Schedule.Type = "continuous"
+			case "continuous":
+			case "cron", "once":
+				//validate timezone, default to UTC if empty
+				if query.Schedule.Timezone == "" {
+					config.FFSQueries[i].Schedule.Timezone = "UTC"
+				} else {
+					_, err := time.LoadLocation(query.Schedule.Timezone)
+					if err != nil {
+						panic("error: invalid schedule timezone in ffs query: " + query.Name + ", " + err.Error())
+					}
+				}
+
+				if query.Schedule.Type == "cron" {
+					//validate cron expression
+					if query.Schedule.Cron == "" {
+						panic("error: schedule cron in ffs query: " + query.Name + ", is blank")
+					}
+					cronSchedule, err := utils.ParseCron(query.Schedule.Cron)
+					if err != nil {
+						panic("error: in ffs query: " + query.Name + ", " + err.Error())
+					}
+					if cronSchedule.Next(time.Now()) == (time.Time{}) {
+						panic("error: schedule cron in ffs query: " + query.Name + ", never runs")
+					}
+				} else {
+					//validate at time
+					if query.Schedule.At == "" {
+						panic("error: schedule at in ffs query: " + query.Name + ", is blank")
+					}
+					_, err := config.FFSQueries[i].Schedule.AtTime()
+					if err != nil {
+						panic("error: invalid schedule at time in ffs query: " + query.Name + ", must be in RFC3339 format, or 2006-01-02T15:04:05 format for the schedule timezone")
+					}
+				}
+
+				//validate window, default to a full day if empty
+				if query.Schedule.Window == "" {
+					config.FFSQueries[i].Schedule.Window = "24h"
+				} else {
+					window, err := time.ParseDuration(query.Schedule.Window)
+					if err != nil || window <= 0 {
+						panic("error: invalid duration provide in ffs query for schedule window: " + query.Name)
+					}
+				}
+
+				//validate delay, default to the 15 minutes Code42 needs for logs to be ready if empty
+				if query.Schedule.Delay == "" {
+					config.FFSQueries[i].Schedule.Delay = "15m"
+				} else {
+					_, err := time.ParseDuration(query.Schedule.Delay)
+					if err != nil {
+						panic("error: invalid duration provide in ffs query for schedule delay: " + query.Name)
+					}
+				}
+			default:
+				panic("error: unknown schedule type in ffs query: " + query.Name + ", schedule type must be continuous, cron, or once")
+			}
+
 			//Validate interval
-			//check if empty
+			//check if empty, only continuous queries need an interval
 			if query.Interval == "" {
-				panic("error: interval in ffs query: " + query.Name + ", is blank")
+				if config.FFSQueries[i].Schedule.Type == "continuous" {
+					panic("error: interval in ffs query: " + query.Name + ", is blank")
+				}
 			} else {
 				//check if real duration value is passed
 				_, err := time.ParseDuration(query.Interval)
@@ -270,14 +504,92 @@ func validateConfigJson(fileBytes []byte) (*Config, error) {
 				}
 			}
 
+			//Validate audit interval
+			//default to 10 minutes if empty, 0 disables the audit
+			if query.AuditInterval == "" {
+				config.FFSQueries[i].AuditInterval = "10m"
+			} else {
+				//check if real duration value is passed
+				_, err := time.ParseDuration(query.AuditInterval)
+				if err != nil {
+					panic("error: invalid duration provide in ffs query for audit interval: " + query.Name)
+				}
+			}
+
 			//validate max concurrent queries
 			defaultMaxConcurrentQueries := 5
 			if query.MaxConcurrentQueries == nil {
 				config.FFSQueries[i].MaxConcurrentQueries = &defaultMaxConcurrentQueries
 			}
 
-			//TODO figure out how to best validate FFSQueries
-			//TODO need to validate that both ON_OR_AFTER and ON_OR_BEFORE exist once
+			//Validate weight
+			//default to 1 if empty
+			if query.Weight == 0 {
+				config.FFSQueries[i].Weight = 1
+			} else if query.Weight < 0 {
+				panic("error: weight in ffs query: " + query.Name + ", cannot be negative")
+			}
+
+			//Validate fetch mode
+			//default to export if empty
+			if query.FetchMode == "" {
+				config.FFSQueries[i].FetchMode = "export"
+			} else if query.FetchMode != "export" && query.FetchMode != "search" {
+				panic("error: fetch mode in ffs query: " + query.Name + ", must be export or search")
+			}
+
+			//Validate timestamp term
+			//default to insertionTimestamp if empty
+			if query.TimestampTerm == "" {
+				config.FFSQueries[i].TimestampTerm = "insertionTimestamp"
+			} else if query.TimestampTerm != "insertionTimestamp" && query.TimestampTerm != "eventTimestamp" {
+				panic("error: timestamp term in ffs query: " + query.Name + ", must be insertionTimestamp or eventTimestamp")
+			}
+
+			//Compile the filter expression into the query groups
+			if query.Filter != "" {
+				if len(query.Query.Groups) > 0 {
+					panic("error: ffs query: " + query.Name + ", cannot have both a filter and query groups")
+				}
+
+				compiledQuery, err := compileFilter(query.Filter, config.FFSQueries[i].TimestampTerm)
+				if err != nil {
+					panic("error: in ffs query: " + query.Name + ", " + err.Error())
+				}
+
+				//Keep any paging and sorting set on the query
+				compiledQuery.PgNum = query.Query.PgNum
+				compiledQuery.PgSize = query.Query.PgSize
+				compiledQuery.SrtDir = query.Query.SrtDir
+				compiledQuery.SrtKey = query.Query.SrtKey
+				config.FFSQueries[i].Query = compiledQuery
+				query.Query = compiledQuery
+			}
+
+			//Validate the terms, operators, and values of the query
+			err = validateFFSQueryTerms(query.Query, config.APIVersion)
+			if err != nil {
+				panic("error: in ffs query: " + query.Name + ", " + err.Error())
+			}
+
+			//Validate that both ON_OR_AFTER and ON_OR_BEFORE exist once for the timestamp term
+			var onOrAfterCount, onOrBeforeCount int
+			for _, group := range query.Query.Groups {
+				for _, filter := range group.Filters {
+					if filter.Term != config.FFSQueries[i].TimestampTerm {
+						continue
+					}
+					if filter.Operator == "ON_OR_AFTER" {
+						onOrAfterCount++
+					} else if filter.Operator == "ON_OR_BEFORE" {
+						onOrBeforeCount++
+					}
+				}
+			}
+
+			if onOrAfterCount != 1 || onOrBeforeCount != 1 {
+				panic("error: ffs query: " + query.Name + ", must contain exactly one ON_OR_AFTER and one ON_OR_BEFORE filter for its timestamp term: " + config.FFSQueries[i].TimestampTerm)
+			}
 
 			//Validate Output Type
 			//check if empty
@@ -317,7 +629,7 @@ func validateConfigJson(fileBytes []byte) (*Config, error) {
 							config.FFSQueries[i].OutputLocation = query.OutputLocation + utils.DirPath
 						}
 					}
-				case "elastic":
+				case "elastic", "opensearch":
 					//Validate output location, this is still needed for writing files to keep track on in progress and last completed queries
 					if query.OutputLocation == "" {
 						//Get working directory and set as output location
@@ -360,11 +672,15 @@ func validateConfigJson(fileBytes []byte) (*Config, error) {
 						panic("error: number of shards for ffs query: " + query.Name + " cannot be lower than 0")
 					}
 
-					//validate index name
-					err = utils.ValidateIndexName(query.Elasticsearch.IndexName)
+					//validate index name, data streams are named from their namespace instead
+					if query.Elasticsearch.DataStream.Enabled {
+						config.FFSQueries[i].Elasticsearch.DataStream = validateDataStream(query.Name, query.EsStandardized, query.Elasticsearch)
+					} else {
+						err = utils.ValidateIndexName(query.Elasticsearch.IndexName)
 
-					if err != nil {
-						panic("error: in ffs query: " + query.Name + " : " + err.Error())
+						if err != nil {
+							panic("error: in ffs query: " + query.Name + " : " + err.Error())
+						}
 					}
 
 					//check if indexTimeAppend is set, validate and get length, will need to add to length of index name and validate not > 255 characters
@@ -385,8 +701,8 @@ func validateConfigJson(fileBytes []byte) (*Config, error) {
 					}
 
 					//Validate elasticUrl
-					//check if empty
-					if query.Elasticsearch.ElasticURL == nil {
+					//check if empty, the url comes from the cloud id if set
+					if query.Elasticsearch.ElasticURL == nil && query.Elasticsearch.CloudID == "" {
 						panic("error: elastic url cannot be blank")
 					} else {
 						//check if valid URI
@@ -401,6 +717,46 @@ func validateConfigJson(fileBytes []byte) (*Config, error) {
 						}
 					}
 
+					//validate the client options
+					validateElasticClient(query.Name, query.Elasticsearch)
+
+					//validate the options which only one of elasticsearch or opensearch supports
+					validateDistribution(query.Name, query.OutputType, query.Elasticsearch)
+
+					//validate the bulk processor options
+					config.FFSQueries[i].Elasticsearch.Bulk = validateBulk(query.Name, query.Elasticsearch.Bulk)
+
+					//validate the ingest pipeline, a pipeline file is installed under the pipeline name
+					if query.Elasticsearch.PipelineFile != "" {
+						if query.Elasticsearch.Pipeline == "" {
+							panic("error: in ffs query: " + query.Name + ", elasticsearch pipelineFile requires a pipeline name")
+						}
+
+						pipelineBytes, err := ioutil.ReadFile(query.Elasticsearch.PipelineFile)
+
+						if err != nil {
+							panic("error: in ffs query: " + query.Name + ", reading elasticsearch pipelineFile: " + err.Error())
+						}
+
+						var pipeline map[string]interface{}
+						err = json.Unmarshal(pipelineBytes, &pipeline)
+
+						if err != nil {
+							panic("error: in ffs query: " + query.Name + ", parsing elasticsearch pipelineFile: " + err.Error())
+						}
+					}
+
+					//validate indexCacheTtl
+					if query.Elasticsearch.IndexCacheTTL == "" {
+						config.FFSQueries[i].Elasticsearch.IndexCacheTTL = "1h"
+					} else {
+						_, err := time.ParseDuration(query.Elasticsearch.IndexCacheTTL)
+
+						if err != nil {
+							panic("error: in ffs query: " + query.Name + ", invalid indexCacheTtl: " + err.Error())
+						}
+					}
+
 					//validate aliases
 					if !query.Elasticsearch.UseCustomIndexPattern && len(query.Elasticsearch.Aliases) > 0 {
 						for _, alias := range query.Elasticsearch.Aliases {
@@ -412,6 +768,15 @@ func validateConfigJson(fileBytes []byte) (*Config, error) {
 							}
 						}
 					}
+
+					//validate ilm, or ism for opensearch
+					if query.Elasticsearch.ILM.Enabled {
+						config.FFSQueries[i].Elasticsearch.ILM = validateILM(query.Name, "ilm", query.Elasticsearch.ILM, config.FFSQueries[i].Elasticsearch)
+					}
+
+					if query.Elasticsearch.ISM.Enabled {
+						config.FFSQueries[i].Elasticsearch.ISM = validateILM(query.Name, "ism", query.Elasticsearch.ISM, config.FFSQueries[i].Elasticsearch)
+					}
 				case "logstash":
 					//Validate output location, this is still needed for writing files to keep track on in progress and last completed queries
 					if query.OutputLocation == "" {
@@ -577,9 +942,269 @@ func validateConfigJson(fileBytes []byte) (*Config, error) {
 		}
 	}
 
+	validateIndexTemplates(config.FFSQueries)
+
 	if config.Debugging {
 		log.Println("Debugging Enabled.")
 	}
 
 	return &config, nil
 }
+
+//indexTemplate is the index template which the puller installs for an elastic or opensearch ffs query
+type indexTemplate struct {
+	queryName      string
+	cluster        string
+	name           string
+	esStandardized string
+	//whether the template also matches name-*, the time appended indexes
+	wildcard bool
+}
+
+/*
+validateIndexTemplates - validates that the index templates installed for elastic and opensearch ffs queries do not conflict
+Every template has the same priority, so elasticsearch rejects a template whose patterns overlap another's, ex: crashplan-* and crashplan-usb.
+Queries which write to the same index name share a template, so they must use the same esStandardized or they would keep replacing each other's mappings.
+*/
+func validateIndexTemplates(queries []FFSQuery) {
+	var templates []indexTemplate
+
+	for _, query := range queries {
+		if (query.OutputType != "elastic" && query.OutputType != "opensearch") || query.Elasticsearch.UseCustomIndexPattern {
+			continue
+		}
+
+		template := indexTemplate{
+			queryName:      query.Name,
+			cluster:        query.Elasticsearch.CloudID + strings.Join(query.Elasticsearch.ElasticURL, ","),
+			name:           query.Elasticsearch.IndexName,
+			esStandardized: query.EsStandardized,
+			wildcard:       true,
+		}
+		if query.Elasticsearch.DataStream.Enabled {
+			template.name = "logs-code42.ffs-" + query.Elasticsearch.DataStream.Namespace
+			template.wildcard = false
+		}
+
+		for _, other := range templates {
+			//templates on different clusters cannot conflict
+			if other.cluster != template.cluster {
+				continue
+			}
+
+			if other.name == template.name {
+				if other.esStandardized != template.esStandardized {
+					panic("error: in ffs query: " + template.queryName + ", index: " + template.name + " is also used by ffs query: " + other.queryName + " with a different esStandardized, queries sharing an index must use the same esStandardized")
+				}
+				continue
+			}
+
+			if (other.wildcard && strings.HasPrefix(template.name, other.name+"-")) || (template.wildcard && strings.HasPrefix(other.name, template.name+"-")) {
+				panic("error: in ffs query: " + template.queryName + ", index: " + template.name + " overlaps index: " + other.name + " of ffs query: " + other.queryName + ", index names cannot start with another query's index name followed by -")
+			}
+		}
+
+		templates = append(templates, template)
+	}
+}
+
+/*
+validateElasticClient - validates the connection, auth, tls, health check, and retry options of an elastic ffs query
+*/
+func validateElasticClient(queryName string, elasticsearch Elasticsearch) {
+	if elasticsearch.CloudID != "" && elasticsearch.ElasticURL != nil {
+		panic("error: in ffs query: " + queryName + ", elasticsearch cloudId and elasticUrl cannot both be set")
+	}
+
+	//only one Authorization header can be sent
+	authMethods := 0
+	for _, set := range []bool{elasticsearch.BasicAuth.User != "", elasticsearch.APIKey != "", elasticsearch.BearerToken != ""} {
+		if set {
+			authMethods++
+		}
+	}
+	if authMethods > 1 {
+		panic("error: in ffs query: " + queryName + ", only one of elasticsearch basicAuth, apiKey, or bearerToken can be set")
+	}
+
+	for name, file := range map[string]string{"caCert": elasticsearch.TLS.CACert, "clientCert": elasticsearch.TLS.ClientCert, "clientKey": elasticsearch.TLS.ClientKey} {
+		if file == "" {
+			continue
+		}
+		if _, err := os.Stat(file); err != nil {
+			panic("error: in ffs query: " + queryName + ", elasticsearch tls " + name + ": " + err.Error())
+		}
+	}
+
+	if (elasticsearch.TLS.ClientCert == "") != (elasticsearch.TLS.ClientKey == "") {
+		panic("error: in ffs query: " + queryName + ", elasticsearch tls clientCert and clientKey must be set together")
+	}
+
+	for name, duration := range map[string]string{"healthCheck interval": elasticsearch.HealthCheck.Interval, "healthCheck timeout": elasticsearch.HealthCheck.Timeout, "retry initialBackoff": elasticsearch.Retry.InitialBackoff, "retry maxBackoff": elasticsearch.Retry.MaxBackoff} {
+		if duration == "" {
+			continue
+		}
+		if _, err := time.ParseDuration(duration); err != nil {
+			panic("error: in ffs query: " + queryName + ", invalid elasticsearch " + name + ": " + err.Error())
+		}
+	}
+
+	if elasticsearch.Retry.MaxRetries < 0 {
+		panic("error: in ffs query: " + queryName + ", elasticsearch retry maxRetries cannot be lower than 0")
+	}
+}
+
+/*
+validateDistribution - validates that an elastic ffs query only uses elasticsearch options, and an opensearch ffs query only uses opensearch options
+The opensearch output uses the elasticsearch block, but has no ilm, data streams, api keys, cloud ids, or background health checks
+*/
+func validateDistribution(queryName string, outputType string, elasticsearch Elasticsearch) {
+	if outputType == "elastic" {
+		if elasticsearch.ISM.Enabled {
+			panic("error: in ffs query: " + queryName + ", ism is only supported by the opensearch output type, use ilm instead")
+		}
+		return
+	}
+
+	unsupported := map[string]bool{
+		"ilm, use ism instead": elasticsearch.ILM.Enabled,
+		"dataStream":           elasticsearch.DataStream.Enabled,
+		"apiKey":               elasticsearch.APIKey != "",
+		"cloudId":              elasticsearch.CloudID != "",
+		"healthCheck":          elasticsearch.HealthCheck != (HealthCheck{}),
+		"sniffing":             elasticsearch.Sniffing,
+	}
+
+	for option, set := range unsupported {
+		if set {
+			panic("error: in ffs query: " + queryName + ", elasticsearch " + option + " is not supported by the opensearch output type")
+		}
+	}
+}
+
+/*
+validateBulk - validates the bulk processor options of an elastic ffs query and fills in their defaults
+Returns
+Bulk - the bulk options with their defaults filled in
+*/
+func validateBulk(queryName string, bulk Bulk) Bulk {
+	if bulk.Workers < 0 || bulk.Actions < 0 || bulk.Size < 0 {
+		panic("error: in ffs query: " + queryName + ", elasticsearch bulk workers, actions, and size cannot be lower than 0")
+	}
+
+	if bulk.Workers == 0 {
+		bulk.Workers = 2
+	}
+
+	if bulk.Actions == 0 {
+		bulk.Actions = 1000
+	}
+
+	//5MB
+	if bulk.Size == 0 {
+		bulk.Size = 5 << 20
+	}
+
+	for name, duration := range map[string]string{"flushInterval": bulk.FlushInterval, "initialBackoff": bulk.InitialBackoff, "maxBackoff": bulk.MaxBackoff} {
+		if duration == "" {
+			continue
+		}
+		if _, err := time.ParseDuration(duration); err != nil {
+			panic("error: in ffs query: " + queryName + ", invalid elasticsearch bulk " + name + ": " + err.Error())
+		}
+	}
+
+	return bulk
+}
+
+//Data stream namespaces, which cannot contain - as it separates the parts of the data stream name
+var dataStreamNamespaceRegexp = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+/*
+validateDataStream - validates the dataStream block of an elastic ffs query and fills in its defaults
+Returns
+DataStream - the dataStream block with its defaults filled in
+*/
+func validateDataStream(queryName string, esStandardized string, elasticsearch Elasticsearch) DataStream {
+	dataStream := elasticsearch.DataStream
+
+	//data streams require an @timestamp, which only the ecs events have
+	if esStandardized != "ecs" {
+		panic("error: in ffs query: " + queryName + ", dataStream requires esStandardized to be ecs")
+	}
+
+	//the data stream template is installed by the puller
+	if elasticsearch.UseCustomIndexPattern {
+		panic("error: in ffs query: " + queryName + ", dataStream cannot be used with useCustomIndexPattern")
+	}
+
+	//data stream templates cannot have aliases
+	if len(elasticsearch.Aliases) > 0 {
+		panic("error: in ffs query: " + queryName + ", dataStream cannot be used with aliases")
+	}
+
+	if dataStream.Namespace == "" {
+		dataStream.Namespace = "default"
+	}
+
+	if len(dataStream.Namespace) > 100 || !dataStreamNamespaceRegexp.MatchString(dataStream.Namespace) {
+		panic("error: in ffs query: " + queryName + ", invalid dataStream namespace: " + dataStream.Namespace + ", must be lowercase letters, numbers, or _, and at most 100 characters")
+	}
+
+	return dataStream
+}
+
+//Elasticsearch time units, ex: 30d, 12h, and byte size units, ex: 50gb
+var esTimeUnitRegexp = regexp.MustCompile(`^\d+(d|h|m|s|ms|micros|nanos)$`)
+var esByteSizeRegexp = regexp.MustCompile(`^\d+(b|kb|mb|gb|tb|pb)$`)
+
+/*
+validateILM - validates the ilm block of an elastic ffs query, or the ism block of an opensearch ffs query, and fills in its defaults
+policyType - ilm or ism, used in the errors
+Returns
+ILM - the block with its defaults filled in
+*/
+func validateILM(queryName string, policyType string, ilm ILM, elasticsearch Elasticsearch) ILM {
+	//the policy is attached through the index template, which the puller only installs if it is not custom
+	if elasticsearch.UseCustomIndexPattern {
+		panic("error: in ffs query: " + queryName + ", " + policyType + " cannot be used with useCustomIndexPattern")
+	}
+
+	if ilm.PolicyName == "" && elasticsearch.DataStream.Enabled {
+		ilm.PolicyName = "logs-code42.ffs-" + elasticsearch.DataStream.Namespace + "-policy"
+	} else if ilm.PolicyName == "" {
+		ilm.PolicyName = elasticsearch.IndexName + "-policy"
+	}
+
+	if ilm.Hot.RolloverMaxSize == "" && ilm.Hot.RolloverMaxAge == "" {
+		ilm.Hot.RolloverMaxAge = "1d"
+	}
+
+	if ilm.Hot.RolloverMaxSize != "" && !esByteSizeRegexp.MatchString(ilm.Hot.RolloverMaxSize) {
+		panic("error: in ffs query: " + queryName + ", invalid " + policyType + " hot rolloverMaxSize: " + ilm.Hot.RolloverMaxSize + ", must be an elasticsearch byte size, ex: 50gb")
+	}
+
+	for name, age := range map[string]string{"hot rolloverMaxAge": ilm.Hot.RolloverMaxAge, "warm minAge": ilm.Warm.MinAge, "delete minAge": ilm.Delete.MinAge} {
+		if age != "" && !esTimeUnitRegexp.MatchString(age) {
+			panic("error: in ffs query: " + queryName + ", invalid " + policyType + " " + name + ": " + age + ", must be an elasticsearch time unit, ex: 30d")
+		}
+	}
+
+	if ilm.Warm.MinAge == "" && (ilm.Warm.NumberOfReplicas != nil || ilm.Warm.ShrinkShards != 0 || ilm.Warm.ForceMergeSegments != 0) {
+		panic("error: in ffs query: " + queryName + ", " + policyType + " warm phase requires a minAge")
+	}
+
+	if ilm.Warm.NumberOfReplicas != nil && *ilm.Warm.NumberOfReplicas < 0 {
+		panic("error: in ffs query: " + queryName + ", " + policyType + " warm numberOfReplicas cannot be lower than 0")
+	}
+
+	if ilm.Warm.ShrinkShards < 0 || ilm.Warm.ShrinkShards > elasticsearch.NumberOfShards {
+		panic("error: in ffs query: " + queryName + ", " + policyType + " warm shrinkShards must be between 0 and numberOfShards")
+	}
+
+	if ilm.Warm.ForceMergeSegments < 0 {
+		panic("error: in ffs query: " + queryName + ", " + policyType + " warm forceMergeSegments cannot be lower than 0")
+	}
+
+	return ilm
+}
@@ -0,0 +1,178 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScheduleAtTime(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+
+	if err != nil {
+		t.Skip("no timezone data: " + err.Error())
+	}
+
+	tests := []struct {
+		name     string
+		schedule Schedule
+		want     time.Time
+		wantErr  bool
+	}{
+		{
+			name:     "offset is used as it is",
+			schedule: Schedule{At: "2019-08-30T01:00:00Z", Timezone: "America/New_York"},
+			want:     time.Date(2019, 8, 30, 1, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "no offset is in the timezone",
+			schedule: Schedule{At: "2019-08-30T01:00:00", Timezone: "America/New_York"},
+			want:     time.Date(2019, 8, 30, 1, 0, 0, 0, newYork),
+		},
+		{
+			name:     "no offset defaults to UTC",
+			schedule: Schedule{At: "2019-08-30T01:00:00", Timezone: "UTC"},
+			want:     time.Date(2019, 8, 30, 1, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "bad time",
+			schedule: Schedule{At: "30/08/2019", Timezone: "UTC"},
+			wantErr:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := test.schedule.AtTime()
+
+			if (err != nil) != test.wantErr {
+				t.Fatalf("AtTime error = %v, want error %v", err, test.wantErr)
+			}
+
+			if !test.wantErr && !got.Equal(test.want) {
+				t.Errorf("AtTime = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestValidateIndexTemplates(t *testing.T) {
+	elasticQuery := func(name string, indexName string, esStandardized string) FFSQuery {
+		return FFSQuery{Name: name, OutputType: "elastic", EsStandardized: esStandardized, Elasticsearch: Elasticsearch{IndexName: indexName, ElasticURL: []string{"http://localhost:9200"}}}
+	}
+
+	tests := []struct {
+		name    string
+		queries func() []FFSQuery
+		wantErr string
+	}{
+		{
+			name: "distinct index names",
+			queries: func() []FFSQuery {
+				return []FFSQuery{elasticQuery("a", "crashplan", ""), elasticQuery("b", "crashplan_usb", ""), elasticQuery("c", "usb-crashplan", "")}
+			},
+		},
+		{
+			name: "prefix followed by - overlaps",
+			queries: func() []FFSQuery {
+				return []FFSQuery{elasticQuery("a", "crashplan", ""), elasticQuery("b", "crashplan-usb", "")}
+			},
+			wantErr: "overlaps index: crashplan",
+		},
+		{
+			name: "overlap is found in either order",
+			queries: func() []FFSQuery {
+				return []FFSQuery{elasticQuery("a", "crashplan-usb", ""), elasticQuery("b", "crashplan", "")}
+			},
+			wantErr: "overlaps index: crashplan-usb",
+		},
+		{
+			name: "shared index name with the same format",
+			queries: func() []FFSQuery {
+				return []FFSQuery{elasticQuery("a", "crashplan", "ecs"), elasticQuery("b", "crashplan", "ecs")}
+			},
+		},
+		{
+			name: "shared index name with different formats",
+			queries: func() []FFSQuery {
+				return []FFSQuery{elasticQuery("a", "crashplan", ""), elasticQuery("b", "crashplan", "ecs")}
+			},
+			wantErr: "with a different esStandardized",
+		},
+		{
+			name: "custom index patterns install no template",
+			queries: func() []FFSQuery {
+				custom := elasticQuery("b", "crashplan-usb", "")
+				custom.Elasticsearch.UseCustomIndexPattern = true
+				return []FFSQuery{elasticQuery("a", "crashplan", ""), custom}
+			},
+		},
+		{
+			name: "different clusters do not conflict",
+			queries: func() []FFSQuery {
+				other := elasticQuery("b", "crashplan-usb", "ecs")
+				other.Elasticsearch.ElasticURL = []string{"http://other:9200"}
+				return []FFSQuery{elasticQuery("a", "crashplan", ""), other}
+			},
+		},
+		{
+			name: "opensearch is checked too",
+			queries: func() []FFSQuery {
+				opensearch := elasticQuery("b", "crashplan-usb", "")
+				opensearch.OutputType = "opensearch"
+				return []FFSQuery{elasticQuery("a", "crashplan", ""), opensearch}
+			},
+			wantErr: "overlaps index: crashplan",
+		},
+		{
+			name: "other outputs install no template",
+			queries: func() []FFSQuery {
+				file := elasticQuery("b", "crashplan-usb", "")
+				file.OutputType = "file"
+				return []FFSQuery{elasticQuery("a", "crashplan", ""), file}
+			},
+		},
+		{
+			name: "data stream matched by an index name",
+			queries: func() []FFSQuery {
+				dataStream := elasticQuery("b", "", "ecs")
+				dataStream.Elasticsearch.DataStream = DataStream{Enabled: true, Namespace: "default"}
+				return []FFSQuery{elasticQuery("a", "logs-code42.ffs", "ecs"), dataStream}
+			},
+			wantErr: "overlaps index: logs-code42.ffs",
+		},
+		{
+			name: "data streams in different namespaces",
+			queries: func() []FFSQuery {
+				first := elasticQuery("a", "", "ecs")
+				first.Elasticsearch.DataStream = DataStream{Enabled: true, Namespace: "default"}
+				second := elasticQuery("b", "", "ecs")
+				second.Elasticsearch.DataStream = DataStream{Enabled: true, Namespace: "default_usb"}
+				return []FFSQuery{first, second}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var err error
+			func() {
+				defer func() {
+					if r := recover(); r != nil {
+						err = fmt.Errorf("%v", r)
+					}
+				}()
+				validateIndexTemplates(test.queries())
+			}()
+
+			if test.wantErr == "" && err != nil {
+				t.Fatalf("validateIndexTemplates panicked: %v", err)
+			}
+
+			if test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)) {
+				t.Errorf("validateIndexTemplates error = %v, want one containing %q", err, test.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,330 @@
+package config
+
+import (
+	"errors"
+	"github.com/BenB196/crashplan-ffs-go-pkg"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ffsTermType string
+
+const (
+	ffsTermString    ffsTermType = "string"
+	ffsTermTimestamp ffsTermType = "timestamp"
+	ffsTermNumber    ffsTermType = "number"
+	ffsTermBoolean   ffsTermType = "boolean"
+)
+
+//Operators allowed for each type of term
+var ffsTermOperators = map[ffsTermType][]string{
+	ffsTermString:    {"IS", "IS_NOT", "EXISTS", "DOES_NOT_EXIST"},
+	ffsTermTimestamp: {"ON_OR_AFTER", "ON_OR_BEFORE", "WITHIN_THE_LAST", "EXISTS", "DOES_NOT_EXIST"},
+	ffsTermNumber:    {"IS", "IS_NOT", "GREATER_THAN", "LESS_THAN", "EXISTS", "DOES_NOT_EXIST"},
+	ffsTermBoolean:   {"IS", "IS_NOT", "EXISTS", "DOES_NOT_EXIST"},
+}
+
+//Catalogue of known FFS terms and their value types, queries are written with the v1 names for both api versions
+var ffsTerms = map[string]ffsTermType{
+	"actor":                      ffsTermString,
+	"cloudDriveId":               ffsTermString,
+	"createTimestamp":            ffsTermTimestamp,
+	"destinationCategory":        ffsTermString,
+	"destinationName":            ffsTermString,
+	"detectionSourceAlias":       ffsTermString,
+	"deviceUid":                  ffsTermString,
+	"deviceUserName":             ffsTermString,
+	"directoryId":                ffsTermString,
+	"domainName":                 ffsTermString,
+	"emailDlpPolicyNames":        ffsTermString,
+	"emailFrom":                  ffsTermString,
+	"emailRecipients":            ffsTermString,
+	"emailSender":                ffsTermString,
+	"emailSubject":               ffsTermString,
+	"eventId":                    ffsTermString,
+	"eventTimestamp":             ffsTermTimestamp,
+	"eventType":                  ffsTermString,
+	"exposure":                   ffsTermString,
+	"fileCategory":               ffsTermString,
+	"fileCategoryByBytes":        ffsTermString,
+	"fileCategoryByExtension":    ffsTermString,
+	"fileId":                     ffsTermString,
+	"fileName":                   ffsTermString,
+	"fileOwner":                  ffsTermString,
+	"filePath":                   ffsTermString,
+	"fileSize":                   ffsTermNumber,
+	"fileType":                   ffsTermString,
+	"insertionTimestamp":         ffsTermTimestamp,
+	"md5Checksum":                ffsTermString,
+	"mimeTypeByBytes":            ffsTermString,
+	"mimeTypeByExtension":        ffsTermString,
+	"mimeTypeMismatch":           ffsTermBoolean,
+	"modifyTimestamp":            ffsTermTimestamp,
+	"operatingSystemUser":        ffsTermString,
+	"osHostName":                 ffsTermString,
+	"outsideActiveHours":         ffsTermBoolean,
+	"printJobName":               ffsTermString,
+	"printerName":                ffsTermString,
+	"privateIpAddresses":         ffsTermString,
+	"processName":                ffsTermString,
+	"processOwner":               ffsTermString,
+	"publicIpAddress":            ffsTermString,
+	"remoteActivity":             ffsTermString,
+	"removableMediaBusType":      ffsTermString,
+	"removableMediaCapacity":     ffsTermNumber,
+	"removableMediaMediaName":    ffsTermString,
+	"removableMediaName":         ffsTermString,
+	"removableMediaPartitionId":  ffsTermString,
+	"removableMediaSerialNumber": ffsTermString,
+	"removableMediaVendor":       ffsTermString,
+	"removableMediaVolumeName":   ffsTermString,
+	"sha256Checksum":             ffsTermString,
+	"shared":                     ffsTermString,
+	"sharedWith":                 ffsTermString,
+	"sharingTypeAdded":           ffsTermString,
+	"source":                     ffsTermString,
+	"syncDestination":            ffsTermString,
+	"syncDestinationUsername":    ffsTermString,
+	"tabUrl":                     ffsTermString,
+	"trusted":                    ffsTermBoolean,
+	"url":                        ffsTermString,
+	"userUid":                    ffsTermString,
+	"windowTitle":                ffsTermString,
+}
+
+/*
+V2Terms holds the v1 query terms which have a v2 equivalent and the v2 name they are translated into
+With apiVersion v2 only these terms can be used, as the others cannot be sent to the v2 api
+*/
+var V2Terms = map[string]string{
+	"eventId":                    "event.id",
+	"eventType":                  "event.action",
+	"eventTimestamp":             "@timestamp",
+	"insertionTimestamp":         "event.inserted",
+	"source":                     "event.observer",
+	"sharingTypeAdded":           "event.shareType",
+	"deviceUserName":             "user.email",
+	"userUid":                    "user.id",
+	"deviceUid":                  "user.deviceUid",
+	"fileName":                   "file.name",
+	"filePath":                   "file.directory",
+	"fileCategory":               "file.category",
+	"fileCategoryByBytes":        "file.categoryByBytes",
+	"fileCategoryByExtension":    "file.categoryByExtension",
+	"mimeTypeByBytes":            "file.mimeTypeByBytes",
+	"mimeTypeByExtension":        "file.mimeTypeByExtension",
+	"fileSize":                   "file.sizeInBytes",
+	"fileOwner":                  "file.owner",
+	"createTimestamp":            "file.created",
+	"modifyTimestamp":            "file.modified",
+	"md5Checksum":                "file.hash.md5",
+	"sha256Checksum":             "file.hash.sha256",
+	"fileId":                     "file.id",
+	"url":                        "file.url",
+	"osHostName":                 "source.name",
+	"domainName":                 "source.domain",
+	"publicIpAddress":            "source.ip",
+	"privateIpAddresses":         "source.privateIp",
+	"emailSender":                "source.email.sender",
+	"emailFrom":                  "source.email.from",
+	"destinationCategory":        "destination.category",
+	"destinationName":            "destination.name",
+	"syncDestinationUsername":    "destination.user.email",
+	"emailRecipients":            "destination.email.recipients",
+	"emailSubject":               "destination.email.subject",
+	"printJobName":               "destination.printJobName",
+	"printerName":                "destination.printerName",
+	"tabUrl":                     "destination.tabs.url",
+	"removableMediaVendor":       "destination.removableMedia.vendor",
+	"removableMediaName":         "destination.removableMedia.name",
+	"removableMediaSerialNumber": "destination.removableMedia.serialNumber",
+	"removableMediaBusType":      "destination.removableMedia.busType",
+	"removableMediaMediaName":    "destination.removableMedia.mediaName",
+	"processName":                "process.executable",
+	"processOwner":               "process.owner",
+	"trusted":                    "risk.trusted",
+}
+
+//WITHIN_THE_LAST takes an ISO 8601 duration, ex: P1D, PT12H
+var iso8601DurationRegexp = regexp.MustCompile(`^P(\d+[YMWD])*(T(\d+[HMS])+)?$`)
+
+/*
+validateFFSQueryTerms - checks the terms, operators, values, and clauses of every filter in an ffs query against the catalogue of known terms
+query - the ffs query
+apiVersion - v1 or v2, v2 queries can only use the v1 terms which have a v2 equivalent
+Returns
+error - the first problem found, unknown terms include a suggestion of the closest known term
+*/
+func validateFFSQueryTerms(query ffs.Query, apiVersion string) error {
+	if err := validateClause("groupClause", query.GroupClause); err != nil {
+		return err
+	}
+
+	terms := apiVersionTerms(apiVersion)
+
+	for groupNumber, group := range query.Groups {
+		if err := validateClause("filterClause of group "+strconv.Itoa(groupNumber+1), group.FilterClause); err != nil {
+			return err
+		}
+
+		for _, filter := range group.Filters {
+			termType, found := terms[filter.Term]
+			if !found {
+				return unknownTermError(filter.Term, apiVersion, terms)
+			}
+
+			if !containsString(ffsTermOperators[termType], filter.Operator) {
+				return errors.New("operator: " + filter.Operator + " cannot be used with " + string(termType) + " term: " + filter.Term + ", allowed operators: " + strings.Join(ffsTermOperators[termType], ", "))
+			}
+
+			if err := validateFilterValue(termType, filter); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+//apiVersionTerms gets the terms which can be used in the queries of an api version
+func apiVersionTerms(apiVersion string) map[string]ffsTermType {
+	if apiVersion != "v2" {
+		return ffsTerms
+	}
+
+	terms := map[string]ffsTermType{}
+	for term := range V2Terms {
+		terms[term] = ffsTerms[term]
+	}
+
+	return terms
+}
+
+//unknownTermError builds the error of a term which cannot be used with the api version, suggesting the term to use instead
+func unknownTermError(term string, apiVersion string, terms map[string]ffsTermType) error {
+	if _, found := ffsTerms[term]; found {
+		return errors.New("term: " + term + " has no " + apiVersion + " equivalent and cannot be used with apiVersion " + apiVersion)
+	}
+
+	message := "unknown term: " + term
+	if suggestion := suggestTerm(term, terms); suggestion != "" {
+		message = message + ", did you mean " + suggestion + "?"
+	}
+
+	return errors.New(message)
+}
+
+func validateClause(name string, clause string) error {
+	if clause != "" && clause != "AND" && clause != "OR" {
+		return errors.New("invalid " + name + ": " + clause + ", must be AND or OR")
+	}
+	return nil
+}
+
+//validateFilterValue checks that the value of a filter matches the type of its term
+func validateFilterValue(termType ffsTermType, filter ffs.SearchFilter) error {
+	if filter.Operator == "EXISTS" || filter.Operator == "DOES_NOT_EXIST" {
+		return nil
+	}
+
+	switch termType {
+	case ffsTermTimestamp:
+		if filter.Operator == "WITHIN_THE_LAST" {
+			if !iso8601DurationRegexp.MatchString(filter.Value) || filter.Value == "P" {
+				return errors.New("invalid value: " + filter.Value + " for " + filter.Term + " WITHIN_THE_LAST, must be an ISO 8601 duration, ex: P1D or PT12H")
+			}
+		} else if filter.Value != "" {
+			//an empty value is filled in when the query is windowed
+			if _, err := time.Parse(time.RFC3339Nano, filter.Value); err != nil {
+				return errors.New("invalid value: " + filter.Value + " for " + filter.Term + " " + filter.Operator + ", must be in RFC3339 format, ex: 2019-08-29T16:31:48.728Z")
+			}
+		}
+	case ffsTermNumber:
+		if _, err := strconv.ParseInt(filter.Value, 10, 64); err != nil {
+			return errors.New("invalid value: " + filter.Value + " for " + filter.Term + ", must be a whole number")
+		}
+	case ffsTermBoolean:
+		if filter.Value != "true" && filter.Value != "false" {
+			return errors.New("invalid value: " + filter.Value + " for " + filter.Term + ", must be true or false")
+		}
+	}
+
+	return nil
+}
+
+/*
+suggestTerm - finds the closest of the known terms to an unknown one
+v2 names are not written in queries, so for a v2 name the v1 term it is translated from is suggested
+Returns
+string - the suggested term, empty if none are close
+*/
+func suggestTerm(term string, terms map[string]ffsTermType) string {
+	for v1Term, v2Term := range V2Terms {
+		if _, found := terms[v1Term]; found && v2Term == term {
+			return v1Term
+		}
+	}
+
+	var names []string
+	for name := range terms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	suggestion := ""
+	bestDistance := len(term)/3 + 2
+	for _, name := range names {
+		distance := levenshteinDistance(strings.ToLower(term), strings.ToLower(name))
+		if distance < bestDistance {
+			suggestion = name
+			bestDistance = distance
+		}
+	}
+
+	return suggestion
+}
+
+//levenshteinDistance is the number of single character edits needed to turn a into b
+func levenshteinDistance(a string, b string) int {
+	aRunes := []rune(a)
+	bRunes := []rune(b)
+
+	previous := make([]int, len(bRunes)+1)
+	current := make([]int, len(bRunes)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(aRunes); i++ {
+		current[0] = i
+		for j := 1; j <= len(bRunes); j++ {
+			cost := 1
+			if aRunes[i-1] == bRunes[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(minInt(previous[j]+1, current[j-1]+1), previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+
+	return previous[len(bRunes)]
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,93 @@
+package config
+
+import (
+	"github.com/BenB196/crashplan-ffs-go-pkg"
+	"strings"
+	"testing"
+)
+
+func TestSuggestTerm(t *testing.T) {
+	tests := []struct {
+		term       string
+		apiVersion string
+		want       string
+	}{
+		{term: "filename", apiVersion: "v1", want: "fileName"},
+		{term: "fileNme", apiVersion: "v1", want: "fileName"},
+		{term: "insertionTimestmap", apiVersion: "v1", want: "insertionTimestamp"},
+		{term: "expsure", apiVersion: "v1", want: "exposure"},
+		{term: "somethingElseEntirely", apiVersion: "v1", want: ""},
+		//v2 names are translated from the v1 terms, so the v1 term is suggested for both api versions
+		{term: "file.name", apiVersion: "v1", want: "fileName"},
+		{term: "event.inserted", apiVersion: "v2", want: "insertionTimestamp"},
+		//only the terms of the api version are suggested
+		{term: "expsure", apiVersion: "v2", want: ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.apiVersion+" "+test.term, func(t *testing.T) {
+			got := suggestTerm(test.term, apiVersionTerms(test.apiVersion))
+
+			if got != test.want {
+				t.Errorf("suggestTerm(%q) = %q, want %q", test.term, got, test.want)
+			}
+		})
+	}
+}
+
+func TestValidateFFSQueryTerms(t *testing.T) {
+	tests := []struct {
+		name       string
+		apiVersion string
+		filter     ffs.SearchFilter
+		//empty if the filter is valid
+		wantErr string
+	}{
+		{name: "string term", apiVersion: "v1", filter: ffs.SearchFilter{Operator: "IS", Term: "fileName", Value: "a.txt"}},
+		{name: "translated term", apiVersion: "v2", filter: ffs.SearchFilter{Operator: "IS", Term: "fileName", Value: "a.txt"}},
+		{name: "unknown term", apiVersion: "v1", filter: ffs.SearchFilter{Operator: "IS", Term: "fileNme", Value: "a.txt"}, wantErr: "unknown term: fileNme, did you mean fileName?"},
+		{name: "v2 name in a v1 query", apiVersion: "v1", filter: ffs.SearchFilter{Operator: "IS", Term: "file.name", Value: "a.txt"}, wantErr: "unknown term: file.name, did you mean fileName?"},
+		{name: "v2 name in a v2 query", apiVersion: "v2", filter: ffs.SearchFilter{Operator: "IS", Term: "file.name", Value: "a.txt"}, wantErr: "unknown term: file.name, did you mean fileName?"},
+		{name: "v2 only name", apiVersion: "v2", filter: ffs.SearchFilter{Operator: "IS", Term: "risk.severity", Value: "HIGH"}, wantErr: "unknown term: risk.severity"},
+		{name: "v1 term without a v2 equivalent", apiVersion: "v2", filter: ffs.SearchFilter{Operator: "IS", Term: "exposure", Value: "RemovableMedia"}, wantErr: "term: exposure has no v2 equivalent"},
+		{name: "string term with a number operator", apiVersion: "v1", filter: ffs.SearchFilter{Operator: "GREATER_THAN", Term: "fileName", Value: "a"}, wantErr: "operator: GREATER_THAN cannot be used with string term: fileName, allowed operators: IS, IS_NOT, EXISTS, DOES_NOT_EXIST"},
+		{name: "timestamp term with IS", apiVersion: "v1", filter: ffs.SearchFilter{Operator: "IS", Term: "eventTimestamp", Value: "2020-01-01T00:00:00Z"}, wantErr: "operator: IS cannot be used with timestamp term: eventTimestamp"},
+		{name: "empty timestamp is filled in when windowed", apiVersion: "v1", filter: ffs.SearchFilter{Operator: "ON_OR_AFTER", Term: "insertionTimestamp", Value: ""}},
+		{name: "timestamp not in RFC3339", apiVersion: "v1", filter: ffs.SearchFilter{Operator: "ON_OR_AFTER", Term: "insertionTimestamp", Value: "2020-01-01"}, wantErr: "must be in RFC3339 format"},
+		{name: "WITHIN_THE_LAST duration", apiVersion: "v1", filter: ffs.SearchFilter{Operator: "WITHIN_THE_LAST", Term: "eventTimestamp", Value: "PT12H"}},
+		{name: "WITHIN_THE_LAST not a duration", apiVersion: "v1", filter: ffs.SearchFilter{Operator: "WITHIN_THE_LAST", Term: "eventTimestamp", Value: "1d"}, wantErr: "must be an ISO 8601 duration"},
+		{name: "WITHIN_THE_LAST empty duration", apiVersion: "v1", filter: ffs.SearchFilter{Operator: "WITHIN_THE_LAST", Term: "eventTimestamp", Value: "P"}, wantErr: "must be an ISO 8601 duration"},
+		{name: "number", apiVersion: "v1", filter: ffs.SearchFilter{Operator: "GREATER_THAN", Term: "fileSize", Value: "100"}},
+		{name: "number not whole", apiVersion: "v1", filter: ffs.SearchFilter{Operator: "GREATER_THAN", Term: "fileSize", Value: "1.5"}, wantErr: "invalid value: 1.5 for fileSize, must be a whole number"},
+		{name: "boolean not true or false", apiVersion: "v1", filter: ffs.SearchFilter{Operator: "IS", Term: "trusted", Value: "yes"}, wantErr: "invalid value: yes for trusted, must be true or false"},
+		{name: "EXISTS has no value", apiVersion: "v1", filter: ffs.SearchFilter{Operator: "EXISTS", Term: "fileSize", Value: ""}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			query := ffs.Query{Groups: []ffs.Group{{Filters: []ffs.SearchFilter{test.filter}, FilterClause: "AND"}}, GroupClause: "AND"}
+
+			err := validateFFSQueryTerms(query, test.apiVersion)
+
+			if test.wantErr == "" && err != nil {
+				t.Errorf("error = %v, want none", err)
+			} else if test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)) {
+				t.Errorf("error = %v, want one containing %q", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateFFSQueryTermsClauses(t *testing.T) {
+	filters := []ffs.SearchFilter{{Operator: "IS", Term: "fileName", Value: "a.txt"}}
+
+	err := validateFFSQueryTerms(ffs.Query{Groups: []ffs.Group{{Filters: filters, FilterClause: "AND"}}, GroupClause: "XOR"}, "v1")
+	if err == nil || !strings.Contains(err.Error(), "invalid groupClause: XOR") {
+		t.Errorf("error = %v, want an invalid groupClause", err)
+	}
+
+	err = validateFFSQueryTerms(ffs.Query{Groups: []ffs.Group{{Filters: filters, FilterClause: "AND"}, {Filters: filters, FilterClause: "NOR"}}, GroupClause: "AND"}, "v1")
+	if err == nil || !strings.Contains(err.Error(), "invalid filterClause of group 2: NOR") {
+		t.Errorf("error = %v, want an invalid filterClause of group 2", err)
+	}
+}
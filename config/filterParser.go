@@ -0,0 +1,467 @@
+package config
+
+import (
+	"errors"
+	"github.com/BenB196/crashplan-ffs-go-pkg"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+/*
+Filter expressions are a compact way of writing the groups and filters of an ffs query, ex:
+
+	exposure IN (RemovableMedia, ApplicationRead) AND fileCategory = "SourceCode"
+
+An expression is a list of operands joined by a single combinator (AND or OR), which becomes the groupClause
+Each operand becomes one group:
+	term = value                  - a group with a single filter
+	term IN (value, value)        - a group of IS filters joined by OR
+	term NOT IN (value, value)    - a group of IS_NOT filters joined by AND
+	(comparison AND comparison)   - a group of filters joined by the combinator inside the parentheses
+Comparisons are:
+	term = value, term != value, term >= value, term <= value, term > value, term < value
+	term EXISTS, term NOT EXISTS
+	term <FFS operator> value, ex: eventTimestamp WITHIN_THE_LAST P1D
+Values can be bare words or double quoted strings, quotes can be escaped with \"
+*/
+
+//Operators which can be used with filter expressions
+var filterOperators = map[string]string{
+	"=":  "IS",
+	"!=": "IS_NOT",
+	">=": "ON_OR_AFTER",
+	"<=": "ON_OR_BEFORE",
+	">":  "GREATER_THAN",
+	"<":  "LESS_THAN",
+}
+
+//FFS operators which can be written out in full in filter expressions
+var ffsOperators = map[string]bool{
+	"IS":              true,
+	"IS_NOT":          true,
+	"ON_OR_AFTER":     true,
+	"ON_OR_BEFORE":    true,
+	"WITHIN_THE_LAST": true,
+	"EXISTS":          true,
+	"DOES_NOT_EXIST":  true,
+	"GREATER_THAN":    true,
+	"LESS_THAN":       true,
+}
+
+type filterTokenType int
+
+const (
+	filterTokenWord filterTokenType = iota
+	filterTokenString
+	filterTokenOperator
+	filterTokenOpenParen
+	filterTokenCloseParen
+	filterTokenComma
+	filterTokenEnd
+)
+
+type filterToken struct {
+	tokenType filterTokenType
+	value     string
+	position  int
+}
+
+type filterParser struct {
+	tokens   []filterToken
+	position int
+}
+
+/*
+compileFilter - compiles a filter expression into ffs query groups
+If the expression does not contain an ON_OR_AFTER or an ON_OR_BEFORE filter for the timestamp term, a group with the missing ones left empty is added for the query to be windowed on
+filter - the filter expression
+timestampTerm - the term the query is windowed on
+Returns
+ffs.Query - the compiled query
+error - a parse error, including the position in the expression it happened at
+*/
+func compileFilter(filter string, timestampTerm string) (ffs.Query, error) {
+	tokens, err := tokenizeFilter(filter)
+
+	if err != nil {
+		return ffs.Query{}, err
+	}
+
+	parser := filterParser{tokens: tokens}
+
+	var groups []ffs.Group
+	var groupClause string
+	for {
+		group, err := parser.parseOperand()
+
+		if err != nil {
+			return ffs.Query{}, err
+		}
+
+		groups = append(groups, group)
+
+		token := parser.next()
+		if token.tokenType == filterTokenEnd {
+			break
+		}
+
+		combinator, err := parseCombinator(token)
+
+		if err != nil {
+			return ffs.Query{}, err
+		}
+
+		if groupClause != "" && combinator != groupClause {
+			return ffs.Query{}, filterError(token, "cannot mix AND and OR, use parentheses to group them")
+		}
+		groupClause = combinator
+	}
+
+	if groupClause == "" {
+		groupClause = "AND"
+	}
+
+	query := ffs.Query{
+		Groups:      groups,
+		GroupClause: groupClause,
+	}
+
+	err = checkTimestampBounds(query, timestampTerm)
+
+	if err != nil {
+		return ffs.Query{}, err
+	}
+
+	hasOnOrAfter := hasFilterForTerm(query, "ON_OR_AFTER", timestampTerm)
+	hasOnOrBefore := hasFilterForTerm(query, "ON_OR_BEFORE", timestampTerm)
+
+	if hasOnOrAfter && hasOnOrBefore {
+		return query, nil
+	}
+
+	//The time window has to be ANDed with the rest of the query
+	if query.GroupClause == "OR" {
+		var filters []ffs.SearchFilter
+		for _, group := range query.Groups {
+			if len(group.Filters) != 1 {
+				return ffs.Query{}, errors.New("error: filter cannot be ORed with the time window of the query, wrap the OR in parentheses or add the " + timestampTerm + " >= and <= filters to it")
+			}
+			filters = append(filters, group.Filters...)
+		}
+		query.Groups = []ffs.Group{{Filters: filters, FilterClause: "OR"}}
+		query.GroupClause = "AND"
+	}
+
+	//Only the missing bound is added, a bound in the expression is kept as the query's start or end
+	var windowFilters []ffs.SearchFilter
+	if !hasOnOrAfter {
+		windowFilters = append(windowFilters, ffs.SearchFilter{Operator: "ON_OR_AFTER", Term: timestampTerm, Value: ""})
+	}
+	if !hasOnOrBefore {
+		windowFilters = append(windowFilters, ffs.SearchFilter{Operator: "ON_OR_BEFORE", Term: timestampTerm, Value: ""})
+	}
+
+	query.Groups = append(query.Groups, ffs.Group{
+		Filters:      windowFilters,
+		FilterClause: "AND",
+	})
+
+	return query, nil
+}
+
+/*
+checkTimestampBounds - checks that every ON_OR_AFTER and ON_OR_BEFORE filter of the timestamp term is ANDed with the rest of the query
+A bound which is ORed, ex: fileName = a OR insertionTimestamp >= X, would be taken as the start or end of the query's window while only limiting part of it
+Returns
+error - the first bound which is not in an AND group of a top level AND
+*/
+func checkTimestampBounds(query ffs.Query, timestampTerm string) error {
+	for _, group := range query.Groups {
+		for _, filter := range group.Filters {
+			if filter.Term != timestampTerm || (filter.Operator != "ON_OR_AFTER" && filter.Operator != "ON_OR_BEFORE") {
+				continue
+			}
+
+			if query.GroupClause != "AND" || group.FilterClause != "AND" {
+				return errors.New("error: filter has the " + timestampTerm + " " + filter.Operator + " bound in an OR, bounds of the query's time window can only be ANDed with the rest of the query")
+			}
+		}
+	}
+
+	return nil
+}
+
+//hasFilterForTerm checks if a query has a filter with an operator for a term
+func hasFilterForTerm(query ffs.Query, operator string, term string) bool {
+	for _, group := range query.Groups {
+		for _, filter := range group.Filters {
+			if filter.Operator == operator && filter.Term == term {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+//tokenizeFilter splits a filter expression into tokens
+func tokenizeFilter(filter string) ([]filterToken, error) {
+	var tokens []filterToken
+	runes := []rune(filter)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, filterToken{tokenType: filterTokenOpenParen, value: "(", position: i})
+			i++
+		case r == ')':
+			tokens = append(tokens, filterToken{tokenType: filterTokenCloseParen, value: ")", position: i})
+			i++
+		case r == ',':
+			tokens = append(tokens, filterToken{tokenType: filterTokenComma, value: ",", position: i})
+			i++
+		case r == '"':
+			start := i
+			var value strings.Builder
+			i++
+			for ; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+				}
+				value.WriteRune(runes[i])
+			}
+			if i >= len(runes) {
+				return nil, errors.New("error: filter has an unterminated string starting at position " + strconv.Itoa(start))
+			}
+			i++
+			tokens = append(tokens, filterToken{tokenType: filterTokenString, value: value.String(), position: start})
+		case r == '=' || r == '!' || r == '>' || r == '<':
+			start := i
+			i++
+			if i < len(runes) && runes[i] == '=' {
+				i++
+			}
+			operator := string(runes[start:i])
+			if _, found := filterOperators[operator]; !found {
+				return nil, errors.New("error: filter has an unknown operator: " + operator + " at position " + strconv.Itoa(start))
+			}
+			tokens = append(tokens, filterToken{tokenType: filterTokenOperator, value: operator, position: start})
+		default:
+			start := i
+			for ; i < len(runes); i++ {
+				if unicode.IsSpace(runes[i]) || strings.ContainsRune("(),\"=!<>", runes[i]) {
+					break
+				}
+			}
+			tokens = append(tokens, filterToken{tokenType: filterTokenWord, value: string(runes[start:i]), position: start})
+		}
+	}
+
+	tokens = append(tokens, filterToken{tokenType: filterTokenEnd, position: len(runes)})
+
+	return tokens, nil
+}
+
+func (parser *filterParser) next() filterToken {
+	token := parser.tokens[parser.position]
+	if token.tokenType != filterTokenEnd {
+		parser.position++
+	}
+	return token
+}
+
+func (parser *filterParser) peek() filterToken {
+	return parser.tokens[parser.position]
+}
+
+//parseOperand parses a single top level operand of the expression into a group
+func (parser *filterParser) parseOperand() (ffs.Group, error) {
+	if parser.peek().tokenType != filterTokenOpenParen {
+		return parser.parseComparison()
+	}
+
+	openParen := parser.next()
+
+	var group ffs.Group
+	for {
+		if parser.peek().tokenType == filterTokenOpenParen {
+			return ffs.Group{}, filterError(parser.peek(), "parentheses can only be nested one level deep")
+		}
+
+		comparison, err := parser.parseComparison()
+
+		if err != nil {
+			return ffs.Group{}, err
+		}
+
+		//IN groups can only be flattened into a group with the same combinator
+		if len(comparison.Filters) > 1 && group.FilterClause != "" && group.FilterClause != comparison.FilterClause {
+			return ffs.Group{}, filterError(openParen, "IN cannot be mixed with "+group.FilterClause+" inside parentheses")
+		}
+		if len(comparison.Filters) > 1 {
+			group.FilterClause = comparison.FilterClause
+		}
+		group.Filters = append(group.Filters, comparison.Filters...)
+
+		token := parser.next()
+		if token.tokenType == filterTokenCloseParen {
+			break
+		}
+
+		combinator, err := parseCombinator(token)
+
+		if err != nil {
+			return ffs.Group{}, err
+		}
+
+		if group.FilterClause != "" && combinator != group.FilterClause {
+			return ffs.Group{}, filterError(token, "cannot mix AND and OR inside parentheses")
+		}
+		group.FilterClause = combinator
+	}
+
+	if group.FilterClause == "" {
+		group.FilterClause = "AND"
+	}
+
+	return group, nil
+}
+
+//parseComparison parses a single comparison, IN comparisons return a group with a filter per value
+func (parser *filterParser) parseComparison() (ffs.Group, error) {
+	termToken := parser.next()
+
+	if termToken.tokenType != filterTokenWord || isFilterKeyword(termToken.value) {
+		return ffs.Group{}, filterError(termToken, "expected a term")
+	}
+
+	if !isValidTermName(termToken.value) {
+		return ffs.Group{}, filterError(termToken, "invalid term name: "+termToken.value)
+	}
+
+	term := termToken.value
+	operatorToken := parser.next()
+
+	switch {
+	case operatorToken.tokenType == filterTokenOperator:
+		value, err := parser.parseValue()
+
+		if err != nil {
+			return ffs.Group{}, err
+		}
+
+		return singleFilterGroup(filterOperators[operatorToken.value], term, value), nil
+	case operatorToken.tokenType == filterTokenWord && strings.EqualFold(operatorToken.value, "IN"):
+		return parser.parseIn(term, "IS", "OR")
+	case operatorToken.tokenType == filterTokenWord && strings.EqualFold(operatorToken.value, "EXISTS"):
+		return singleFilterGroup("EXISTS", term, ""), nil
+	case operatorToken.tokenType == filterTokenWord && strings.EqualFold(operatorToken.value, "NOT"):
+		notToken := parser.next()
+		if notToken.tokenType == filterTokenWord && strings.EqualFold(notToken.value, "IN") {
+			return parser.parseIn(term, "IS_NOT", "AND")
+		} else if notToken.tokenType == filterTokenWord && strings.EqualFold(notToken.value, "EXISTS") {
+			return singleFilterGroup("DOES_NOT_EXIST", term, ""), nil
+		}
+		return ffs.Group{}, filterError(notToken, "expected IN or EXISTS after NOT")
+	case operatorToken.tokenType == filterTokenWord && ffsOperators[strings.ToUpper(operatorToken.value)]:
+		operator := strings.ToUpper(operatorToken.value)
+		if operator == "EXISTS" || operator == "DOES_NOT_EXIST" {
+			return singleFilterGroup(operator, term, ""), nil
+		}
+
+		value, err := parser.parseValue()
+
+		if err != nil {
+			return ffs.Group{}, err
+		}
+
+		return singleFilterGroup(operator, term, value), nil
+	}
+
+	return ffs.Group{}, filterError(operatorToken, "expected an operator after term: "+term)
+}
+
+//parseIn parses the value list of an IN comparison into a group of filters
+func (parser *filterParser) parseIn(term string, operator string, filterClause string) (ffs.Group, error) {
+	openParen := parser.next()
+
+	if openParen.tokenType != filterTokenOpenParen {
+		return ffs.Group{}, filterError(openParen, "expected ( after IN")
+	}
+
+	group := ffs.Group{FilterClause: filterClause}
+	for {
+		value, err := parser.parseValue()
+
+		if err != nil {
+			return ffs.Group{}, err
+		}
+
+		group.Filters = append(group.Filters, ffs.SearchFilter{Operator: operator, Term: term, Value: value})
+
+		token := parser.next()
+		if token.tokenType == filterTokenCloseParen {
+			return group, nil
+		} else if token.tokenType != filterTokenComma {
+			return ffs.Group{}, filterError(token, "expected , or ) in IN list")
+		}
+	}
+}
+
+//parseValue parses a bare word or quoted string value
+func (parser *filterParser) parseValue() (string, error) {
+	token := parser.next()
+
+	if token.tokenType == filterTokenString || (token.tokenType == filterTokenWord && !isFilterKeyword(token.value)) {
+		return token.value, nil
+	}
+
+	return "", filterError(token, "expected a value")
+}
+
+func parseCombinator(token filterToken) (string, error) {
+	if token.tokenType == filterTokenWord {
+		combinator := strings.ToUpper(token.value)
+		if combinator == "AND" || combinator == "OR" {
+			return combinator, nil
+		}
+	}
+
+	return "", filterError(token, "expected AND or OR")
+}
+
+func singleFilterGroup(operator string, term string, value string) ffs.Group {
+	return ffs.Group{
+		Filters:      []ffs.SearchFilter{{Operator: operator, Term: term, Value: value}},
+		FilterClause: "AND",
+	}
+}
+
+func isFilterKeyword(word string) bool {
+	switch strings.ToUpper(word) {
+	case "AND", "OR", "IN", "NOT", "EXISTS":
+		return true
+	}
+	return false
+}
+
+//isValidTermName checks that a term is made up of letters, digits, dots (v2 terms), and @ (@timestamp)
+func isValidTermName(term string) bool {
+	for _, r := range term {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '.' && r != '@' && r != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+func filterError(token filterToken, message string) error {
+	if token.tokenType == filterTokenEnd {
+		return errors.New("error: filter ended unexpectedly, " + message)
+	}
+	return errors.New("error: filter at position " + strconv.Itoa(token.position) + " (" + token.value + "), " + message)
+}
@@ -0,0 +1,249 @@
+package config
+
+import (
+	"github.com/BenB196/crashplan-ffs-go-pkg"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+//window is the group compileFilter adds for the bounds which are missing from an expression
+func window(filters ...ffs.SearchFilter) ffs.Group {
+	return ffs.Group{Filters: filters, FilterClause: "AND"}
+}
+
+var (
+	emptyOnOrAfter  = ffs.SearchFilter{Operator: "ON_OR_AFTER", Term: "insertionTimestamp", Value: ""}
+	emptyOnOrBefore = ffs.SearchFilter{Operator: "ON_OR_BEFORE", Term: "insertionTimestamp", Value: ""}
+)
+
+func TestCompileFilter(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter string
+		want   ffs.Query
+	}{
+		{
+			name:   "single comparison gets both bounds",
+			filter: "fileName = foo",
+			want: ffs.Query{
+				Groups: []ffs.Group{
+					{Filters: []ffs.SearchFilter{{Operator: "IS", Term: "fileName", Value: "foo"}}, FilterClause: "AND"},
+					window(emptyOnOrAfter, emptyOnOrBefore),
+				},
+				GroupClause: "AND",
+			},
+		},
+		{
+			name:   "ON_OR_AFTER only gets an empty ON_OR_BEFORE",
+			filter: `insertionTimestamp >= "2020-01-01T00:00:00.000Z" AND fileName = foo`,
+			want: ffs.Query{
+				Groups: []ffs.Group{
+					{Filters: []ffs.SearchFilter{{Operator: "ON_OR_AFTER", Term: "insertionTimestamp", Value: "2020-01-01T00:00:00.000Z"}}, FilterClause: "AND"},
+					{Filters: []ffs.SearchFilter{{Operator: "IS", Term: "fileName", Value: "foo"}}, FilterClause: "AND"},
+					window(emptyOnOrBefore),
+				},
+				GroupClause: "AND",
+			},
+		},
+		{
+			name:   "ON_OR_BEFORE only gets an empty ON_OR_AFTER",
+			filter: `fileName = foo AND insertionTimestamp ON_OR_BEFORE "2020-02-01T00:00:00.000Z"`,
+			want: ffs.Query{
+				Groups: []ffs.Group{
+					{Filters: []ffs.SearchFilter{{Operator: "IS", Term: "fileName", Value: "foo"}}, FilterClause: "AND"},
+					{Filters: []ffs.SearchFilter{{Operator: "ON_OR_BEFORE", Term: "insertionTimestamp", Value: "2020-02-01T00:00:00.000Z"}}, FilterClause: "AND"},
+					window(emptyOnOrAfter),
+				},
+				GroupClause: "AND",
+			},
+		},
+		{
+			name:   "both bounds are left as they are",
+			filter: `insertionTimestamp >= "2020-01-01T00:00:00.000Z" AND insertionTimestamp <= "2020-02-01T00:00:00.000Z" AND fileName = foo`,
+			want: ffs.Query{
+				Groups: []ffs.Group{
+					{Filters: []ffs.SearchFilter{{Operator: "ON_OR_AFTER", Term: "insertionTimestamp", Value: "2020-01-01T00:00:00.000Z"}}, FilterClause: "AND"},
+					{Filters: []ffs.SearchFilter{{Operator: "ON_OR_BEFORE", Term: "insertionTimestamp", Value: "2020-02-01T00:00:00.000Z"}}, FilterClause: "AND"},
+					{Filters: []ffs.SearchFilter{{Operator: "IS", Term: "fileName", Value: "foo"}}, FilterClause: "AND"},
+				},
+				GroupClause: "AND",
+			},
+		},
+		{
+			name:   "bounds on another term do not count",
+			filter: `eventTimestamp >= "2020-01-01T00:00:00.000Z"`,
+			want: ffs.Query{
+				Groups: []ffs.Group{
+					{Filters: []ffs.SearchFilter{{Operator: "ON_OR_AFTER", Term: "eventTimestamp", Value: "2020-01-01T00:00:00.000Z"}}, FilterClause: "AND"},
+					window(emptyOnOrAfter, emptyOnOrBefore),
+				},
+				GroupClause: "AND",
+			},
+		},
+		{
+			name:   "OR of single comparisons is folded into one group ANDed with the window",
+			filter: "fileName = a.txt OR fileName = b.txt",
+			want: ffs.Query{
+				Groups: []ffs.Group{
+					{Filters: []ffs.SearchFilter{{Operator: "IS", Term: "fileName", Value: "a.txt"}, {Operator: "IS", Term: "fileName", Value: "b.txt"}}, FilterClause: "OR"},
+					window(emptyOnOrAfter, emptyOnOrBefore),
+				},
+				GroupClause: "AND",
+			},
+		},
+		{
+			name:   "parenthesised OR is a single group",
+			filter: "(fileName = a.txt OR fileName = b.txt) AND exposure = RemovableMedia",
+			want: ffs.Query{
+				Groups: []ffs.Group{
+					{Filters: []ffs.SearchFilter{{Operator: "IS", Term: "fileName", Value: "a.txt"}, {Operator: "IS", Term: "fileName", Value: "b.txt"}}, FilterClause: "OR"},
+					{Filters: []ffs.SearchFilter{{Operator: "IS", Term: "exposure", Value: "RemovableMedia"}}, FilterClause: "AND"},
+					window(emptyOnOrAfter, emptyOnOrBefore),
+				},
+				GroupClause: "AND",
+			},
+		},
+		{
+			name:   "IN and NOT IN",
+			filter: `exposure IN (RemovableMedia, ApplicationRead) AND fileCategory NOT IN ("Source Code", Image)`,
+			want: ffs.Query{
+				Groups: []ffs.Group{
+					{Filters: []ffs.SearchFilter{{Operator: "IS", Term: "exposure", Value: "RemovableMedia"}, {Operator: "IS", Term: "exposure", Value: "ApplicationRead"}}, FilterClause: "OR"},
+					{Filters: []ffs.SearchFilter{{Operator: "IS_NOT", Term: "fileCategory", Value: "Source Code"}, {Operator: "IS_NOT", Term: "fileCategory", Value: "Image"}}, FilterClause: "AND"},
+					window(emptyOnOrAfter, emptyOnOrBefore),
+				},
+				GroupClause: "AND",
+			},
+		},
+		{
+			name:   "parenthesised IN is flattened into an OR group",
+			filter: "(exposure IN (RemovableMedia, ApplicationRead) OR fileName = a.txt) AND insertionTimestamp >= 2020-01-01T00:00:00.000Z",
+			want: ffs.Query{
+				Groups: []ffs.Group{
+					{Filters: []ffs.SearchFilter{{Operator: "IS", Term: "exposure", Value: "RemovableMedia"}, {Operator: "IS", Term: "exposure", Value: "ApplicationRead"}, {Operator: "IS", Term: "fileName", Value: "a.txt"}}, FilterClause: "OR"},
+					{Filters: []ffs.SearchFilter{{Operator: "ON_OR_AFTER", Term: "insertionTimestamp", Value: "2020-01-01T00:00:00.000Z"}}, FilterClause: "AND"},
+					window(emptyOnOrBefore),
+				},
+				GroupClause: "AND",
+			},
+		},
+		{
+			name:   "ORed bounds on another term are kept",
+			filter: `fileName = a OR eventTimestamp >= "2020-01-01T00:00:00.000Z"`,
+			want: ffs.Query{
+				Groups: []ffs.Group{
+					{Filters: []ffs.SearchFilter{{Operator: "IS", Term: "fileName", Value: "a"}, {Operator: "ON_OR_AFTER", Term: "eventTimestamp", Value: "2020-01-01T00:00:00.000Z"}}, FilterClause: "OR"},
+					window(emptyOnOrAfter, emptyOnOrBefore),
+				},
+				GroupClause: "AND",
+			},
+		},
+		{
+			name:   "parenthesised AND of both bounds",
+			filter: `(insertionTimestamp >= "2020-01-01T00:00:00.000Z" AND insertionTimestamp <= "2020-02-01T00:00:00.000Z") AND fileName = foo`,
+			want: ffs.Query{
+				Groups: []ffs.Group{
+					{Filters: []ffs.SearchFilter{{Operator: "ON_OR_AFTER", Term: "insertionTimestamp", Value: "2020-01-01T00:00:00.000Z"}, {Operator: "ON_OR_BEFORE", Term: "insertionTimestamp", Value: "2020-02-01T00:00:00.000Z"}}, FilterClause: "AND"},
+					{Filters: []ffs.SearchFilter{{Operator: "IS", Term: "fileName", Value: "foo"}}, FilterClause: "AND"},
+				},
+				GroupClause: "AND",
+			},
+		},
+		{
+			name:   "EXISTS, NOT EXISTS, and written out operators",
+			filter: `fileSize > 100 AND mimeTypeByBytes EXISTS AND tabUrl NOT EXISTS AND eventTimestamp WITHIN_THE_LAST P1D AND fileName != "a \"b\""`,
+			want: ffs.Query{
+				Groups: []ffs.Group{
+					{Filters: []ffs.SearchFilter{{Operator: "GREATER_THAN", Term: "fileSize", Value: "100"}}, FilterClause: "AND"},
+					{Filters: []ffs.SearchFilter{{Operator: "EXISTS", Term: "mimeTypeByBytes", Value: ""}}, FilterClause: "AND"},
+					{Filters: []ffs.SearchFilter{{Operator: "DOES_NOT_EXIST", Term: "tabUrl", Value: ""}}, FilterClause: "AND"},
+					{Filters: []ffs.SearchFilter{{Operator: "WITHIN_THE_LAST", Term: "eventTimestamp", Value: "P1D"}}, FilterClause: "AND"},
+					{Filters: []ffs.SearchFilter{{Operator: "IS_NOT", Term: "fileName", Value: `a "b"`}}, FilterClause: "AND"},
+					window(emptyOnOrAfter, emptyOnOrBefore),
+				},
+				GroupClause: "AND",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := compileFilter(test.filter, "insertionTimestamp")
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("compileFilter(%q)\n got %+v\nwant %+v", test.filter, got, test.want)
+			}
+		})
+	}
+}
+
+func TestCompileFilterErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  string
+		wantErr string
+	}{
+		{name: "mixed AND and OR", filter: "a = 1 AND b = 2 OR c = 3", wantErr: "cannot mix AND and OR"},
+		{name: "mixed AND and OR in parentheses", filter: "(a = 1 AND b = 2 OR c = 3)", wantErr: "cannot mix AND and OR inside parentheses"},
+		{name: "nested parentheses", filter: "((a = 1))", wantErr: "one level deep"},
+		{name: "IN mixed with AND in parentheses", filter: "(a = 1 AND b IN (1, 2))", wantErr: "IN cannot be mixed with"},
+		{name: "OR of a group with the time window", filter: "(a = 1 AND b = 2) OR c = 3", wantErr: "cannot be ORed with the time window"},
+		{name: "unterminated string", filter: `a = "b`, wantErr: "unterminated string"},
+		{name: "unknown operator", filter: "a !! b", wantErr: "unknown operator"},
+		{name: "missing value", filter: "a =", wantErr: "ended unexpectedly"},
+		{name: "missing operator", filter: "a b", wantErr: "expected an operator"},
+		{name: "bad IN list", filter: "a IN (1 2)", wantErr: "expected , or )"},
+		{name: "IN without parentheses", filter: "a IN 1", wantErr: "expected ( after IN"},
+		{name: "NOT without IN or EXISTS", filter: "a NOT b", wantErr: "expected IN or EXISTS after NOT"},
+		{name: "keyword as a term", filter: "AND = 1", wantErr: "expected a term"},
+		{name: "invalid term name", filter: "a-b = 1", wantErr: "invalid term name"},
+		{name: "bad combinator", filter: "a = 1 XOR b = 2", wantErr: "expected AND or OR"},
+		{name: "single bound ORed with comparisons", filter: `fileName = a OR fileName = b OR insertionTimestamp >= "2020-01-01T00:00:00.000Z"`, wantErr: "insertionTimestamp ON_OR_AFTER bound in an OR"},
+		{name: "both bounds ORed", filter: `insertionTimestamp >= "2020-01-01T00:00:00.000Z" OR insertionTimestamp <= "2020-02-01T00:00:00.000Z"`, wantErr: "bound in an OR"},
+		{name: "bound in a parenthesised OR", filter: `(fileName = a OR insertionTimestamp <= "2020-02-01T00:00:00.000Z") AND fileName = b`, wantErr: "insertionTimestamp ON_OR_BEFORE bound in an OR"},
+		{name: "bound ORed with an IN", filter: `(exposure IN (RemovableMedia, ApplicationRead) OR insertionTimestamp >= "2020-01-01T00:00:00.000Z")`, wantErr: "bound in an OR"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := compileFilter(test.filter, "insertionTimestamp")
+
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("compileFilter(%q) error = %v, want one containing %q", test.filter, err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateConfigJsonFilterWithOneBound(t *testing.T) {
+	configJson := `{
+		"authURI": "https://example.com/c42api/v3/auth/jwt?useBody=true",
+		"ffsURI": "https://example.com/forensic-search/queryservice/api/v1/fileevent/export",
+		"ffsQueries": [{
+			"name": "test",
+			"username": "user@example.com",
+			"password": "password",
+			"interval": "5m",
+			"timeGap": "5m",
+			"filter": "insertionTimestamp >= \"2020-01-01T00:00:00.000Z\" AND fileName = foo",
+			"outputType": "file",
+			"outputLocation": "` + t.TempDir() + `"
+		}]
+	}`
+
+	config, err := validateConfigJson([]byte(configJson))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	groups := config.FFSQueries[0].Query.Groups
+	if len(groups) != 3 || !reflect.DeepEqual(groups[2], window(emptyOnOrBefore)) {
+		t.Errorf("groups = %+v, want the expression's groups and an empty ON_OR_BEFORE", groups)
+	}
+}
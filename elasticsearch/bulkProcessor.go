@@ -0,0 +1,134 @@
+package elasticsearch
+
+import (
+	"context"
+	"errors"
+	"github.com/BenB196/crashplan-ffs-puller/config"
+	"github.com/BenB196/crashplan-ffs-puller/promMetrics"
+	"github.com/olivere/elastic/v7"
+	"strconv"
+	"sync"
+	"time"
+)
+
+//sharedBulkProcessors holds the bulk processor of each ffs query, which lives for as long as the puller runs
+var sharedBulkProcessors = struct {
+	mutex      sync.Mutex
+	processors map[string]*elastic.BulkProcessor
+}{processors: map[string]*elastic.BulkProcessor{}}
+
+/*
+sharedBulkFailures holds the first failure of the bulk processor of each ffs query
+A failure is kept rather than cleared once it is returned, as the processor is shared by every window of the query,
+so every window which is flushed after an event was rejected fails instead of being completed without its events
+*/
+var sharedBulkFailures = struct {
+	mutex    sync.Mutex
+	failures map[string]error
+}{failures: map[string]error{}}
+
+//recordBulkFailures builds the after callback of a query's bulk processor, which records a failed bulk request or the first event rejected in one
+func recordBulkFailures(queryName string) elastic.BulkAfterFunc {
+	return func(executionId int64, requests []elastic.BulkableRequest, response *elastic.BulkResponse, err error) {
+		if err != nil {
+			err = errors.New("error sending elastic bulk request: " + err.Error())
+		} else if response != nil && response.Errors {
+			for _, item := range response.Failed() {
+				reason := "status " + strconv.Itoa(item.Status)
+				if item.Error != nil {
+					reason = item.Error.Type + ": " + item.Error.Reason
+				}
+				err = errors.New("error indexing event into index: " + item.Index + ", " + reason)
+				break
+			}
+		}
+
+		if err == nil {
+			return
+		}
+
+		sharedBulkFailures.mutex.Lock()
+		defer sharedBulkFailures.mutex.Unlock()
+
+		if _, found := sharedBulkFailures.failures[queryName]; !found {
+			sharedBulkFailures.failures[queryName] = err
+		}
+	}
+}
+
+//bulkFailure gets the first failure of a query's bulk processor, nil if nothing has failed
+func bulkFailure(queryName string) error {
+	sharedBulkFailures.mutex.Lock()
+	defer sharedBulkFailures.mutex.Unlock()
+
+	return sharedBulkFailures.failures[queryName]
+}
+
+/*
+GetBulkProcessor - gets the bulk processor of an ffs query, starting it on first use
+Returns
+*elastic.BulkProcessor - the bulk processor
+error - any errors which have been caught
+*/
+func GetBulkProcessor(client *elastic.Client, ctx context.Context, queryName string, elasticConfig config.Elasticsearch) (*elastic.BulkProcessor, error) {
+	sharedBulkProcessors.mutex.Lock()
+	defer sharedBulkProcessors.mutex.Unlock()
+
+	if processor, found := sharedBulkProcessors.processors[queryName]; found {
+		return processor, nil
+	}
+
+	bulk := elasticConfig.Bulk
+
+	service := client.BulkProcessor().
+		Name(queryName + "BGWorker").
+		Workers(bulk.Workers).
+		BulkActions(bulk.Actions).
+		BulkSize(bulk.Size).
+		Stats(true).
+		After(recordBulkFailures(queryName))
+
+	//the bulk options are validated when the config is read
+	if bulk.FlushInterval != "" {
+		flushInterval, _ := time.ParseDuration(bulk.FlushInterval)
+		service = service.FlushInterval(flushInterval)
+	}
+
+	if bulk.InitialBackoff != "" || bulk.MaxBackoff != "" {
+		initialBackoff := defaultInitialBackoff
+		if bulk.InitialBackoff != "" {
+			initialBackoff, _ = time.ParseDuration(bulk.InitialBackoff)
+		}
+
+		maxBackoff := defaultMaxBackoff
+		if bulk.MaxBackoff != "" {
+			maxBackoff, _ = time.ParseDuration(bulk.MaxBackoff)
+		}
+
+		service = service.Backoff(elastic.NewExponentialBackoff(initialBackoff, maxBackoff))
+	}
+
+	processor, err := service.Do(ctx)
+
+	if err != nil {
+		return nil, errors.New("error starting elastic bulk processor: " + err.Error())
+	}
+
+	sharedBulkProcessors.processors[queryName] = processor
+
+	return processor, nil
+}
+
+/*
+ExportBulkStats - sets the bulk metrics of an ffs query from the stats of its bulk processor
+*/
+func ExportBulkStats(queryName string, processor *elastic.BulkProcessor) {
+	stats := processor.Stats()
+
+	var queued int64
+	for _, worker := range stats.Workers {
+		queued += worker.Queued
+	}
+
+	promMetrics.SetBulkStats(queryName, queued, stats.Committed, stats.Failed, stats.Indexed+stats.Created)
+}
@@ -0,0 +1,199 @@
+package elasticsearch
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"github.com/BenB196/crashplan-ffs-puller/config"
+	"github.com/olivere/elastic/v7"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+//defaultInitialBackoff and defaultMaxBackoff are used when retries are enabled without backoff times
+const defaultInitialBackoff = 100 * time.Millisecond
+const defaultMaxBackoff = 10 * time.Second
+
+/*
+BuildElasticURLs - gets the urls of an ffs query's elasticsearch cluster, either every configured elasticUrl or the url from the cloud id
+Returns
+[]string - the urls
+error - any errors which have been caught
+*/
+func BuildElasticURLs(elasticConfig config.Elasticsearch) ([]string, error) {
+	if elasticConfig.CloudID == "" {
+		return elasticConfig.ElasticURL, nil
+	}
+
+	elasticURL, err := decodeCloudID(elasticConfig.CloudID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return []string{elasticURL}, nil
+}
+
+/*
+decodeCloudID - gets the elasticsearch url from an Elastic Cloud ID
+A cloud id is <name>:<base64 of host$elasticsearch uuid$kibana uuid>, the host can have a port on the end
+*/
+func decodeCloudID(cloudID string) (string, error) {
+	parts := strings.SplitN(cloudID, ":", 2)
+	encoded := parts[len(parts)-1]
+
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+
+	if err != nil {
+		return "", errors.New("invalid elasticsearch cloud id: " + err.Error())
+	}
+
+	hosts := strings.Split(string(decoded), "$")
+	if len(hosts) < 2 || hosts[0] == "" || hosts[1] == "" {
+		return "", errors.New("invalid elasticsearch cloud id: missing host or elasticsearch id")
+	}
+
+	host := hosts[0]
+	port := "443"
+	if i := strings.LastIndex(host, ":"); i > -1 {
+		port = host[i+1:]
+		host = host[:i]
+	}
+
+	return "https://" + hosts[1] + "." + host + ":" + port, nil
+}
+
+//encodeAPIKey encodes an api key given as id:key, keys which are already encoded are returned as they are
+func encodeAPIKey(apiKey string) string {
+	if strings.Contains(apiKey, ":") {
+		return base64.StdEncoding.EncodeToString([]byte(apiKey))
+	}
+
+	return apiKey
+}
+
+/*
+BuildHttpClient - builds the http client used to reach elasticsearch or opensearch, with the ca bundle, client certificate, and verification options
+Returns
+*http.Client - the http client
+error - any errors which have been caught
+*/
+func BuildHttpClient(tlsConfig config.TLS) (*http.Client, error) {
+	if tlsConfig.CACert == "" && tlsConfig.ClientCert == "" && !tlsConfig.InsecureSkipVerify {
+		return http.DefaultClient, nil
+	}
+
+	clientTLSConfig := &tls.Config{
+		InsecureSkipVerify: tlsConfig.InsecureSkipVerify,
+	}
+
+	if tlsConfig.CACert != "" {
+		caCert, err := ioutil.ReadFile(tlsConfig.CACert)
+
+		if err != nil {
+			return nil, errors.New("error reading elasticsearch ca cert: " + err.Error())
+		}
+
+		certPool, err := x509.SystemCertPool()
+
+		if err != nil || certPool == nil {
+			certPool = x509.NewCertPool()
+		}
+
+		if !certPool.AppendCertsFromPEM(caCert) {
+			return nil, errors.New("error reading elasticsearch ca cert: no certificates found in " + tlsConfig.CACert)
+		}
+
+		clientTLSConfig.RootCAs = certPool
+	}
+
+	if tlsConfig.ClientCert != "" {
+		clientCert, err := tls.LoadX509KeyPair(tlsConfig.ClientCert, tlsConfig.ClientKey)
+
+		if err != nil {
+			return nil, errors.New("error reading elasticsearch client cert: " + err.Error())
+		}
+
+		clientTLSConfig.Certificates = []tls.Certificate{clientCert}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = clientTLSConfig
+
+	return &http.Client{Transport: transport}, nil
+}
+
+//buildHealthCheckOptions builds the client options for the health check, which are validated when the config is read
+func buildHealthCheckOptions(healthCheck config.HealthCheck) []elastic.ClientOptionFunc {
+	var options []elastic.ClientOptionFunc
+
+	if healthCheck.Enabled != nil {
+		options = append(options, elastic.SetHealthcheck(*healthCheck.Enabled))
+	}
+
+	if healthCheck.Interval != "" {
+		interval, _ := time.ParseDuration(healthCheck.Interval)
+		options = append(options, elastic.SetHealthcheckInterval(interval))
+	}
+
+	if healthCheck.Timeout != "" {
+		timeout, _ := time.ParseDuration(healthCheck.Timeout)
+		options = append(options, elastic.SetHealthcheckTimeout(timeout), elastic.SetHealthcheckTimeoutStartup(timeout))
+	}
+
+	return options
+}
+
+//retrier retries failed elasticsearch requests with an exponential backoff, up to a maximum number of retries
+type retrier struct {
+	maxRetries int
+	maxBackoff time.Duration
+	backoff    elastic.Backoff
+}
+
+/*
+BuildRetryBackoffs - gets the initial and maximum wait between retries of an ffs query from its retry options, which are validated when the config is read
+*/
+func BuildRetryBackoffs(retry config.Retry) (time.Duration, time.Duration) {
+	initialBackoff := defaultInitialBackoff
+	if retry.InitialBackoff != "" {
+		initialBackoff, _ = time.ParseDuration(retry.InitialBackoff)
+	}
+
+	maxBackoff := defaultMaxBackoff
+	if retry.MaxBackoff != "" {
+		maxBackoff, _ = time.ParseDuration(retry.MaxBackoff)
+	}
+
+	return initialBackoff, maxBackoff
+}
+
+//newRetrier builds the retrier of an ffs query from its retry options
+func newRetrier(retry config.Retry) *retrier {
+	initialBackoff, maxBackoff := BuildRetryBackoffs(retry)
+
+	return &retrier{
+		maxRetries: retry.MaxRetries,
+		maxBackoff: maxBackoff,
+		backoff:    elastic.NewExponentialBackoff(initialBackoff, maxBackoff),
+	}
+}
+
+func (r *retrier) Retry(ctx context.Context, retry int, req *http.Request, resp *http.Response, err error) (time.Duration, bool, error) {
+	if retry > r.maxRetries {
+		return 0, false, nil
+	}
+
+	wait, ok := r.backoff.Next(retry)
+
+	//the exponential backoff gives up once it reaches its maximum, keep retrying at the maximum instead
+	if !ok {
+		wait = r.maxBackoff
+	}
+
+	return wait, true, nil
+}
@@ -4,25 +4,53 @@ import (
 	"errors"
 	"github.com/BenB196/crashplan-ffs-puller/config"
 	"github.com/olivere/elastic/v7"
+	"net/http"
 	"strconv"
 	"time"
 )
 
+/*
+BuildElasticClient - builds the elastic client of an ffs query from its connection, auth, tls, health check, and retry options
+Returns
+*elastic.Client - the elastic client
+error - any errors which have been caught
+*/
 func BuildElasticClient(elasticConfig config.Elasticsearch) (*elastic.Client, error) {
-	client := &elastic.Client{}
-	var err error
+	urls, err := BuildElasticURLs(elasticConfig)
+
+	if err != nil {
+		return nil, errors.New("error: failed to create elasticsearch client: " + err.Error())
+	}
+
+	httpClient, err := BuildHttpClient(elasticConfig.TLS)
+
+	if err != nil {
+		return nil, errors.New("error: failed to create elasticsearch client: " + err.Error())
+	}
+
+	options := []elastic.ClientOptionFunc{
+		elastic.SetURL(urls...),
+		elastic.SetSniff(elasticConfig.Sniffing),
+		elastic.SetHttpClient(httpClient),
+		elastic.SetGzip(elasticConfig.Bulk.Gzip),
+	}
 
 	if elasticConfig.BasicAuth.User != "" {
-		client, err = elastic.NewClient(
-			elastic.SetURL(Balance(elasticConfig.ElasticURL)),
-			elastic.SetBasicAuth(elasticConfig.BasicAuth.User,elasticConfig.BasicAuth.Password),
-			elastic.SetSniff(elasticConfig.Sniffing))
-	} else {
-		client, err = elastic.NewClient(
-			elastic.SetURL(Balance(elasticConfig.ElasticURL)),
-			elastic.SetSniff(elasticConfig.Sniffing))
+		options = append(options, elastic.SetBasicAuth(elasticConfig.BasicAuth.User,elasticConfig.BasicAuth.Password))
+	} else if elasticConfig.APIKey != "" {
+		options = append(options, elastic.SetHeaders(http.Header{"Authorization": []string{"ApiKey " + encodeAPIKey(elasticConfig.APIKey)}}))
+	} else if elasticConfig.BearerToken != "" {
+		options = append(options, elastic.SetHeaders(http.Header{"Authorization": []string{"Bearer " + elasticConfig.BearerToken}}))
 	}
 
+	options = append(options, buildHealthCheckOptions(elasticConfig.HealthCheck)...)
+
+	if elasticConfig.Retry.MaxRetries > 0 {
+		options = append(options, elastic.SetRetrier(newRetrier(elasticConfig.Retry)))
+	}
+
+	client, err := elastic.NewClient(options...)
+
 	if err != nil {
 		return nil, errors.New("error: failed to create elasticsearch client: " + err.Error())
 	}
@@ -42,6 +70,31 @@ func BuildIndexName(elasticConfig config.Elasticsearch) string {
 	return indexName
 }
 
+/*
+BuildDataStreamName - builds the name of the data stream of an ffs query, following the <type>-<dataset>-<namespace> data stream naming scheme
+*/
+func BuildDataStreamName(elasticConfig config.Elasticsearch) string {
+	return "logs-code42.ffs-" + elasticConfig.DataStream.Namespace
+}
+
+/*
+NewBulkRequest - builds the bulk request which adds an event to an index, through the query's ingest pipeline if it has one
+Data streams only accept create requests
+*/
+func NewBulkRequest(elasticConfig config.Elasticsearch, indexName string, doc interface{}) elastic.BulkableRequest {
+	request := elastic.NewBulkIndexRequest().Index(indexName).Doc(doc)
+
+	if elasticConfig.DataStream.Enabled {
+		request = request.OpType("create")
+	}
+
+	if elasticConfig.Pipeline != "" {
+		request = request.Pipeline(elasticConfig.Pipeline)
+	}
+
+	return request
+}
+
 func BuildIndexNameWithTime(elasticConfig config.Elasticsearch, timeToAppend time.Time) string {
 	if elasticConfig.IndexTimeAppend == "" {
 		return elasticConfig.IndexName
@@ -52,14 +105,12 @@ func BuildIndexNameWithTime(elasticConfig config.Elasticsearch, timeToAppend tim
 	return indexName
 }
 
-func BuildIndexPattern(elasticConfig config.Elasticsearch) string {
-	var codec string
-	if elasticConfig.BestCompression {
-		codec = "    \"codec\": \"best_compression\","
-	} else {
-		codec = ""
-	}
-
+/*
+BuildIndexSettings - builds the index settings of an ffs query's indices
+Returns
+map[string]interface{} - the index settings
+*/
+func BuildIndexSettings(elasticConfig config.Elasticsearch) map[string]interface{} {
 	var refreshInterval string
 	if elasticConfig.RefreshInterval == 0 {
 		refreshInterval = "-1"
@@ -67,246 +118,82 @@ func BuildIndexPattern(elasticConfig config.Elasticsearch) string {
 		refreshInterval = strconv.Itoa(elasticConfig.RefreshInterval) + "s"
 	}
 
-	index := "{" +
-		"  \"settings\": {" +
-		codec +
-		"    \"refresh_interval\": \"" + refreshInterval + "\"," +
-		"    \"number_of_shards\": " + strconv.Itoa(elasticConfig.NumberOfShards) + "," +
-		"    \"number_of_replicas\": " + strconv.Itoa(elasticConfig.NumberOfReplicas) + "" +
-		"  }," +
-		"  \"mappings\": {" +
-		"    \"_source\": {" +
-		"      \"enabled\": true" +
-		"    }," +
-		"    \"properties\": {" +
-		"      \"eventId\": {" +
-		"        \"type\": \"keyword\"" +
-		"      }," +
-		"      \"eventType\": {" +
-		"        \"type\": \"keyword\"" +
-		"      }," +
-		"      \"eventTimestamp\": {" +
-		"        \"type\": \"date\"" +
-		"      }," +
-		"      \"insertionTimestamp\": {" +
-		"        \"type\": \"date\"" +
-		"      }," +
-		"      \"filePath\": {" +
-		"        \"type\": \"keyword\"" +
-		"      }," +
-		"      \"fileName\": {" +
-		"        \"type\": \"keyword\"" +
-		"      }," +
-		"      \"fileType\": {" +
-		"        \"type\": \"keyword\"" +
-		"      }," +
-		"      \"fileCategory\": {" +
-		"        \"type\": \"keyword\"" +
-		"      }," +
-		"      \"fileSize\": {" +
-		"        \"type\": \"long\"" +
-		"      }," +
-		"      \"fileOwner\": {" +
-		"        \"type\": \"keyword\"" +
-		"      }," +
-		"      \"md5Checksum\": {" +
-		"        \"type\": \"keyword\"" +
-		"      }," +
-		"      \"sha256Checksum\": {" +
-		"        \"type\": \"keyword\"" +
-		"      }," +
-		"      \"createdTimestamp\": {" +
-		"        \"type\": \"date\"" +
-		"      }," +
-		"      \"modifyTimestamp\": {" +
-		"        \"type\": \"date\"" +
-		"      }," +
-		"      \"deviceUsername\": {" +
-		"        \"type\": \"keyword\"" +
-		"      }," +
-		"      \"deviceUid\": {" +
-		"        \"type\": \"keyword\"" +
-		"      }," +
-		"      \"userUid\": {" +
-		"        \"type\": \"keyword\"" +
-		"      }," +
-		"      \"osHostname\": {" +
-		"        \"type\": \"keyword\"" +
-		"      }," +
-		"      \"domainName\": {" +
-		"        \"type\": \"keyword\"" +
-		"      }," +
-		"      \"publicIpAddress\": {" +
-		"        \"type\": \"keyword\"" +
-		"      }," +
-		"      \"privateIpAddresses\": {" +
-		"        \"type\": \"keyword\"" +
-		"      }," +
-		"      \"actor\": {" +
-		"        \"type\": \"keyword\"" +
-		"      }," +
-		"      \"directoryId\": {" +
-		"        \"type\": \"keyword\"" +
-		"      }," +
-		"      \"source\": {" +
-		"        \"type\": \"keyword\"" +
-		"      }," +
-		"      \"url\": {" +
-		"        \"type\": \"keyword\"" +
-		"      }," +
-		"      \"shared\": {" +
-		"        \"type\": \"keyword\"" +
-		"      }," +
-		"      \"sharedWith\": {" +
-		"        \"type\": \"keyword\"" +
-		"      }," +
-		"      \"sharingTypeAdded\": {" +
-		"        \"type\": \"keyword\"" +
-		"      }," +
-		"      \"cloudDriveId\": {" +
-		"        \"type\": \"keyword\"" +
-		"      }," +
-		"      \"detectionSourceAlias\": {" +
-		"        \"type\": \"keyword\"" +
-		"      }," +
-		"      \"fileId\": {" +
-		"        \"type\": \"keyword\"" +
-		"      }," +
-		"      \"exposure\": {" +
-		"        \"type\": \"keyword\"" +
-		"      }," +
-		"      \"processOwner\": {" +
-		"        \"type\": \"keyword\"" +
-		"      }," +
-		"      \"processName\": {" +
-		"        \"type\": \"keyword\"" +
-		"      }," +
-		"      \"removableMediaVendor\": {" +
-		"        \"type\": \"keyword\"" +
-		"      }," +
-		"      \"removableMediaName\": {" +
-		"        \"type\": \"keyword\"" +
-		"      }," +
-		"      \"removableMediaSerialNumber\": {" +
-		"        \"type\": \"keyword\"" +
-		"      }," +
-		"      \"removableMediaCapacity\": {" +
-		"        \"type\": \"long\"" +
-		"      }," +
-		"      \"removableMediaBusType\": {" +
-		"        \"type\": \"keyword\"" +
-		"      }," +
-		"      \"removableMediaMediaName\": {" +
-		"        \"type\": \"keyword\"" +
-		"      }," +
-		"      \"removableMediaVolumeName\": {" +
-		"        \"type\": \"keyword\"" +
-		"      }," +
-		"      \"removableMediaPartitionId\": {" +
-		"        \"type\": \"keyword\"" +
-		"      }," +
-		"      \"syncDestination\": {" +
-		"        \"type\": \"keyword\"" +
-		"      }," +
-		"      \"status\": {" +
-		"        \"type\": \"keyword\"" +
-		"      }," +
-		"      \"message\": {" +
-		"        \"type\": \"keyword\"" +
-		"      }," +
-		"      \"continent\": {" +
-		"        \"type\": \"keyword\"" +
-		"      }," +
-		"      \"continentCode\": {" +
-		"        \"type\": \"keyword\"" +
-		"      }," +
-		"      \"country\": {" +
-		"        \"type\": \"keyword\"" +
-		"      }," +
-		"      \"countryCode\": {" +
-		"        \"type\": \"keyword\"" +
-		"      }," +
-		"      \"region\": {" +
-		"        \"type\": \"keyword\"" +
-		"      }," +
-		"      \"regionName\": {" +
-		"        \"type\": \"keyword\"" +
-		"      }," +
-		"      \"city\": {" +
-		"        \"type\": \"keyword\"" +
-		"      }," +
-		"      \"district\": {" +
-		"        \"type\": \"keyword\"" +
-		"      }," +
-		"      \"zip\": {" +
-		"        \"type\": \"keyword\"" +
-		"      }," +
-		"      \"lat\": {" +
-		"        \"type\": \"float\"" +
-		"      }," +
-		"      \"lon\": {" +
-		"        \"type\": \"float\"" +
-		"      }," +
-		"      \"timezone\": {" +
-		"        \"type\": \"keyword\"" +
-		"      }," +
-		"      \"currency\": {" +
-		"        \"type\": \"keyword\"" +
-		"      }," +
-		"      \"isp\": {" +
-		"        \"type\": \"keyword\"" +
-		"      }," +
-		"      \"org\": {" +
-		"        \"type\": \"keyword\"" +
-		"      }," +
-		"      \"as\": {" +
-		"        \"type\": \"keyword\"" +
-		"      }," +
-		"      \"asname\": {" +
-		"        \"type\": \"keyword\"" +
-		"      }," +
-		"      \"reverse\": {" +
-		"        \"type\": \"keyword\"" +
-		"      }," +
-		"      \"mobile\": {" +
-		"        \"type\": \"boolean\"" +
-		"      }," +
-		"      \"proxy\": {" +
-		"        \"type\": \"boolean\"" +
-		"      }," +
-		"      \"query\": {" +
-		"        \"type\": \"keyword\"" +
-		"      }," +
-		"      \"geoPoint\": {" +
-		"        \"type\": \"geo_point\"" +
-		"      }" +
-		"    }" +
-		"  }," +
-		"  \"aliases\": {" + buildAliasString(elasticConfig.Aliases) + "}" +
-		"}"
-	return index
+	settings := map[string]interface{}{
+		"refresh_interval":   refreshInterval,
+		"number_of_shards":   elasticConfig.NumberOfShards,
+		"number_of_replicas": elasticConfig.NumberOfReplicas,
+	}
+
+	if elasticConfig.BestCompression {
+		settings["codec"] = "best_compression"
+	}
+
+	//rolled over indices are written to through the index name as an alias, data streams roll over on their own
+	if elasticConfig.ILM.Enabled {
+		settings["index.lifecycle.name"] = elasticConfig.ILM.PolicyName
+		if !elasticConfig.DataStream.Enabled {
+			settings["index.lifecycle.rollover_alias"] = elasticConfig.IndexName
+		}
+	}
+
+	//ism policies attach themselves to new indices through their ism_template, so only the rollover alias is set
+	if elasticConfig.ISM.Enabled {
+		settings["plugins.index_state_management.rollover_alias"] = elasticConfig.IndexName
+	}
+
+	return settings
 }
 
-func buildAliasString(aliases []string) string {
-	if len(aliases) <= 0 {
-		return ""
+/*
+BuildIndexMappings - builds the index mappings of an ffs query's indices, generated from the fields of the events it outputs
+esStandardized - the format of the events, ecs or "" for the raw ffs events
+Returns
+map[string]interface{} - the index mappings
+error - an error if a field of the events has no mapping
+*/
+func BuildIndexMappings(esStandardized string) (map[string]interface{}, error) {
+	properties, err := generateEventProperties(esStandardized)
+
+	if err != nil {
+		return nil, err
+	}
+
+	mappings := map[string]interface{}{
+		"_source": map[string]interface{}{
+			"enabled": true,
+		},
+		"properties": properties,
 	}
 
-	var aliasString string
-
-	for i, alias := range aliases {
-		if i == 0 {
-			if len(aliases) == 1 {
-				aliasString = "\"" + alias + "\": {}"
-			} else {
-				aliasString = "\"" + alias + "\": {},"
-			}
-		} else if i == (len(aliases) -1) {
-			aliasString = aliasString + "\"" + alias + "\": {}"
-		} else {
-			aliasString = aliasString + "\"" + alias + "\": {},"
+	//fields which are not part of the events, ex: added by an ingest pipeline
+	if esStandardized == "ecs" {
+		mappings["dynamic_templates"] = []interface{}{
+			map[string]interface{}{
+				"strings_as_keyword": map[string]interface{}{
+					"match_mapping_type": "string",
+					"mapping": map[string]interface{}{
+						"type":         "keyword",
+						"ignore_above": keywordIgnoreAbove,
+					},
+				},
+			},
 		}
 	}
 
-	return aliasString
+	return mappings, nil
+}
+
+/*
+BuildIndexAliases - builds the aliases which are added to an ffs query's indices
+Returns
+map[string]interface{} - the aliases
+*/
+func BuildIndexAliases(elasticConfig config.Elasticsearch) map[string]interface{} {
+	aliases := map[string]interface{}{}
+
+	for _, alias := range elasticConfig.Aliases {
+		aliases[alias] = map[string]interface{}{}
+	}
+
+	return aliases
 }
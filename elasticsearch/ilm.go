@@ -0,0 +1,156 @@
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/BenB196/crashplan-ffs-puller/config"
+	"github.com/olivere/elastic/v7"
+	"log"
+	"net/http"
+	"net/url"
+)
+
+//firstRolloverIndex is the suffix of the first index behind an ilm or ism write alias, rollover increments it
+const firstRolloverIndex = "-000001"
+
+/*
+BuildLifecyclePolicy - builds the ilm policy of an ffs query from its hot, warm, and delete phases
+Returns
+map[string]interface{} - the policy body
+*/
+func BuildLifecyclePolicy(ilm config.ILM) map[string]interface{} {
+	rollover := map[string]interface{}{}
+	if ilm.Hot.RolloverMaxSize != "" {
+		rollover["max_size"] = ilm.Hot.RolloverMaxSize
+	}
+	if ilm.Hot.RolloverMaxAge != "" {
+		rollover["max_age"] = ilm.Hot.RolloverMaxAge
+	}
+
+	phases := map[string]interface{}{
+		"hot": map[string]interface{}{
+			"actions": map[string]interface{}{
+				"rollover": rollover,
+			},
+		},
+	}
+
+	if ilm.Warm.MinAge != "" {
+		actions := map[string]interface{}{}
+		if ilm.Warm.NumberOfReplicas != nil {
+			actions["allocate"] = map[string]interface{}{
+				"number_of_replicas": *ilm.Warm.NumberOfReplicas,
+			}
+		}
+		if ilm.Warm.ShrinkShards > 0 {
+			actions["shrink"] = map[string]interface{}{
+				"number_of_shards": ilm.Warm.ShrinkShards,
+			}
+		}
+		if ilm.Warm.ForceMergeSegments > 0 {
+			actions["forcemerge"] = map[string]interface{}{
+				"max_num_segments": ilm.Warm.ForceMergeSegments,
+			}
+		}
+
+		phases["warm"] = map[string]interface{}{
+			"min_age": ilm.Warm.MinAge,
+			"actions": actions,
+		}
+	}
+
+	if ilm.Delete.MinAge != "" {
+		phases["delete"] = map[string]interface{}{
+			"min_age": ilm.Delete.MinAge,
+			"actions": map[string]interface{}{
+				"delete": map[string]interface{}{},
+			},
+		}
+	}
+
+	return map[string]interface{}{
+		"policy": map[string]interface{}{
+			"phases": phases,
+		},
+	}
+}
+
+/*
+InstallLifecyclePolicy - creates or updates the ilm policy of an ffs query
+Returns
+error - any errors which have been caught
+*/
+func InstallLifecyclePolicy(client *elastic.Client, ctx context.Context, elasticConfig config.Elasticsearch) error {
+	_, err := client.XPackIlmPutLifecycle().Policy(elasticConfig.ILM.PolicyName).BodyJson(BuildLifecyclePolicy(elasticConfig.ILM)).Do(ctx)
+
+	if err != nil {
+		return errors.New("error installing elasticsearch ilm policy: " + elasticConfig.ILM.PolicyName + ", " + err.Error())
+	}
+
+	return nil
+}
+
+/*
+BootstrapWriteAlias - creates the first index behind the ilm or ism write alias of an ffs query, if the alias does not exist yet
+The index gets its settings, including the lifecycle policy, from the query's index template
+Returns
+error - any errors which have been caught
+*/
+func BootstrapWriteAlias(transport Transport, ctx context.Context, elasticConfig config.Elasticsearch) error {
+	alias := elasticConfig.IndexName
+
+	statusCode, _, err := transport.PerformRequest(ctx, http.MethodHead, "/_alias/"+url.PathEscape(alias), nil, http.StatusNotFound)
+
+	if err != nil {
+		return errors.New("error checking write alias: " + alias + ", " + err.Error())
+	}
+
+	if statusCode == http.StatusOK {
+		return nil
+	}
+
+	//an index with the same name as the alias would be written to directly and never rolled over
+	statusCode, _, err = transport.PerformRequest(ctx, http.MethodHead, "/"+url.PathEscape(alias), nil, http.StatusNotFound)
+
+	if err != nil {
+		return errors.New("error checking write alias: " + alias + ", " + err.Error())
+	}
+
+	if statusCode == http.StatusOK {
+		return errors.New("error: an index named: " + alias + " already exists, rollover needs this name for its write alias")
+	}
+
+	indexName := alias + firstRolloverIndex
+	log.Println("bootstrapping write alias: " + alias + " on index: " + indexName)
+
+	_, responseBody, err := transport.PerformRequest(ctx, http.MethodPut, "/"+url.PathEscape(indexName), map[string]interface{}{
+		"aliases": map[string]interface{}{
+			alias: map[string]interface{}{
+				"is_write_index": true,
+			},
+		},
+	})
+
+	if err != nil {
+		return errors.New("error creating index: " + indexName + ", " + err.Error())
+	}
+
+	var createIndex struct {
+		Acknowledged bool `json:"acknowledged"`
+	}
+	_ = json.Unmarshal(responseBody, &createIndex)
+
+	if !createIndex.Acknowledged {
+		return errors.New("index creation failed for: " + indexName)
+	}
+
+	return nil
+}
+
+/*
+UsesWriteAlias - checks if an ffs query writes to its index name as an ilm or ism write alias instead of time appended index names
+*/
+func UsesWriteAlias(elasticConfig config.Elasticsearch) bool {
+	return (elasticConfig.ILM.Enabled || elasticConfig.ISM.Enabled) && !elasticConfig.DataStream.Enabled
+}
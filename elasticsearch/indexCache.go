@@ -0,0 +1,142 @@
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/BenB196/crashplan-ffs-puller/config"
+	"github.com/BenB196/crashplan-ffs-puller/promMetrics"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+/*
+IndexCache remembers which indices of an ffs query are known to exist, so that windows do not have to ask elasticsearch before every bulk request
+Entries expire after the TTL, so indices which are deleted (ex: by ilm) are created again through the template
+*/
+type IndexCache struct {
+	queryName string
+	ttl       time.Duration
+	mutex     sync.Mutex
+	known     map[string]time.Time
+	//locks stops two windows from checking and creating the same index at once
+	locks map[string]*sync.Mutex
+}
+
+//sharedIndexCaches holds the index cache of each ffs query
+var sharedIndexCaches = struct {
+	mutex  sync.Mutex
+	caches map[string]*IndexCache
+}{caches: map[string]*IndexCache{}}
+
+/*
+GetIndexCache - gets the index cache of an ffs query, creating it on first use
+*/
+func GetIndexCache(queryName string, elasticConfig config.Elasticsearch) *IndexCache {
+	sharedIndexCaches.mutex.Lock()
+	defer sharedIndexCaches.mutex.Unlock()
+
+	cache, found := sharedIndexCaches.caches[queryName]
+	if !found {
+		//validated when the config is read
+		ttl, _ := time.ParseDuration(elasticConfig.IndexCacheTTL)
+
+		cache = &IndexCache{
+			queryName: queryName,
+			ttl:       ttl,
+			known:     map[string]time.Time{},
+			locks:     map[string]*sync.Mutex{},
+		}
+		sharedIndexCaches.caches[queryName] = cache
+	}
+
+	return cache
+}
+
+/*
+EnsureIndex - makes sure an index exists, creating it if it does not
+The index gets its settings, mappings, and aliases from the query's index template
+Returns
+error - any errors which have been caught
+*/
+func (cache *IndexCache) EnsureIndex(transport Transport, ctx context.Context, indexName string) error {
+	cache.mutex.Lock()
+	if cache.isKnown(indexName) {
+		cache.mutex.Unlock()
+		return nil
+	}
+	lock, found := cache.locks[indexName]
+	if !found {
+		lock = &sync.Mutex{}
+		cache.locks[indexName] = lock
+	}
+	cache.mutex.Unlock()
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	//another window may have created the index while this one was waiting
+	cache.mutex.Lock()
+	known := cache.isKnown(indexName)
+	cache.mutex.Unlock()
+	if known {
+		return nil
+	}
+
+	path := "/" + url.PathEscape(indexName)
+
+	statusCode, _, err := transport.PerformRequest(ctx, http.MethodHead, path, nil, http.StatusNotFound)
+
+	if err != nil {
+		return errors.New("error checking if index exists: " + indexName + ", " + err.Error())
+	}
+
+	if statusCode == http.StatusNotFound {
+		statusCode, responseBody, err := transport.PerformRequest(ctx, http.MethodPut, path, nil, http.StatusBadRequest)
+
+		if err != nil {
+			return errors.New("error creating index: " + indexName + ", " + err.Error())
+		}
+
+		//another instance of the puller may have created the index first
+		if statusCode == http.StatusBadRequest && errorType(responseBody) != "resource_already_exists_exception" {
+			return errors.New("error creating index: " + indexName + ", " + string(responseBody))
+		}
+
+		if statusCode != http.StatusBadRequest {
+			var createIndex struct {
+				Acknowledged bool `json:"acknowledged"`
+			}
+			_ = json.Unmarshal(responseBody, &createIndex)
+
+			if !createIndex.Acknowledged {
+				return errors.New("index creation failed for: " + indexName)
+			}
+
+			promMetrics.IncrementIndicesCreated(cache.queryName)
+		}
+	}
+
+	cache.mutex.Lock()
+	cache.known[indexName] = time.Now().Add(cache.ttl)
+	cache.mutex.Unlock()
+
+	return nil
+}
+
+//isKnown checks if an index is known to exist and its entry has not expired, must be called with the mutex held
+func (cache *IndexCache) isKnown(indexName string) bool {
+	expires, found := cache.known[indexName]
+	if !found {
+		return false
+	}
+
+	if time.Now().After(expires) {
+		delete(cache.known, indexName)
+		return false
+	}
+
+	return true
+}
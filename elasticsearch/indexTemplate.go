@@ -0,0 +1,218 @@
+package elasticsearch
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/BenB196/crashplan-ffs-puller/config"
+	"log"
+	"net/http"
+	"net/url"
+)
+
+//templateVersion is increased whenever the templates built by the puller change
+const templateVersion = 1
+
+//templatePriority is above the built in logs-*-* and metrics-*-* templates, so the query's template wins
+const templatePriority = 200
+
+//templateManager is stored in the _meta of every template the puller installs
+const templateManager = "crashplan-ffs-puller"
+
+//managedTemplate is a component or index template which is installed by the puller
+type managedTemplate struct {
+	name string
+	//path of the template API, _component_template or _index_template
+	api  string
+	body map[string]interface{}
+}
+
+/*
+InstallIndexTemplates - installs the composable index template of an ffs query, along with the component templates which it is composed of
+Templates which are already installed are only replaced if they have drifted from what the puller would install
+esStandardized - the format of the events, ecs or "" for the raw ffs events
+Returns
+error - any errors which have been caught
+*/
+func InstallIndexTemplates(transport Transport, ctx context.Context, elasticConfig config.Elasticsearch, esStandardized string) error {
+	templates, err := buildIndexTemplates(elasticConfig, esStandardized)
+
+	if err != nil {
+		return err
+	}
+
+	for _, template := range templates {
+		err := installTemplate(transport, ctx, template)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+buildIndexTemplates - builds the settings and mappings component templates and the index template of an ffs query
+The index template matches the index name and any time appended index names, ex: crashplan and crashplan-*, or just the data stream
+*/
+func buildIndexTemplates(elasticConfig config.Elasticsearch, esStandardized string) ([]managedTemplate, error) {
+	name := elasticConfig.IndexName
+	indexPatterns := []string{elasticConfig.IndexName, elasticConfig.IndexName + "-*"}
+	if elasticConfig.DataStream.Enabled {
+		name = BuildDataStreamName(elasticConfig)
+		indexPatterns = []string{name}
+	}
+
+	settingsName := name + "-settings"
+	mappingsName := name + "-mappings"
+
+	mappings, err := BuildIndexMappings(esStandardized)
+
+	if err != nil {
+		return nil, err
+	}
+
+	indexTemplate := map[string]interface{}{
+		"index_patterns": indexPatterns,
+		"composed_of":    []string{settingsName, mappingsName},
+		"priority":       templatePriority,
+	}
+
+	if elasticConfig.DataStream.Enabled {
+		//the data stream fields are constant for every event, so they are not stored in each one
+		mappings["properties"].(map[string]interface{})["data_stream"] = map[string]interface{}{
+			"properties": map[string]interface{}{
+				"type":      map[string]interface{}{"type": "constant_keyword", "value": "logs"},
+				"dataset":   map[string]interface{}{"type": "constant_keyword", "value": "code42.ffs"},
+				"namespace": map[string]interface{}{"type": "constant_keyword", "value": elasticConfig.DataStream.Namespace},
+			},
+		}
+		indexTemplate["data_stream"] = map[string]interface{}{}
+	} else {
+		indexTemplate["template"] = map[string]interface{}{
+			"aliases": BuildIndexAliases(elasticConfig),
+		}
+	}
+
+	return []managedTemplate{
+		newManagedTemplate(settingsName, "_component_template", map[string]interface{}{
+			"template": map[string]interface{}{
+				"settings": BuildIndexSettings(elasticConfig),
+			},
+		}),
+		newManagedTemplate(mappingsName, "_component_template", map[string]interface{}{
+			"template": map[string]interface{}{
+				"mappings": mappings,
+			},
+		}),
+		newManagedTemplate(name, "_index_template", indexTemplate),
+	}, nil
+}
+
+//newManagedTemplate adds the version and the _meta used for drift detection to a template body
+func newManagedTemplate(name string, api string, body map[string]interface{}) managedTemplate {
+	body["version"] = templateVersion
+	body["_meta"] = map[string]interface{}{
+		"managed_by": templateManager,
+		"hash":       templateHash(body),
+	}
+
+	return managedTemplate{
+		name: name,
+		api:  api,
+		body: body,
+	}
+}
+
+//templateHash hashes a template body, before its _meta has been added
+func templateHash(body map[string]interface{}) string {
+	//maps are marshalled with sorted keys, so the same template always has the same hash
+	bodyBytes, _ := json.Marshal(body)
+	hash := sha256.Sum256(bodyBytes)
+	return hex.EncodeToString(hash[:])
+}
+
+//installTemplate puts a template if it is missing or its hash differs from the installed one
+func installTemplate(transport Transport, ctx context.Context, template managedTemplate) error {
+	path := "/" + template.api + "/" + url.PathEscape(template.name)
+
+	installedHash, found, err := getInstalledTemplateHash(transport, ctx, template)
+
+	if err != nil {
+		return errors.New("error getting index template: " + template.name + ", " + err.Error())
+	}
+
+	hash := template.body["_meta"].(map[string]interface{})["hash"].(string)
+	if found && installedHash == hash {
+		return nil
+	}
+
+	if found {
+		log.Println("index template: " + template.name + " has drifted from the version the puller installs, reinstalling. Existing indices keep their settings and mappings until they are next created.")
+	} else {
+		log.Println("installing index template: " + template.name)
+	}
+
+	_, _, err = transport.PerformRequest(ctx, http.MethodPut, path, template.body)
+
+	if err != nil {
+		return errors.New("error installing index template: " + template.name + ", " + err.Error())
+	}
+
+	return nil
+}
+
+/*
+getInstalledTemplateHash - gets the hash from the _meta of an installed template
+Returns
+string - the hash, empty if the template was not installed by the puller
+bool - whether the template is installed
+error - any errors which have been caught
+*/
+func getInstalledTemplateHash(transport Transport, ctx context.Context, template managedTemplate) (string, bool, error) {
+	statusCode, responseBody, err := transport.PerformRequest(ctx, http.MethodGet, "/"+template.api+"/"+url.PathEscape(template.name), nil, http.StatusNotFound)
+
+	if err != nil {
+		return "", false, err
+	}
+
+	if statusCode == http.StatusNotFound {
+		return "", false, nil
+	}
+
+	//both template APIs return a list of {name, component_template/index_template}
+	var templates map[string][]map[string]json.RawMessage
+	err = json.Unmarshal(responseBody, &templates)
+
+	if err != nil {
+		return "", false, err
+	}
+
+	for _, installed := range templates {
+		for _, installedTemplate := range installed {
+			for key, body := range installedTemplate {
+				if key == "name" {
+					continue
+				}
+
+				var installedBody struct {
+					Meta struct {
+						Hash string `json:"hash"`
+					} `json:"_meta"`
+				}
+				err = json.Unmarshal(body, &installedBody)
+
+				if err != nil {
+					return "", false, err
+				}
+
+				return installedBody.Meta.Hash, true, nil
+			}
+		}
+	}
+
+	return "", false, nil
+}
@@ -0,0 +1,148 @@
+package elasticsearch
+
+import (
+	"errors"
+	"github.com/BenB196/crashplan-ffs-puller/eventOutput"
+	"reflect"
+	"strings"
+	"time"
+)
+
+//keywordIgnoreAbove stops long strings from being indexed as keywords, a keyword longer than 32766 bytes would fail the whole event
+const keywordIgnoreAbove = 1024
+
+/*
+Field types which cannot be told from the Go type of a field, by the dotted json name of the field
+The raw ffs timestamps are strings, and geo points are structs of lat and lon
+*/
+var rawFieldTypeOverrides = map[string]string{
+	"eventTimestamp":     "date",
+	"insertionTimestamp": "date",
+	"createTimestamp":    "date",
+	"modifyTimestamp":    "date",
+	"geoPoint":           "geo_point",
+}
+
+var ecsFieldTypeOverrides = map[string]string{
+	"host.geo.location": "geo_point",
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+/*
+generateProperties - generates the mapping properties of an event type from its fields and their json names
+Pointers and slices are mapped as the type they point to or contain, and structs are mapped as objects, or inlined if they are embedded
+Returns
+map[string]interface{} - the mapping properties
+error - an error naming the field if a field has a type with no mapping, ex: a map or an interface
+*/
+func generateProperties(eventType reflect.Type, overrides map[string]string) (map[string]interface{}, error) {
+	properties := map[string]interface{}{}
+
+	err := addProperties(properties, eventType, "", overrides)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return properties, nil
+}
+
+//addProperties adds the mapping of every field of a struct to properties, prefix is the dotted json name of the struct
+func addProperties(properties map[string]interface{}, structType reflect.Type, prefix string, overrides map[string]string) error {
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+
+		fieldType := elementType(field.Type)
+
+		//embedded structs without a json name have their fields inlined, like encoding/json does
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+			err := addProperties(properties, fieldType, prefix, overrides)
+
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		//unexported fields are not marshalled
+		if field.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		mapping, err := fieldMapping(fieldType, prefix+name, overrides)
+
+		if err != nil {
+			return err
+		}
+
+		properties[name] = mapping
+	}
+
+	return nil
+}
+
+//fieldMapping builds the mapping of a single field
+func fieldMapping(fieldType reflect.Type, path string, overrides map[string]string) (map[string]interface{}, error) {
+	if override, found := overrides[path]; found {
+		return map[string]interface{}{"type": override}, nil
+	}
+
+	if fieldType == timeType {
+		return map[string]interface{}{"type": "date"}, nil
+	}
+
+	switch fieldType.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "keyword", "ignore_above": keywordIgnoreAbove}, nil
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "long"}, nil
+	case reflect.Float32:
+		return map[string]interface{}{"type": "float"}, nil
+	case reflect.Float64:
+		return map[string]interface{}{"type": "double"}, nil
+	case reflect.Struct:
+		properties := map[string]interface{}{}
+		err := addProperties(properties, fieldType, path+".", overrides)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return map[string]interface{}{"properties": properties}, nil
+	default:
+		return nil, errors.New("error: no index mapping for field: " + path + " of type: " + fieldType.String() + ", add it to the field type overrides")
+	}
+}
+
+//elementType gets the type a pointer points to or a slice contains, arrays of values are mapped as the value
+func elementType(fieldType reflect.Type) reflect.Type {
+	for fieldType.Kind() == reflect.Ptr || fieldType.Kind() == reflect.Slice || fieldType.Kind() == reflect.Array {
+		fieldType = fieldType.Elem()
+	}
+
+	return fieldType
+}
+
+/*
+generateEventProperties - generates the mapping properties of the events an ffs query outputs
+esStandardized - the format of the events, ecs or "" for the raw ffs events
+*/
+func generateEventProperties(esStandardized string) (map[string]interface{}, error) {
+	if esStandardized == "ecs" {
+		return generateProperties(reflect.TypeOf(eventOutput.ElasticFileEvent{}), ecsFieldTypeOverrides)
+	}
+
+	return generateProperties(reflect.TypeOf(eventOutput.FFSEvent{}), rawFieldTypeOverrides)
+}
@@ -0,0 +1,164 @@
+package elasticsearch
+
+import (
+	"github.com/BenB196/crashplan-ffs-puller/eventOutput"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+//checkMapped walks the exported fields of a struct, the way encoding/json marshals them, and fails for any without a mapping type
+func checkMapped(t *testing.T, structType reflect.Type, properties map[string]interface{}, prefix string) {
+	t.Helper()
+
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+
+		fieldType := elementType(field.Type)
+
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+			checkMapped(t, fieldType, properties, prefix)
+			continue
+		}
+
+		if field.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		mapping, found := properties[name].(map[string]interface{})
+		if !found {
+			t.Errorf("field %s%s has no mapping", prefix, name)
+			continue
+		}
+
+		if subProperties, isObject := mapping["properties"].(map[string]interface{}); isObject && fieldType.Kind() == reflect.Struct && fieldType != timeType {
+			checkMapped(t, fieldType, subProperties, prefix+name+".")
+			continue
+		}
+
+		if mappingType, _ := mapping["type"].(string); mappingType == "" {
+			t.Errorf("field %s%s is mapped without a type: %v", prefix, name, mapping)
+		}
+	}
+}
+
+func TestGenerateEventProperties(t *testing.T) {
+	tests := []struct {
+		esStandardized string
+		eventType      reflect.Type
+		//dotted field names whose mapping type cannot be told from the Go type
+		wantTypes map[string]string
+	}{
+		{
+			esStandardized: "",
+			eventType:      reflect.TypeOf(eventOutput.FFSEvent{}),
+			wantTypes: map[string]string{
+				"eventTimestamp":     "date",
+				"insertionTimestamp": "date",
+			},
+		},
+		{
+			esStandardized: "ecs",
+			eventType:      reflect.TypeOf(eventOutput.ElasticFileEvent{}),
+			wantTypes: map[string]string{
+				"host.geo.location": "geo_point",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.eventType.Name(), func(t *testing.T) {
+			properties, err := generateEventProperties(test.esStandardized)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			checkMapped(t, test.eventType, properties, "")
+
+			for path, wantType := range test.wantTypes {
+				mapping := map[string]interface{}{"properties": properties}
+				for _, name := range strings.Split(path, ".") {
+					mapping, _ = mapping["properties"].(map[string]interface{})[name].(map[string]interface{})
+				}
+
+				if mapping["type"] != wantType {
+					t.Errorf("%s is mapped as %v, want %s", path, mapping["type"], wantType)
+				}
+			}
+		})
+	}
+}
+
+func TestGeneratePropertiesUnmappableFields(t *testing.T) {
+	type withMap struct {
+		Labels map[string]string `json:"labels"`
+	}
+	type withInterface struct {
+		Nested struct {
+			Value interface{} `json:"value"`
+		} `json:"nested"`
+	}
+
+	tests := []struct {
+		eventType reflect.Type
+		wantPath  string
+	}{
+		{eventType: reflect.TypeOf(withMap{}), wantPath: "labels"},
+		{eventType: reflect.TypeOf(withInterface{}), wantPath: "nested.value"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.wantPath, func(t *testing.T) {
+			_, err := generateProperties(test.eventType, nil)
+
+			if err == nil || !strings.Contains(err.Error(), "field: "+test.wantPath+" ") {
+				t.Errorf("error = %v, want one naming field %s", err, test.wantPath)
+			}
+		})
+	}
+}
+
+func TestGeneratePropertiesFieldTypes(t *testing.T) {
+	type embedded struct {
+		Inlined string `json:"inlined"`
+	}
+	type event struct {
+		embedded
+		Name     string   `json:"name"`
+		Tags     []string `json:"tags"`
+		Size     *int64   `json:"size"`
+		Ratio    float64  `json:"ratio"`
+		Flag     bool     `json:"flag"`
+		Skipped  string   `json:"-"`
+		unmarked string
+		Untagged int
+	}
+
+	properties, err := generateProperties(reflect.TypeOf(event{}), map[string]string{"name": "text"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{"inlined": "keyword", "name": "text", "tags": "keyword", "size": "long", "ratio": "double", "flag": "boolean", "Untagged": "long"}
+
+	if len(properties) != len(want) {
+		t.Errorf("properties = %v, want only %v", properties, want)
+	}
+
+	for name, wantType := range want {
+		if mapping, _ := properties[name].(map[string]interface{}); mapping["type"] != wantType {
+			t.Errorf("%s is mapped as %v, want %s", name, mapping["type"], wantType)
+		}
+	}
+}
@@ -0,0 +1,522 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/BenB196/crashplan-ffs-puller/config"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//migrationScroll is how long a scroll is kept open between batches
+const migrationScroll = "5m"
+
+//migratedIndexInfix is added to the names of the indices created by a migration, ex: crashplan-2020-01-01-migrated-20200201150405
+const migratedIndexInfix = "-migrated-"
+
+/*
+Transform changes an event read from an old index into the shape of the new mapping
+Returning nil drops the event
+*/
+type Transform func(doc map[string]interface{}) (map[string]interface{}, error)
+
+/*
+Transforms are the transforms which can be run by the migrate-index command, by name
+To migrate to a new shape, add a transform here and run the command with its name
+*/
+var Transforms = map[string]Transform{
+	//copies events as they are, so that they are indexed with the current mapping
+	"none": func(doc map[string]interface{}) (map[string]interface{}, error) {
+		return doc, nil
+	},
+	//adds the geo point from the lat and lon of events written before the geo point was added
+	"geo-location": geoLocationTransform,
+}
+
+//MigrateOptions are the options of the migrate-index command
+type MigrateOptions struct {
+	//Start and End are the range of index times to migrate, inclusive
+	Start     time.Time
+	End       time.Time
+	Transform string
+	BatchSize int
+	//DryRun only logs which indices would be migrated
+	DryRun bool
+}
+
+//migration is a time appended index name, and the index which currently holds its events
+type migration struct {
+	name        string
+	sourceIndex string
+}
+
+/*
+MigrateIndices - reindexes the time appended indices of an ffs query in a time range into new indices through a transform
+The query's templates are installed first, so the new indices get the current settings and mappings
+Once an index has been copied and its document count checked, the index is removed and its name is added to the new index as an alias in one atomic request, so searches never see both or neither
+esStandardized - the format of the events, ecs or "" for the raw ffs events
+Returns
+error - any errors which have been caught
+*/
+func MigrateIndices(transport Transport, ctx context.Context, elasticConfig config.Elasticsearch, esStandardized string, options MigrateOptions) error {
+	if elasticConfig.IndexTimeAppend == "" || elasticConfig.DataStream.Enabled || UsesWriteAlias(elasticConfig) {
+		return errors.New("error: migrate-index only supports time appended indices, not data streams or rolled over indices")
+	}
+
+	transform, found := Transforms[options.Transform]
+	if !found {
+		var names []string
+		for name := range Transforms {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return errors.New("error: unknown transform: " + options.Transform + ", must be one of: " + strings.Join(names, ", "))
+	}
+
+	if options.BatchSize < 1 {
+		return errors.New("error: migrate-index batch size must be at least 1")
+	}
+
+	if options.End.Before(options.Start) {
+		return errors.New("error: migrate-index start must be before its end")
+	}
+
+	migrations, err := findMigrations(transport, ctx, elasticConfig, options.Start, options.End)
+
+	if err != nil {
+		return err
+	}
+
+	//the index for the current time is still being written to by the query, so its events cannot all be copied yet
+	currentIndex := elasticConfig.IndexName + "-" + time.Now().UTC().Format(elasticConfig.IndexTimeAppend)
+	for i, indexMigration := range migrations {
+		if indexMigration.name == currentIndex {
+			log.Println("skipping: " + currentIndex + ", it is the current index of the query and is still being written to")
+			migrations = append(migrations[:i], migrations[i+1:]...)
+			break
+		}
+	}
+
+	log.Println("migrating " + strconv.Itoa(len(migrations)) + " indices with transform: " + options.Transform)
+
+	if options.DryRun {
+		for _, indexMigration := range migrations {
+			log.Println("would migrate: " + indexMigration.name + " from index: " + indexMigration.sourceIndex)
+		}
+		return nil
+	}
+
+	if !elasticConfig.UseCustomIndexPattern {
+		err = InstallIndexTemplates(transport, ctx, elasticConfig, esStandardized)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	stamp := time.Now().UTC().Format("20060102150405")
+	for _, indexMigration := range migrations {
+		err = migrateIndex(transport, ctx, indexMigration, indexMigration.name+migratedIndexInfix+stamp, transform, options.BatchSize)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+findMigrations - finds the indices of an ffs query whose time is in the range
+Names which were migrated before are aliases of their migrated index, which is then the source
+*/
+func findMigrations(transport Transport, ctx context.Context, elasticConfig config.Elasticsearch, start time.Time, end time.Time) ([]migration, error) {
+	pattern := elasticConfig.IndexName + "-*"
+
+	_, indicesBody, err := transport.PerformRequest(ctx, http.MethodGet, "/_cat/indices/"+pattern+"?format=json&h=index", nil)
+
+	if err != nil {
+		return nil, errors.New("error listing indices: " + err.Error())
+	}
+
+	var indices []struct {
+		Index string `json:"index"`
+	}
+	err = json.Unmarshal(indicesBody, &indices)
+
+	if err != nil {
+		return nil, errors.New("error listing indices: " + err.Error())
+	}
+
+	_, aliasesBody, err := transport.PerformRequest(ctx, http.MethodGet, "/_cat/aliases/"+pattern+"?format=json&h=alias,index", nil)
+
+	if err != nil {
+		return nil, errors.New("error listing aliases: " + err.Error())
+	}
+
+	var aliases []struct {
+		Alias string `json:"alias"`
+		Index string `json:"index"`
+	}
+	err = json.Unmarshal(aliasesBody, &aliases)
+
+	if err != nil {
+		return nil, errors.New("error listing aliases: " + err.Error())
+	}
+
+	sources := map[string]string{}
+	for _, index := range indices {
+		sources[index.Index] = index.Index
+	}
+	for _, alias := range aliases {
+		sources[alias.Alias] = alias.Index
+	}
+
+	//index times only go down to the index time append format, ex: days
+	startTime := truncateToIndexTime(elasticConfig, start)
+	endTime := truncateToIndexTime(elasticConfig, end)
+
+	var migrations []migration
+	for name, sourceIndex := range sources {
+		//migrated indices are found through their alias
+		if strings.Contains(name, migratedIndexInfix) {
+			continue
+		}
+
+		indexTime, err := time.Parse(elasticConfig.IndexTimeAppend, strings.TrimPrefix(name, elasticConfig.IndexName+"-"))
+
+		if err != nil || indexTime.Before(startTime) || indexTime.After(endTime) {
+			continue
+		}
+
+		migrations = append(migrations, migration{
+			name:        name,
+			sourceIndex: sourceIndex,
+		})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].name < migrations[j].name
+	})
+
+	return migrations, nil
+}
+
+//truncateToIndexTime drops the parts of a time which are not in the index time append format
+func truncateToIndexTime(elasticConfig config.Elasticsearch, t time.Time) time.Time {
+	indexTime, _ := time.Parse(elasticConfig.IndexTimeAppend, t.UTC().Format(elasticConfig.IndexTimeAppend))
+	return indexTime
+}
+
+/*
+migrateIndex - copies an index into a new index through a transform, then swaps the index's name over to the new index
+Writes to the old index are blocked while it is copied, so no event can be written to it after the copy starts and then be removed with it
+The new index is deleted and the old index is unblocked if the migration fails, leaving the old index as it was
+*/
+func migrateIndex(transport Transport, ctx context.Context, indexMigration migration, newIndex string, transform Transform, batchSize int) error {
+	log.Println("migrating: " + indexMigration.name + " from index: " + indexMigration.sourceIndex + " to index: " + newIndex)
+
+	err := setWriteBlock(transport, ctx, indexMigration.sourceIndex, true)
+
+	if err != nil {
+		return errors.New("error blocking writes to index: " + indexMigration.sourceIndex + ", " + err.Error())
+	}
+
+	_, _, err = transport.PerformRequest(ctx, http.MethodPut, "/"+url.PathEscape(newIndex), nil)
+
+	if err != nil {
+		unblockIndex(transport, ctx, indexMigration.sourceIndex)
+		return errors.New("error creating index: " + newIndex + ", " + err.Error())
+	}
+
+	//counted once writes are blocked, so every event in the old index is either copied or dropped by the transform
+	sourceCount, err := countIndex(transport, ctx, indexMigration.sourceIndex)
+
+	copied := 0
+	if err == nil {
+		var dropped int
+		copied, dropped, err = copyIndex(transport, ctx, indexMigration.sourceIndex, newIndex, transform, batchSize)
+
+		if err == nil {
+			err = checkCount(transport, ctx, newIndex, sourceCount-dropped)
+		}
+	}
+
+	if err == nil {
+		_, _, err = transport.PerformRequest(ctx, http.MethodPost, "/_aliases", map[string]interface{}{
+			"actions": []interface{}{
+				map[string]interface{}{
+					"add": map[string]interface{}{
+						"index": newIndex,
+						"alias": indexMigration.name,
+					},
+				},
+				map[string]interface{}{
+					"remove_index": map[string]interface{}{
+						"index": indexMigration.sourceIndex,
+					},
+				},
+			},
+		})
+
+		if err != nil {
+			err = errors.New("error swapping: " + indexMigration.name + " to index: " + newIndex + ", " + err.Error())
+		}
+	}
+
+	if err != nil {
+		_, _, deleteErr := transport.PerformRequest(ctx, http.MethodDelete, "/"+url.PathEscape(newIndex), nil)
+
+		if deleteErr != nil {
+			log.Println("error deleting index: " + newIndex + " after a failed migration, it must be deleted by hand: " + deleteErr.Error())
+		}
+
+		unblockIndex(transport, ctx, indexMigration.sourceIndex)
+
+		return errors.New("error migrating: " + indexMigration.name + ", the old index was left as it was: " + err.Error())
+	}
+
+	log.Println("migrated " + strconv.Itoa(copied) + " events from: " + indexMigration.name + " to index: " + newIndex)
+
+	return nil
+}
+
+/*
+setWriteBlock - sets or removes the write block of an index
+Removing the block resets the setting, rather than setting it to false, so the index is left with its default settings
+*/
+func setWriteBlock(transport Transport, ctx context.Context, index string, blocked bool) error {
+	var value interface{}
+	if blocked {
+		value = true
+	}
+
+	_, _, err := transport.PerformRequest(ctx, http.MethodPut, "/"+url.PathEscape(index)+"/_settings", map[string]interface{}{
+		"index.blocks.write": value,
+	})
+
+	return err
+}
+
+//unblockIndex removes the write block of an index after a failed migration, logging if it could not be removed
+func unblockIndex(transport Transport, ctx context.Context, index string) {
+	err := setWriteBlock(transport, ctx, index, false)
+
+	if err != nil {
+		log.Println("error removing the write block of index: " + index + " after a failed migration, it must be removed by hand: " + err.Error())
+	}
+}
+
+/*
+copyIndex - scrolls through an index and bulk indexes its transformed events into another index, keeping their ids
+Returns
+int - the number of events written
+int - the number of events dropped by the transform
+error - any errors which have been caught
+*/
+func copyIndex(transport Transport, ctx context.Context, sourceIndex string, newIndex string, transform Transform, batchSize int) (int, int, error) {
+	_, responseBody, err := transport.PerformRequest(ctx, http.MethodPost, "/"+url.PathEscape(sourceIndex)+"/_search?scroll="+migrationScroll, map[string]interface{}{
+		"size": batchSize,
+		"sort": []string{"_doc"},
+	})
+
+	if err != nil {
+		return 0, 0, errors.New("error searching index: " + sourceIndex + ", " + err.Error())
+	}
+
+	var scrollID string
+	defer func() {
+		if scrollID != "" {
+			_, _, _ = transport.PerformRequest(ctx, http.MethodDelete, "/_search/scroll", map[string]interface{}{"scroll_id": scrollID})
+		}
+	}()
+
+	copied := 0
+	dropped := 0
+	for {
+		var page struct {
+			ScrollID string `json:"_scroll_id"`
+			Hits     struct {
+				Hits []struct {
+					ID     string                 `json:"_id"`
+					Source map[string]interface{} `json:"_source"`
+				} `json:"hits"`
+			} `json:"hits"`
+		}
+		err = json.Unmarshal(responseBody, &page)
+
+		if err != nil {
+			return copied, dropped, errors.New("error reading index: " + sourceIndex + ", " + err.Error())
+		}
+
+		scrollID = page.ScrollID
+
+		if len(page.Hits.Hits) == 0 {
+			return copied, dropped, nil
+		}
+
+		var bulkBody bytes.Buffer
+		written := 0
+		for _, hit := range page.Hits.Hits {
+			doc, err := transform(hit.Source)
+
+			if err != nil {
+				return copied, dropped, errors.New("error transforming event: " + hit.ID + ", " + err.Error())
+			}
+
+			if doc == nil {
+				dropped++
+				continue
+			}
+
+			actionBytes, _ := json.Marshal(map[string]interface{}{
+				"index": map[string]interface{}{"_index": newIndex, "_id": hit.ID},
+			})
+			docBytes, err := json.Marshal(doc)
+
+			if err != nil {
+				return copied, dropped, errors.New("error transforming event: " + hit.ID + ", " + err.Error())
+			}
+
+			bulkBody.Write(actionBytes)
+			bulkBody.WriteByte('\n')
+			bulkBody.Write(docBytes)
+			bulkBody.WriteByte('\n')
+			written++
+		}
+
+		if written > 0 {
+			err = bulkWrite(transport, ctx, bulkBody.String())
+
+			if err != nil {
+				return copied, dropped, err
+			}
+
+			copied += written
+		}
+
+		_, responseBody, err = transport.PerformRequest(ctx, http.MethodPost, "/_search/scroll", map[string]interface{}{
+			"scroll":    migrationScroll,
+			"scroll_id": scrollID,
+		})
+
+		if err != nil {
+			return copied, dropped, errors.New("error scrolling index: " + sourceIndex + ", " + err.Error())
+		}
+	}
+}
+
+//bulkWrite sends a bulk request, failing if any of its events failed
+func bulkWrite(transport Transport, ctx context.Context, bulkBody string) error {
+	_, responseBody, err := transport.PerformRequest(ctx, http.MethodPost, "/_bulk", bulkBody)
+
+	if err != nil {
+		return errors.New("error sending bulk request: " + err.Error())
+	}
+
+	var response struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			ID    string          `json:"_id"`
+			Error json.RawMessage `json:"error"`
+		} `json:"items"`
+	}
+	err = json.Unmarshal(responseBody, &response)
+
+	if err != nil {
+		return errors.New("error reading bulk response: " + err.Error())
+	}
+
+	if response.Errors {
+		for _, item := range response.Items {
+			for _, result := range item {
+				if result.Error != nil {
+					return errors.New("error indexing event: " + result.ID + ", " + string(result.Error))
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+//checkCount checks that an index holds the expected number of events
+func checkCount(transport Transport, ctx context.Context, index string, expected int) error {
+	count, err := countIndex(transport, ctx, index)
+
+	if err != nil {
+		return err
+	}
+
+	if count != expected {
+		return errors.New("index: " + index + " has " + strconv.Itoa(count) + " events, expected " + strconv.Itoa(expected))
+	}
+
+	return nil
+}
+
+//countIndex refreshes an index, so that every event written to it is searchable, and counts its events
+func countIndex(transport Transport, ctx context.Context, index string) (int, error) {
+	_, _, err := transport.PerformRequest(ctx, http.MethodPost, "/"+url.PathEscape(index)+"/_refresh", nil)
+
+	if err != nil {
+		return 0, errors.New("error refreshing index: " + index + ", " + err.Error())
+	}
+
+	_, responseBody, err := transport.PerformRequest(ctx, http.MethodGet, "/"+url.PathEscape(index)+"/_count", nil)
+
+	if err != nil {
+		return 0, errors.New("error counting index: " + index + ", " + err.Error())
+	}
+
+	var count struct {
+		Count int `json:"count"`
+	}
+	err = json.Unmarshal(responseBody, &count)
+
+	if err != nil {
+		return 0, errors.New("error counting index: " + index + ", " + err.Error())
+	}
+
+	return count.Count, nil
+}
+
+/*
+geoLocationTransform - adds the geo point of an event from its lat and lon, if it does not have one
+Raw events have lat, lon, and geoPoint at the top, ecs events have them in host.geo
+*/
+func geoLocationTransform(doc map[string]interface{}) (map[string]interface{}, error) {
+	geo := doc
+	pointField := "geoPoint"
+
+	if host, ok := doc["host"].(map[string]interface{}); ok {
+		hostGeo, ok := host["geo"].(map[string]interface{})
+		if !ok {
+			return doc, nil
+		}
+		geo = hostGeo
+		pointField = "location"
+	}
+
+	if _, found := geo[pointField]; found {
+		return doc, nil
+	}
+
+	lat, latFound := geo["lat"]
+	lon, lonFound := geo["lon"]
+	if latFound && lonFound {
+		geo[pointField] = map[string]interface{}{
+			"lat": lat,
+			"lon": lon,
+		}
+	}
+
+	return doc, nil
+}
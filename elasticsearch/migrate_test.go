@@ -0,0 +1,236 @@
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/BenB196/crashplan-ffs-puller/config"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+//fakeTransport answers requests by method and path, and records every request it was sent
+type fakeTransport struct {
+	responses map[string]string
+	requests  []string
+	bodies    map[string]interface{}
+}
+
+func (transport *fakeTransport) PerformRequest(ctx context.Context, method string, path string, body interface{}, ignoreErrors ...int) (int, []byte, error) {
+	request := method + " " + path
+	transport.requests = append(transport.requests, request)
+
+	if transport.bodies == nil {
+		transport.bodies = map[string]interface{}{}
+	}
+	transport.bodies[request] = body
+
+	response, found := transport.responses[request]
+	if !found {
+		return http.StatusNotFound, nil, errors.New("no response for: " + request)
+	}
+
+	return http.StatusOK, []byte(response), nil
+}
+
+func TestFindMigrations(t *testing.T) {
+	transport := &fakeTransport{responses: map[string]string{
+		"GET /_cat/indices/crashplan-*?format=json&h=index": `[
+			{"index": "crashplan-2020-01-01"},
+			{"index": "crashplan-2020-01-02"},
+			{"index": "crashplan-2020-01-03-migrated-20200201150405"},
+			{"index": "crashplan-2020-01-04"},
+			{"index": "crashplan-2020-01-05"},
+			{"index": "crashplan-not-a-time"}
+		]`,
+		"GET /_cat/aliases/crashplan-*?format=json&h=alias,index": `[
+			{"alias": "crashplan-2020-01-03", "index": "crashplan-2020-01-03-migrated-20200201150405"}
+		]`,
+	}}
+	elasticConfig := config.Elasticsearch{IndexName: "crashplan", IndexTimeAppend: "2006-01-02"}
+
+	//the start and end are truncated to days, so the whole of the 2nd and the 4th are in the range
+	start := time.Date(2020, 1, 2, 12, 0, 0, 0, time.UTC)
+	end := time.Date(2020, 1, 4, 1, 0, 0, 0, time.UTC)
+
+	migrations, err := findMigrations(transport, context.Background(), elasticConfig, start, end)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []migration{
+		{name: "crashplan-2020-01-02", sourceIndex: "crashplan-2020-01-02"},
+		{name: "crashplan-2020-01-03", sourceIndex: "crashplan-2020-01-03-migrated-20200201150405"},
+		{name: "crashplan-2020-01-04", sourceIndex: "crashplan-2020-01-04"},
+	}
+
+	if !reflect.DeepEqual(migrations, want) {
+		t.Errorf("migrations = %+v, want %+v", migrations, want)
+	}
+}
+
+func TestGeoLocationTransform(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		want string
+	}{
+		{
+			name: "raw event gets a geo point",
+			doc:  `{"fileName": "a.txt", "lat": 40.7, "lon": -74}`,
+			want: `{"fileName": "a.txt", "lat": 40.7, "lon": -74, "geoPoint": {"lat": 40.7, "lon": -74}}`,
+		},
+		{
+			name: "raw event geo point is kept",
+			doc:  `{"lat": 40.7, "lon": -74, "geoPoint": {"lat": 1, "lon": 2}}`,
+			want: `{"lat": 40.7, "lon": -74, "geoPoint": {"lat": 1, "lon": 2}}`,
+		},
+		{
+			name: "raw event without a location",
+			doc:  `{"fileName": "a.txt", "lat": 40.7}`,
+			want: `{"fileName": "a.txt", "lat": 40.7}`,
+		},
+		{
+			name: "ecs event gets a location",
+			doc:  `{"host": {"name": "laptop", "geo": {"lat": 40.7, "lon": -74}}}`,
+			want: `{"host": {"name": "laptop", "geo": {"lat": 40.7, "lon": -74, "location": {"lat": 40.7, "lon": -74}}}}`,
+		},
+		{
+			name: "ecs event location is kept",
+			doc:  `{"host": {"geo": {"lat": 40.7, "lon": -74, "location": {"lat": 1, "lon": 2}}}}`,
+			want: `{"host": {"geo": {"lat": 40.7, "lon": -74, "location": {"lat": 1, "lon": 2}}}}`,
+		},
+		{
+			name: "ecs event without geo",
+			doc:  `{"host": {"name": "laptop"}, "lat": 40.7, "lon": -74}`,
+			want: `{"host": {"name": "laptop"}, "lat": 40.7, "lon": -74}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var doc, want map[string]interface{}
+			if err := json.Unmarshal([]byte(test.doc), &doc); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(test.want), &want); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := geoLocationTransform(doc)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("geoLocationTransform = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+//migrationResponses are the responses of a migration of crashplan-2020-01-01 with one event kept and one dropped
+func migrationResponses(sourceCount string, newCount string) map[string]string {
+	responses := map[string]string{
+		"PUT /crashplan-2020-01-01/_settings":            `{"acknowledged": true}`,
+		"PUT /crashplan-2020-01-01-migrated-1":           `{"acknowledged": true}`,
+		"POST /crashplan-2020-01-01/_refresh":            `{}`,
+		"GET /crashplan-2020-01-01/_count":               `{"count": ` + sourceCount + `}`,
+		"POST /_bulk":                                    `{"errors": false}`,
+		"POST /_search/scroll":                           `{"_scroll_id": "scroll", "hits": {"hits": []}}`,
+		"DELETE /_search/scroll":                         `{}`,
+		"POST /crashplan-2020-01-01-migrated-1/_refresh": `{}`,
+		"GET /crashplan-2020-01-01-migrated-1/_count":    `{"count": ` + newCount + `}`,
+		"POST /_aliases":                                 `{"acknowledged": true}`,
+		"DELETE /crashplan-2020-01-01-migrated-1":        `{"acknowledged": true}`,
+	}
+	responses["POST /crashplan-2020-01-01/_search?scroll="+migrationScroll] = `{"_scroll_id": "scroll", "hits": {"hits": [{"_id": "1", "_source": {"keep": true}}, {"_id": "2", "_source": {"keep": false}}]}}`
+
+	return responses
+}
+
+//keepTransform drops the events which are not marked to be kept
+func keepTransform(doc map[string]interface{}) (map[string]interface{}, error) {
+	if doc["keep"] != true {
+		return nil, nil
+	}
+	return doc, nil
+}
+
+func TestMigrateIndex(t *testing.T) {
+	indexMigration := migration{name: "crashplan-2020-01-01", sourceIndex: "crashplan-2020-01-01"}
+
+	t.Run("writes are blocked before the source is read", func(t *testing.T) {
+		transport := &fakeTransport{responses: migrationResponses("2", "1")}
+
+		err := migrateIndex(transport, context.Background(), indexMigration, "crashplan-2020-01-01-migrated-1", keepTransform, 10)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if transport.requests[0] != "PUT /crashplan-2020-01-01/_settings" {
+			t.Fatalf("first request = %s, want the write block", transport.requests[0])
+		}
+
+		if block := transport.bodies["PUT /crashplan-2020-01-01/_settings"]; !reflect.DeepEqual(block, map[string]interface{}{"index.blocks.write": true}) {
+			t.Errorf("write block = %v", block)
+		}
+
+		//the source is refreshed and counted after it is blocked and before it is searched, so events which were not yet searchable are counted
+		if strings.Join(transport.requests[2:4], ", ") != "POST /crashplan-2020-01-01/_refresh, GET /crashplan-2020-01-01/_count" {
+			t.Errorf("requests = %v, want the source refreshed and counted before it is searched", transport.requests)
+		}
+
+		if transport.requests[len(transport.requests)-1] != "POST /_aliases" {
+			t.Errorf("last request = %s, want the alias swap", transport.requests[len(transport.requests)-1])
+		}
+	})
+
+	t.Run("new index missing events of the source fails and unblocks the source", func(t *testing.T) {
+		//an event the scroll did not see, so only 1 of the 2 kept events was copied
+		transport := &fakeTransport{responses: migrationResponses("3", "1")}
+
+		err := migrateIndex(transport, context.Background(), indexMigration, "crashplan-2020-01-01-migrated-1", keepTransform, 10)
+
+		if err == nil || !strings.Contains(err.Error(), "has 1 events, expected 2") {
+			t.Fatalf("error = %v, want a count mismatch", err)
+		}
+
+		for _, request := range transport.requests {
+			if request == "POST /_aliases" {
+				t.Error("the source was swapped out after a count mismatch")
+			}
+		}
+
+		last := transport.requests[len(transport.requests)-2:]
+		if last[0] != "DELETE /crashplan-2020-01-01-migrated-1" || last[1] != "PUT /crashplan-2020-01-01/_settings" {
+			t.Errorf("requests = %v, want the new index deleted and the source unblocked", transport.requests)
+		}
+
+		if unblock := transport.bodies["PUT /crashplan-2020-01-01/_settings"]; !reflect.DeepEqual(unblock, map[string]interface{}{"index.blocks.write": nil}) {
+			t.Errorf("unblock = %v, want the write block reset", unblock)
+		}
+	})
+
+	t.Run("failed swap unblocks the source", func(t *testing.T) {
+		responses := migrationResponses("2", "1")
+		delete(responses, "POST /_aliases")
+		transport := &fakeTransport{responses: responses}
+
+		err := migrateIndex(transport, context.Background(), indexMigration, "crashplan-2020-01-01-migrated-1", keepTransform, 10)
+
+		if err == nil || !strings.Contains(err.Error(), "error swapping") {
+			t.Fatalf("error = %v, want a swap error", err)
+		}
+
+		if transport.requests[len(transport.requests)-1] != "PUT /crashplan-2020-01-01/_settings" {
+			t.Errorf("requests = %v, want the source unblocked", transport.requests)
+		}
+	})
+}
@@ -0,0 +1,70 @@
+package elasticsearch
+
+import (
+	"context"
+	"github.com/BenB196/crashplan-ffs-puller/config"
+	"github.com/olivere/elastic/v7"
+)
+
+//Output sends the events of an ffs query to elasticsearch through the query's shared bulk processor
+type Output struct {
+	transport     Transport
+	ctx           context.Context
+	queryName     string
+	elasticConfig config.Elasticsearch
+	processor     *elastic.BulkProcessor
+}
+
+/*
+NewOutput - builds the elasticsearch output of an ffs query, starting its bulk processor on first use
+Returns
+*Output - the elasticsearch output
+error - any errors which have been caught
+*/
+func NewOutput(client *elastic.Client, ctx context.Context, queryName string, elasticConfig config.Elasticsearch) (*Output, error) {
+	processor, err := GetBulkProcessor(client, ctx, queryName, elasticConfig)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Output{
+		transport:     NewTransport(client),
+		ctx:           ctx,
+		queryName:     queryName,
+		elasticConfig: elasticConfig,
+		processor:     processor,
+	}, nil
+}
+
+//EnsureIndex makes sure an index exists through the query's index cache
+func (output *Output) EnsureIndex(indexName string) error {
+	return GetIndexCache(output.queryName, output.elasticConfig).EnsureIndex(output.transport, output.ctx, indexName)
+}
+
+//Add queues an event in the bulk processor, which sends it once a bulk limit is reached or the output is flushed
+func (output *Output) Add(indexName string, doc interface{}) error {
+	output.processor.Add(NewBulkRequest(output.elasticConfig, indexName, doc))
+	return nil
+}
+
+/*
+Flush - sends every queued event
+Returns
+error - any errors which have been caught, including events which were rejected by elasticsearch, ex: by the write block of an index being migrated
+*/
+func (output *Output) Flush() error {
+	err := output.processor.Flush()
+
+	if err != nil {
+		return err
+	}
+
+	//the after callbacks of every request sent by the flush have run by the time it returns
+	return bulkFailure(output.queryName)
+}
+
+//ExportStats sets the bulk metrics of the query
+func (output *Output) ExportStats() {
+	ExportBulkStats(output.queryName, output.processor)
+}
@@ -0,0 +1,66 @@
+package elasticsearch
+
+import (
+	"context"
+	"github.com/BenB196/crashplan-ffs-puller/config"
+	"github.com/olivere/elastic/v7"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+//blockedBulkResponse is the response of a bulk request whose event was written to an index blocked by a migration
+const blockedBulkResponse = `{"took": 1, "errors": true, "items": [{"index": {"_index": "crashplan-2020-01-01", "_id": "1", "status": 403, "error": {"type": "cluster_block_exception", "reason": "index [crashplan-2020-01-01] blocked by: [FORBIDDEN/8/index write (api)];"}}}]}`
+
+func TestOutputFlushDuringMigration(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", "application/json")
+		if request.URL.Path == "/_bulk" {
+			_, _ = writer.Write([]byte(blockedBulkResponse))
+			return
+		}
+		_, _ = writer.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	client, err := elastic.NewClient(elastic.SetURL(server.URL), elastic.SetSniff(false), elastic.SetHealthcheck(false))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	queryName := "TestOutputFlushDuringMigration"
+	output, err := NewOutput(client, context.Background(), queryName, config.Elasticsearch{Bulk: config.Bulk{Workers: 1, Actions: 1000, Size: 5242880}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		_ = output.processor.Close()
+		sharedBulkProcessors.mutex.Lock()
+		delete(sharedBulkProcessors.processors, queryName)
+		sharedBulkProcessors.mutex.Unlock()
+		sharedBulkFailures.mutex.Lock()
+		delete(sharedBulkFailures.failures, queryName)
+		sharedBulkFailures.mutex.Unlock()
+	}()
+
+	err = output.Add("crashplan-2020-01-01", map[string]string{"fileName": "a.txt"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = output.Flush()
+
+	if err == nil || !strings.Contains(err.Error(), "crashplan-2020-01-01, cluster_block_exception") {
+		t.Fatalf("Flush error = %v, want the rejected event's cluster_block_exception", err)
+	}
+
+	//the failure is kept, so a later window flushed without events of its own is not completed either
+	if err := output.Flush(); err == nil {
+		t.Error("second Flush returned no error after an event was rejected")
+	}
+}
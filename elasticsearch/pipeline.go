@@ -0,0 +1,73 @@
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/BenB196/crashplan-ffs-puller/config"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+/*
+InstallPipeline - installs the ingest pipeline of an ffs query from its pipeline file
+The pipeline is only replaced if the version in the file differs from the installed version, pipelines without a version are always replaced
+Returns
+error - any errors which have been caught
+*/
+func InstallPipeline(transport Transport, ctx context.Context, elasticConfig config.Elasticsearch) error {
+	pipelineBytes, err := ioutil.ReadFile(elasticConfig.PipelineFile)
+
+	if err != nil {
+		return errors.New("error reading ingest pipeline file: " + err.Error())
+	}
+
+	var pipeline struct {
+		Version *int64 `json:"version,omitempty"`
+	}
+	err = json.Unmarshal(pipelineBytes, &pipeline)
+
+	if err != nil {
+		return errors.New("error parsing ingest pipeline file: " + err.Error())
+	}
+
+	path := "/_ingest/pipeline/" + url.PathEscape(elasticConfig.Pipeline)
+
+	if pipeline.Version != nil {
+		statusCode, responseBody, err := transport.PerformRequest(ctx, http.MethodGet, path, nil, http.StatusNotFound)
+
+		if err != nil {
+			return errors.New("error getting ingest pipeline: " + elasticConfig.Pipeline + ", " + err.Error())
+		}
+
+		if statusCode != http.StatusNotFound {
+			var installed map[string]struct {
+				Version int64 `json:"version"`
+			}
+			err = json.Unmarshal(responseBody, &installed)
+
+			if err != nil {
+				return errors.New("error getting ingest pipeline: " + elasticConfig.Pipeline + ", " + err.Error())
+			}
+
+			if installedPipeline, found := installed[elasticConfig.Pipeline]; found && installedPipeline.Version == *pipeline.Version {
+				return nil
+			}
+		}
+
+		log.Println("installing ingest pipeline: " + elasticConfig.Pipeline + " version: " + strconv.FormatInt(*pipeline.Version, 10))
+	} else {
+		log.Println("installing ingest pipeline: " + elasticConfig.Pipeline + ", add a version to the pipeline file to only install it when it changes")
+	}
+
+	_, _, err = transport.PerformRequest(ctx, http.MethodPut, path, string(pipelineBytes))
+
+	if err != nil {
+		return errors.New("error installing ingest pipeline: " + elasticConfig.Pipeline + ", " + err.Error())
+	}
+
+	return nil
+}
@@ -0,0 +1,65 @@
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/olivere/elastic/v7"
+)
+
+/*
+Transport is the raw request API of a cluster client
+The templates, index cache, pipelines, and write alias are installed through it, so that the elastic and opensearch outputs share them
+*/
+type Transport interface {
+	/*
+		PerformRequest - sends a request to the cluster, body is sent as json unless it is a string
+		Responses with a status code in ignoreErrors are returned without an error
+		Returns
+		int - the status code of the response
+		[]byte - the body of the response
+		error - any errors which have been caught
+	*/
+	PerformRequest(ctx context.Context, method string, path string, body interface{}, ignoreErrors ...int) (int, []byte, error)
+}
+
+//elasticTransport sends raw requests through an elastic client
+type elasticTransport struct {
+	client *elastic.Client
+}
+
+/*
+NewTransport - wraps an elastic client as a Transport
+*/
+func NewTransport(client *elastic.Client) Transport {
+	return elasticTransport{client: client}
+}
+
+func (transport elasticTransport) PerformRequest(ctx context.Context, method string, path string, body interface{}, ignoreErrors ...int) (int, []byte, error) {
+	response, err := transport.client.PerformRequest(ctx, elastic.PerformRequestOptions{
+		Method:       method,
+		Path:         path,
+		Body:         body,
+		IgnoreErrors: ignoreErrors,
+	})
+
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return response.StatusCode, response.Body, nil
+}
+
+//clusterError is the error body returned by elasticsearch and opensearch
+type clusterError struct {
+	Error struct {
+		Type   string `json:"type"`
+		Reason string `json:"reason"`
+	} `json:"error"`
+}
+
+//errorType gets the type of the error in a response body, ex: resource_already_exists_exception
+func errorType(responseBody []byte) string {
+	var response clusterError
+	_ = json.Unmarshal(responseBody, &response)
+	return response.Error.Type
+}
@@ -10,6 +10,8 @@ import (
 	"github.com/BenB196/ip-api-go-pkg"
 	"io/ioutil"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -39,6 +41,7 @@ type Code42 struct {
 	CloudDriveId            string                `json:"cloud_drive_id,omitempty"`
 	DetectionSourceAlias    string                `json:"detection_source_alias,omitempty"`
 	Exposure                []string              `json:"exposure,omitempty"`
+	RiskIndicators          []string              `json:"risk_indicators,omitempty"`
 	Process                 *Code42Process        `json:"process,omitempty"`
 	RemovableMedia          *Code42RemovableMedia `json:"removable_media,omitempty"`
 	SyncDestination         string                `json:"sync_destination,omitempty"`
@@ -322,6 +325,10 @@ func generateEventFileName(query config.FFSQuery) (string, error) {
 			return "", errors.New("error: no filters provided")
 		}
 		for _, filters := range groups.Filters {
+			//Only the windowing term makes up the file name
+			if filters.Term != query.TimestampTerm {
+				continue
+			}
 			if filters.Operator == "ON_OR_AFTER" {
 				//Get value in golang time
 				onOrAfter, err := time.Parse(time.RFC3339Nano, filters.Value)
@@ -340,6 +347,11 @@ func generateEventFileName(query config.FFSQuery) (string, error) {
 		}
 	}
 
+	//Search mode writes each page of a window to its own file, a pgNum set in an export mode query is left out so its file names do not change
+	if query.FetchMode == "search" && query.Query.PgNum > 0 {
+		fileName = fileName + "P" + strconv.Itoa(query.Query.PgNum)
+	}
+
 	fileName = query.Name + fileName
 
 	//Validate that a filename was generated
@@ -549,3 +561,309 @@ func ReadLastCompletedQuery(query config.FFSQuery) (InProgressQuery, error) {
 		OnOrBefore: onOrBefore,
 	}, nil
 }
+
+//Backfill progress struct, kept separate from the in progress and last completed queries of the live tail
+type BackfillProgress struct {
+	OnOrAfter  time.Time
+	OnOrBefore time.Time
+	Completed  []InProgressQuery
+}
+
+func WriteBackfillProgress(query config.FFSQuery, backfillProgress BackfillProgress) error {
+	fileName := query.OutputLocation + query.Name + "backfillProgress.json"
+	file, err := os.Create(fileName)
+
+	if err != nil {
+		return errors.New("error: creating file for backfill progress for ffs query: " + query.Name + " : " + err.Error())
+	}
+
+	defer func() {
+		if err := file.Close(); err != nil {
+			panic(errors.New("error: closing file: " + fileName + " " + err.Error()))
+		}
+	}()
+
+	w := bufio.NewWriter(file)
+
+	backfillProgressBytes, err := json.Marshal(backfillProgress)
+
+	if err != nil {
+		return errors.New("error: marshaling backfill progress for ffs query: " + query.Name)
+	}
+
+	_, err = w.Write(backfillProgressBytes)
+
+	if err != nil {
+		return errors.New("error: writing backfill progress to file: " + fileName + " " + err.Error())
+	}
+
+	err = w.Flush()
+
+	if err != nil {
+		return errors.New("error: flushing file: " + fileName + " " + err.Error())
+	}
+
+	err = file.Sync()
+
+	if err != nil {
+		return errors.New("error: syncing file: " + fileName + " " + err.Error())
+	}
+
+	return nil
+}
+
+/*
+ReadBackfillProgress - reads the saved backfill progress for an ffs query
+Returns nil if there is no backfill in progress
+*/
+func ReadBackfillProgress(query config.FFSQuery) (*BackfillProgress, error) {
+	fileName := query.OutputLocation + query.Name + "backfillProgress.json"
+	backfillProgressData, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if len(backfillProgressData) == 0 {
+		return nil, nil
+	}
+
+	var backfillProgress BackfillProgress
+
+	err = json.Unmarshal(backfillProgressData, &backfillProgress)
+
+	if err != nil {
+		return nil, errors.New("error: parsing backfill progress from: " + fileName + " " + err.Error())
+	}
+
+	return &backfillProgress, nil
+}
+
+func RemoveBackfillProgress(query config.FFSQuery) error {
+	fileName := query.OutputLocation + query.Name + "backfillProgress.json"
+	err := os.Remove(fileName)
+
+	if err != nil && !os.IsNotExist(err) {
+		return errors.New("error: removing backfill progress file: " + fileName + " " + err.Error())
+	}
+
+	return nil
+}
+
+/*
+MergeQueryIntervals - sorts query intervals and merges any which overlap or directly follow each other
+Intervals are inclusive on both ends at millisecond precision, so an interval starting 1ms after the previous one ends is merged
+*/
+func MergeQueryIntervals(intervals []InProgressQuery) []InProgressQuery {
+	if len(intervals) == 0 {
+		return nil
+	}
+
+	sorted := make([]InProgressQuery, len(intervals))
+	copy(sorted, intervals)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].OnOrAfter.Before(sorted[j].OnOrAfter)
+	})
+
+	merged := []InProgressQuery{sorted[0]}
+	for _, interval := range sorted[1:] {
+		last := &merged[len(merged)-1]
+		if !interval.OnOrAfter.After(last.OnOrBefore.Add(1 * time.Millisecond)) {
+			if interval.OnOrBefore.After(last.OnOrBefore) {
+				last.OnOrBefore = interval.OnOrBefore
+			}
+		} else {
+			merged = append(merged, interval)
+		}
+	}
+
+	return merged
+}
+
+/*
+FindQueryIntervalGaps - finds the parts of span which are not covered by any of the covered intervals
+Returns the uncovered intervals in order, inclusive on both ends at millisecond precision
+*/
+func FindQueryIntervalGaps(span InProgressQuery, covered []InProgressQuery) []InProgressQuery {
+	var gaps []InProgressQuery
+
+	next := span.OnOrAfter
+	for _, interval := range MergeQueryIntervals(covered) {
+		if interval.OnOrBefore.Before(next) {
+			continue
+		}
+		if interval.OnOrAfter.After(span.OnOrBefore) {
+			break
+		}
+		if interval.OnOrAfter.After(next) {
+			gaps = append(gaps, InProgressQuery{
+				OnOrAfter:  next,
+				OnOrBefore: interval.OnOrAfter.Add(-1 * time.Millisecond),
+			})
+		}
+		next = interval.OnOrBefore.Add(1 * time.Millisecond)
+	}
+
+	if !next.After(span.OnOrBefore) {
+		gaps = append(gaps, InProgressQuery{
+			OnOrAfter:  next,
+			OnOrBefore: span.OnOrBefore,
+		})
+	}
+
+	return gaps
+}
+
+func WriteCoverage(query config.FFSQuery, coverage []InProgressQuery) error {
+	fileName := query.OutputLocation + query.Name + "coverage.json"
+	file, err := os.Create(fileName)
+
+	if err != nil {
+		return errors.New("error: creating file for coverage for ffs query: " + query.Name + " : " + err.Error())
+	}
+
+	defer func() {
+		if err := file.Close(); err != nil {
+			panic(errors.New("error: closing file: " + fileName + " " + err.Error()))
+		}
+	}()
+
+	w := bufio.NewWriter(file)
+
+	coverageBytes, err := json.Marshal(coverage)
+
+	if err != nil {
+		return errors.New("error: marshaling coverage for ffs query: " + query.Name)
+	}
+
+	_, err = w.Write(coverageBytes)
+
+	if err != nil {
+		return errors.New("error: writing coverage to file: " + fileName + " " + err.Error())
+	}
+
+	err = w.Flush()
+
+	if err != nil {
+		return errors.New("error: flushing file: " + fileName + " " + err.Error())
+	}
+
+	err = file.Sync()
+
+	if err != nil {
+		return errors.New("error: syncing file: " + fileName + " " + err.Error())
+	}
+
+	return nil
+}
+
+/*
+ReadCoverage - reads the merged intervals of time which have been completed for an ffs query
+Returns
+[]InProgressQuery - the completed intervals, nil if nothing has been recorded yet
+bool - whether a coverage file existed
+error - any errors which have been caught
+*/
+func ReadCoverage(query config.FFSQuery) ([]InProgressQuery, bool, error) {
+	fileName := query.OutputLocation + query.Name + "coverage.json"
+	coverageData, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+
+	if len(coverageData) == 0 {
+		return nil, true, nil
+	}
+
+	var coverage []InProgressQuery
+
+	err = json.Unmarshal(coverageData, &coverage)
+
+	if err != nil {
+		return nil, true, errors.New("error: parsing coverage from: " + fileName + " " + err.Error())
+	}
+
+	return coverage, true, nil
+}
+
+//PageCheckpoint is how far a search mode query has got through the pages of a window
+type PageCheckpoint struct {
+	OnOrAfter  time.Time
+	OnOrBefore time.Time
+	PgToken    string
+	Page       int
+}
+
+func WritePageCheckpoints(query config.FFSQuery, pageCheckpoints []PageCheckpoint) error {
+	fileName := query.OutputLocation + query.Name + "pageCheckpoints.json"
+	file, err := os.Create(fileName)
+
+	if err != nil {
+		return errors.New("error: creating file for page checkpoints for ffs query: " + query.Name + " : " + err.Error())
+	}
+
+	defer func() {
+		if err := file.Close(); err != nil {
+			panic(errors.New("error: closing file: " + fileName + " " + err.Error()))
+		}
+	}()
+
+	w := bufio.NewWriter(file)
+
+	pageCheckpointsBytes, err := json.Marshal(pageCheckpoints)
+
+	if err != nil {
+		return errors.New("error: marshaling page checkpoints for ffs query: " + query.Name)
+	}
+
+	_, err = w.Write(pageCheckpointsBytes)
+
+	if err != nil {
+		return errors.New("error: writing page checkpoints to file: " + fileName + " " + err.Error())
+	}
+
+	err = w.Flush()
+
+	if err != nil {
+		return errors.New("error: flushing file: " + fileName + " " + err.Error())
+	}
+
+	err = file.Sync()
+
+	if err != nil {
+		return errors.New("error: syncing file: " + fileName + " " + err.Error())
+	}
+
+	return nil
+}
+
+//ReadPageCheckpoints - reads the saved page checkpoints for an ffs query, empty if there are none
+func ReadPageCheckpoints(query config.FFSQuery) ([]PageCheckpoint, error) {
+	fileName := query.OutputLocation + query.Name + "pageCheckpoints.json"
+	pageCheckpointData, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if len(pageCheckpointData) == 0 {
+		return nil, nil
+	}
+
+	var pageCheckpoints []PageCheckpoint
+
+	err = json.Unmarshal(pageCheckpointData, &pageCheckpoints)
+
+	if err != nil {
+		return nil, errors.New("error: parsing page checkpoints from: " + fileName + " " + err.Error())
+	}
+
+	return pageCheckpoints, nil
+}
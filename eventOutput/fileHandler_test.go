@@ -0,0 +1,196 @@
+package eventOutput
+
+import (
+	"github.com/BenB196/crashplan-ffs-go-pkg"
+	"github.com/BenB196/crashplan-ffs-puller/config"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGenerateEventFileName(t *testing.T) {
+	query := func(fetchMode string, pgNum int) config.FFSQuery {
+		return config.FFSQuery{
+			Name:          "test",
+			FetchMode:     fetchMode,
+			TimestampTerm: "insertionTimestamp",
+			Query: ffs.Query{
+				Groups: []ffs.Group{{
+					Filters: []ffs.SearchFilter{
+						{Term: "insertionTimestamp", Operator: "ON_OR_AFTER", Value: "2020-01-01T00:00:00.000Z"},
+						{Term: "insertionTimestamp", Operator: "ON_OR_BEFORE", Value: "2020-01-01T01:00:00.000Z"},
+						{Term: "fileName", Operator: "IS", Value: "a.txt"},
+					},
+				}},
+				PgNum: pgNum,
+			},
+		}
+	}
+
+	window := "testA2020.01.01.00.00.00.000B2020.01.01.01.00.00.000"
+	extension := ".json"
+
+	tests := []struct {
+		name  string
+		query config.FFSQuery
+		want  string
+	}{
+		{name: "export mode", query: query("export", 0), want: window + extension},
+		{name: "export mode with a configured pgNum", query: query("export", 3), want: window + extension},
+		{name: "default mode with a configured pgNum", query: query("", 3), want: window + extension},
+		{name: "search mode page", query: query("search", 2), want: window + "P2" + extension},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := generateEventFileName(test.query)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != test.want {
+				t.Errorf("file name = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+//interval builds an InProgressQuery from two RFC3339 times
+func interval(t *testing.T, onOrAfter string, onOrBefore string) InProgressQuery {
+	t.Helper()
+
+	after, err := time.Parse(time.RFC3339Nano, onOrAfter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, err := time.Parse(time.RFC3339Nano, onOrBefore)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return InProgressQuery{OnOrAfter: after, OnOrBefore: before}
+}
+
+func TestMergeQueryIntervals(t *testing.T) {
+	tests := []struct {
+		name      string
+		intervals []InProgressQuery
+		want      []InProgressQuery
+	}{
+		{name: "empty", intervals: nil, want: nil},
+		{
+			name:      "single",
+			intervals: []InProgressQuery{interval(t, "2020-01-01T00:00:00Z", "2020-01-01T01:00:00Z")},
+			want:      []InProgressQuery{interval(t, "2020-01-01T00:00:00Z", "2020-01-01T01:00:00Z")},
+		},
+		{
+			name: "windows 1ms apart are contiguous",
+			intervals: []InProgressQuery{
+				interval(t, "2020-01-01T01:00:00.001Z", "2020-01-01T02:00:00Z"),
+				interval(t, "2020-01-01T00:00:00Z", "2020-01-01T01:00:00Z"),
+			},
+			want: []InProgressQuery{interval(t, "2020-01-01T00:00:00Z", "2020-01-01T02:00:00Z")},
+		},
+		{
+			name: "windows 2ms apart leave a hole",
+			intervals: []InProgressQuery{
+				interval(t, "2020-01-01T00:00:00Z", "2020-01-01T01:00:00Z"),
+				interval(t, "2020-01-01T01:00:00.002Z", "2020-01-01T02:00:00Z"),
+			},
+			want: []InProgressQuery{
+				interval(t, "2020-01-01T00:00:00Z", "2020-01-01T01:00:00Z"),
+				interval(t, "2020-01-01T01:00:00.002Z", "2020-01-01T02:00:00Z"),
+			},
+		},
+		{
+			name: "overlapping and contained windows",
+			intervals: []InProgressQuery{
+				interval(t, "2020-01-01T00:30:00Z", "2020-01-01T00:40:00Z"),
+				interval(t, "2020-01-01T00:00:00Z", "2020-01-01T01:00:00Z"),
+				interval(t, "2020-01-01T00:50:00Z", "2020-01-01T01:30:00Z"),
+				interval(t, "2020-01-01T03:00:00Z", "2020-01-01T04:00:00Z"),
+			},
+			want: []InProgressQuery{
+				interval(t, "2020-01-01T00:00:00Z", "2020-01-01T01:30:00Z"),
+				interval(t, "2020-01-01T03:00:00Z", "2020-01-01T04:00:00Z"),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			original := append([]InProgressQuery(nil), test.intervals...)
+
+			got := MergeQueryIntervals(test.intervals)
+
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("MergeQueryIntervals = %v, want %v", got, test.want)
+			}
+
+			if !reflect.DeepEqual(test.intervals, original) {
+				t.Errorf("MergeQueryIntervals changed its input to %v", test.intervals)
+			}
+		})
+	}
+}
+
+func TestFindQueryIntervalGaps(t *testing.T) {
+	span := interval(t, "2020-01-01T00:00:00Z", "2020-01-01T04:00:00Z")
+
+	tests := []struct {
+		name    string
+		covered []InProgressQuery
+		want    []InProgressQuery
+	}{
+		{
+			name:    "nothing covered",
+			covered: nil,
+			want:    []InProgressQuery{span},
+		},
+		{
+			name:    "everything covered",
+			covered: []InProgressQuery{interval(t, "2019-12-31T00:00:00Z", "2020-01-02T00:00:00Z")},
+			want:    nil,
+		},
+		{
+			name: "contiguous windows cover the span",
+			covered: []InProgressQuery{
+				interval(t, "2020-01-01T00:00:00Z", "2020-01-01T02:00:00Z"),
+				interval(t, "2020-01-01T02:00:00.001Z", "2020-01-01T04:00:00Z"),
+			},
+			want: nil,
+		},
+		{
+			name: "holes at the start, middle, and end",
+			covered: []InProgressQuery{
+				interval(t, "2020-01-01T03:00:00Z", "2020-01-01T03:30:00Z"),
+				interval(t, "2020-01-01T01:00:00Z", "2020-01-01T02:00:00Z"),
+			},
+			want: []InProgressQuery{
+				interval(t, "2020-01-01T00:00:00Z", "2020-01-01T00:59:59.999Z"),
+				interval(t, "2020-01-01T02:00:00.001Z", "2020-01-01T02:59:59.999Z"),
+				interval(t, "2020-01-01T03:30:00.001Z", "2020-01-01T04:00:00Z"),
+			},
+		},
+		{
+			name: "intervals outside the span are ignored",
+			covered: []InProgressQuery{
+				interval(t, "2019-12-31T00:00:00Z", "2019-12-31T01:00:00Z"),
+				interval(t, "2020-01-01T00:00:00Z", "2020-01-01T03:59:59.998Z"),
+				interval(t, "2020-01-02T00:00:00Z", "2020-01-02T01:00:00Z"),
+			},
+			want: []InProgressQuery{interval(t, "2020-01-01T03:59:59.999Z", "2020-01-01T04:00:00Z")},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := FindQueryIntervalGaps(span, test.covered)
+
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("FindQueryIntervalGaps = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
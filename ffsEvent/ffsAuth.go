@@ -0,0 +1,219 @@
+package ffsEvent
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/BenB196/crashplan-ffs-go-pkg"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+//How long before a token expires that it is refreshed
+const authRefreshMargin = 5 * time.Minute
+
+//How long a token is assumed to be valid for if its expiry cannot be read from it
+const authDefaultLifetime = 55 * time.Minute
+
+//authKey identifies a set of credentials, queries only share a session if all of their credentials match
+type authKey struct {
+	authURI    string
+	authType   string
+	username   string
+	secretHash [sha256.Size]byte
+}
+
+//authSession is a cached Code42 auth token shared by every ffs query which uses the same credentials
+type authSession struct {
+	mutex         sync.Mutex
+	authURI       string
+	authType      string
+	username      string
+	password      string
+	authorization string
+	expires       time.Time
+}
+
+//authManager hands out one authSession per (AuthURI, AuthType, Username, secret), so queries with different credentials for the same user never share a token
+type authManager struct {
+	mutex    sync.Mutex
+	sessions map[authKey]*authSession
+}
+
+var sharedAuthManager = &authManager{sessions: map[authKey]*authSession{}}
+
+/*
+getAuthSession - gets the shared auth session for a set of credentials, creating it if it does not exist yet
+The token is not fetched until it is first needed
+authType - basic for a username and password, apiClient for an API client ID and secret
+*/
+func getAuthSession(authURI string, authType string, username string, password string) *authSession {
+	sharedAuthManager.mutex.Lock()
+	defer sharedAuthManager.mutex.Unlock()
+
+	key := authKey{authURI: authURI, authType: authType, username: username, secretHash: sha256.Sum256([]byte(password))}
+	session, found := sharedAuthManager.sessions[key]
+	if !found {
+		session = &authSession{
+			authURI:  authURI,
+			authType: authType,
+			username: username,
+			password: password,
+		}
+		sharedAuthManager.sessions[key] = session
+	}
+
+	return session
+}
+
+/*
+get - gets the Authorization header value for the current token of the session
+The token is refreshed first if there is none yet, or if it is within authRefreshMargin of expiring
+*/
+func (session *authSession) get() (string, error) {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	if session.authorization == "" || time.Now().After(session.expires.Add(-authRefreshMargin)) {
+		var err error
+
+		if session.authType == "apiClient" {
+			var token *apiClientToken
+			token, err = getApiClientToken(session.authURI, session.username, session.password)
+
+			if err == nil {
+				session.authorization = "Bearer " + token.AccessToken
+				session.expires = getTokenExpiry(token.AccessToken)
+				if token.ExpiresIn > 0 {
+					session.expires = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+				}
+			}
+		} else {
+			var authData *ffs.AuthData
+			authData, err = ffs.GetAuthData(session.authURI, session.username, session.password)
+
+			if err == nil {
+				session.authorization = "v3_user_token " + authData.Data.V3UserToken
+				session.expires = getTokenExpiry(authData.Data.V3UserToken)
+			}
+		}
+
+		if err != nil {
+			return "", errors.New("error getting auth data for user: " + session.username + " " + err.Error())
+		}
+
+		log.Println("Refreshed auth token for user: " + session.username + ", expires at " + session.expires.String())
+	}
+
+	return session.authorization, nil
+}
+
+/*
+invalidate - drops the cached token after it has been rejected, so that the next get refreshes it
+staleAuthorization - the Authorization header which was rejected, if the token has already been refreshed by another query nothing is dropped
+*/
+func (session *authSession) invalidate(staleAuthorization string) {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	if session.authorization == staleAuthorization {
+		session.authorization = ""
+	}
+}
+
+//Struct of the Code42 OAuth client credentials token return
+type apiClientToken struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type,omitempty"`
+	ExpiresIn   int64  `json:"expires_in,omitempty"`
+}
+
+/*
+getApiClientToken - gets an OAuth token for a Code42 API client using the client credentials grant
+The token endpoint is /api/v3/oauth/token on the same host as the authURI
+*/
+func getApiClientToken(authURI string, clientId string, secret string) (*apiClientToken, error) {
+	authURL, err := url.Parse(authURI)
+
+	if err != nil {
+		return nil, err
+	}
+
+	tokenURI := authURL.Scheme + "://" + authURL.Host + "/api/v3/oauth/token?grant_type=client_credentials"
+
+	req, err := http.NewRequest("POST", tokenURI, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	req.SetBasicAuth(clientId, secret)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("Error with API client token POST: " + resp.Status)
+	}
+
+	responseBytes, err := ioutil.ReadAll(resp.Body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var token apiClientToken
+	err = json.Unmarshal(responseBytes, &token)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if token.AccessToken == "" {
+		return nil, errors.New("error: API client token response did not contain an access token")
+	}
+
+	return &token, nil
+}
+
+//getTokenExpiry reads the exp claim of a JWT, falling back to authDefaultLifetime from now if it cannot be read
+func getTokenExpiry(token string) time.Time {
+	fallback := time.Now().Add(authDefaultLifetime)
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return fallback
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return fallback
+	}
+
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	err = json.Unmarshal(payload, &claims)
+	if err != nil || claims.Exp == 0 {
+		return fallback
+	}
+
+	return time.Unix(claims.Exp, 0)
+}
+
+//isUnauthorizedError checks if an error returned from the FFS API is because the auth token was rejected
+func isUnauthorizedError(err error) bool {
+	return strings.Contains(err.Error(), "POST: 401 Unauthorized")
+}
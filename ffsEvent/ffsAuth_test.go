@@ -0,0 +1,143 @@
+package ffsEvent
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetApiClientToken(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		body       string
+		wantToken  string
+		wantExpiry int64
+		wantErr    string
+	}{
+		{
+			name:       "success",
+			status:     http.StatusOK,
+			body:       `{"access_token":"abc","token_type":"bearer","expires_in":900}`,
+			wantToken:  "abc",
+			wantExpiry: 900,
+		},
+		{
+			name:    "rejected credentials",
+			status:  http.StatusUnauthorized,
+			body:    `{"error":"invalid_client"}`,
+			wantErr: "401 Unauthorized",
+		},
+		{
+			name:    "malformed response",
+			status:  http.StatusOK,
+			body:    `{"access_token":`,
+			wantErr: "unexpected end of JSON input",
+		},
+		{
+			name:    "response without a token",
+			status:  http.StatusOK,
+			body:    `{"token_type":"bearer"}`,
+			wantErr: "did not contain an access token",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var gotPath, gotGrant, gotUser, gotSecret string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotPath = r.URL.Path
+				gotGrant = r.URL.Query().Get("grant_type")
+				gotUser, gotSecret, _ = r.BasicAuth()
+				w.WriteHeader(test.status)
+				_, _ = w.Write([]byte(test.body))
+			}))
+			defer server.Close()
+
+			//the token endpoint is on the same host as the authURI, whatever its path
+			token, err := getApiClientToken(server.URL+"/c42api/v3/auth/jwt?useBody=true", "client", "secret")
+
+			if gotPath != "/api/v3/oauth/token" || gotGrant != "client_credentials" || gotUser != "client" || gotSecret != "secret" {
+				t.Errorf("request = %s grant_type=%s as %s:%s, want /api/v3/oauth/token grant_type=client_credentials as client:secret", gotPath, gotGrant, gotUser, gotSecret)
+			}
+
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("error = %v, want one containing %q", err, test.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if token.AccessToken != test.wantToken || token.ExpiresIn != test.wantExpiry {
+				t.Errorf("token = %+v, want %s expiring in %d", token, test.wantToken, test.wantExpiry)
+			}
+		})
+	}
+}
+
+func TestAuthSessionApiClient(t *testing.T) {
+	t.Run("failed token request is returned and nothing is cached", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+		}))
+		defer server.Close()
+
+		session := &authSession{authURI: server.URL, authType: "apiClient", username: "client", password: "bad"}
+
+		if _, err := session.get(); err == nil || !strings.Contains(err.Error(), "401") {
+			t.Fatalf("error = %v, want a 401", err)
+		}
+
+		if session.authorization != "" {
+			t.Errorf("cached authorization %q after a failed request", session.authorization)
+		}
+	})
+
+	t.Run("token is cached until it nears its expiry", func(t *testing.T) {
+		issued := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			issued++
+			_, _ = w.Write([]byte(`{"access_token":"token-` + strconv.Itoa(issued) + `","expires_in":3600}`))
+		}))
+		defer server.Close()
+
+		session := &authSession{authURI: server.URL, authType: "apiClient", username: "client", password: "secret"}
+
+		for i := 0; i < 2; i++ {
+			if authorization, err := session.get(); err != nil || authorization != "Bearer token-1" {
+				t.Fatalf("get = %q, %v, want Bearer token-1", authorization, err)
+			}
+		}
+
+		//within the refresh margin of expiring
+		session.expires = time.Now().Add(authRefreshMargin / 2)
+
+		if authorization, err := session.get(); err != nil || authorization != "Bearer token-2" {
+			t.Fatalf("get = %q, %v, want Bearer token-2", authorization, err)
+		}
+	})
+}
+
+func TestGetTokenExpiry(t *testing.T) {
+	jwt := func(payload string) string {
+		return "header." + base64.RawURLEncoding.EncodeToString([]byte(payload)) + ".signature"
+	}
+
+	if got := getTokenExpiry(jwt(`{"exp":1600000000}`)); !got.Equal(time.Unix(1600000000, 0)) {
+		t.Errorf("expiry = %v, want %v", got, time.Unix(1600000000, 0))
+	}
+
+	for _, token := range []string{"not-a-jwt", jwt(`{}`), jwt(`not json`), "a.!!!.c"} {
+		if got := getTokenExpiry(token); got.Before(time.Now().Add(authDefaultLifetime - time.Minute)) {
+			t.Errorf("expiry of %q = %v, want the default lifetime from now", token, got)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package ffsEvent
+
+import (
+	"errors"
+	"github.com/BenB196/crashplan-ffs-puller/config"
+	"github.com/BenB196/crashplan-ffs-puller/eventOutput"
+	"github.com/BenB196/crashplan-ffs-puller/promMetrics"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+)
+
+/*
+Backfill - pulls the file events of an ffs query for a fixed time range, separately from the live tail
+The range is split into windows of windowSize (the query's time gap if 0) which are run in parallel, up to the query's max concurrent queries
+Progress is checkpointed to its own file, so an interrupted backfill is resumed by running it again with the same range, or with resume set
+onOrAfter - start of the time range, ignored if resume is set
+onOrBefore - end of the time range, ignored if resume is set
+If onOrBefore is zero, the end of the saved backfill with the same start is used, or 15 minutes ago if there is none, so that running it again without an end resumes it
+Returns
+error - any errors which have been caught
+*/
+func Backfill(configuration config.Config, query config.FFSQuery, onOrAfter time.Time, onOrBefore time.Time, windowSize time.Duration, resume bool) error {
+	//Load saved backfill progress from the last run
+	backfillProgress, err := eventOutput.ReadBackfillProgress(query)
+
+	if err != nil {
+		return errors.New("error getting backfill progress for ffs query: " + query.Name + " " + err.Error())
+	}
+
+	if onOrBefore.IsZero() && !resume {
+		if backfillProgress != nil && backfillProgress.OnOrAfter.Equal(onOrAfter) {
+			onOrBefore = backfillProgress.OnOrBefore
+		} else {
+			//Code42 expects logs to be ready for pulling 15 minutes after they happen
+			onOrBefore = time.Now().Add(-15 * time.Minute).UTC().Truncate(time.Millisecond)
+		}
+	}
+
+	if backfillProgress != nil {
+		if !resume && (!backfillProgress.OnOrAfter.Equal(onOrAfter) || !backfillProgress.OnOrBefore.Equal(onOrBefore)) {
+			return errors.New("error: a backfill from " + backfillProgress.OnOrAfter.String() + " to " + backfillProgress.OnOrBefore.String() + " is already in progress for ffs query: " + query.Name + ", resume it before starting a new one")
+		}
+		log.Println("Resuming backfill for ffs query: " + query.Name + " from " + backfillProgress.OnOrAfter.String() + " to " + backfillProgress.OnOrBefore.String())
+	} else if resume {
+		return errors.New("error: no backfill to resume for ffs query: " + query.Name)
+	} else {
+		if !onOrAfter.Before(onOrBefore) {
+			return errors.New("error: backfill start time must be before its end time for ffs query: " + query.Name)
+		}
+
+		backfillProgress = &eventOutput.BackfillProgress{
+			OnOrAfter:  onOrAfter,
+			OnOrBefore: onOrBefore,
+		}
+
+		err = eventOutput.WriteBackfillProgress(query, *backfillProgress)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if windowSize == 0 {
+		windowSize, _ = time.ParseDuration(query.TimeGap)
+	}
+
+	//Only split up the parts of the range which have not been completed yet
+	var windows []eventOutput.InProgressQuery
+	backfillRange := eventOutput.InProgressQuery{
+		OnOrAfter:  backfillProgress.OnOrAfter,
+		OnOrBefore: backfillProgress.OnOrBefore,
+	}
+	for _, gap := range eventOutput.FindQueryIntervalGaps(backfillRange, backfillProgress.Completed) {
+		windows = append(windows, splitTimeRange(gap, windowSize)...)
+	}
+
+	log.Println("Backfilling " + strconv.Itoa(len(windows)) + " windows for ffs query: " + query.Name)
+
+	//Get initial authData from the shared session
+	session := getAuthSession(configuration.AuthURI, query.AuthType, query.Username, query.Password)
+	_, err = session.get()
+
+	if err != nil {
+		return errors.New("error getting auth data for ffs query: " + query.Name + " " + err.Error())
+	}
+
+	//Backfilled windows are recorded in the query's coverage, so the live tail's audit does not pull them again
+	lastCompletedQuery, err := eventOutput.ReadLastCompletedQuery(query)
+
+	if err != nil {
+		return errors.New("error getting last completed query for ffs query: " + query.Name + " " + err.Error())
+	}
+
+	ledger, err := newCoverageLedger(query, lastCompletedQuery, time.Time{})
+
+	if err != nil {
+		return errors.New("error getting coverage for ffs query: " + query.Name + " " + err.Error())
+	}
+
+	//Init the elastic or opensearch output if the output type is elastic or opensearch
+	output := initSearchOutput(query)
+
+	var progressMutex sync.Mutex
+	var progressErr error
+	runWindows(query, windows, session, configuration, output, func(window eventOutput.InProgressQuery) {
+		progressMutex.Lock()
+		defer progressMutex.Unlock()
+
+		backfillProgress.Completed = eventOutput.MergeQueryIntervals(append(backfillProgress.Completed, window))
+
+		err := ledger.add(window)
+
+		if err == nil {
+			err = eventOutput.WriteBackfillProgress(query, *backfillProgress)
+		}
+
+		if err != nil && progressErr == nil {
+			progressErr = err
+		}
+	})
+
+	//the windows were output, but the progress or coverage file no longer matches them, so it is kept for a resume to redo them
+	if progressErr != nil {
+		return errors.New("error writing backfill progress or coverage for ffs query: " + query.Name + " " + progressErr.Error())
+	}
+
+	log.Println("Backfill complete for ffs query: " + query.Name)
+
+	return eventOutput.RemoveBackfillProgress(query)
+}
+
+/*
+runWindows - processes a set of fixed query windows in parallel, up to the query's max concurrent queries
+onComplete - called after each window has been output successfully
+*/
+func runWindows(query config.FFSQuery, windows []eventOutput.InProgressQuery, session *authSession, configuration config.Config, output searchOutput, onComplete func(window eventOutput.InProgressQuery)) {
+	maxConcurrentQueries := *query.MaxConcurrentQueries
+	if maxConcurrentQueries < 1 {
+		maxConcurrentQueries = len(windows)
+	}
+
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, maxConcurrentQueries)
+	for _, window := range windows {
+		semaphore <- struct{}{}
+		wg.Add(1)
+		go func(window eventOutput.InProgressQuery) {
+			defer func() {
+				<-semaphore
+				wg.Done()
+			}()
+
+			promMetrics.IncreaseInProgressQueries()
+
+			windowQuery := setOnOrBeforeAndAfter(query, window.OnOrBefore, window.OnOrAfter)
+			stats := processWindow(windowQuery, window, session, configuration, output)
+
+			onComplete(window)
+
+			promMetrics.IncrementEventsProcessed(stats.events)
+			promMetrics.DecreaseInProgressQueries()
+			log.Println("Number of events for query: " + query.Name + " - " + strconv.Itoa(stats.events) +
+				" - Window: " + window.OnOrAfter.String() + " to " + window.OnOrBefore.String() +
+				" - Get File Events Duration: " + stats.getFileEvents.String() +
+				" - Enrichment Duration: " + stats.enrichment.String() + " - Output Duration: " + stats.output.String())
+		}(window)
+	}
+	wg.Wait()
+}
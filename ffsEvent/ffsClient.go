@@ -0,0 +1,210 @@
+package ffsEvent
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/BenB196/crashplan-ffs-go-pkg"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+//v2SearchPath is the file event search endpoint of the v2 api, on the same host as the ffsURI
+const v2SearchPath = "/v2/file-events"
+
+/*
+fileEvent is a file event of either api version
+The v1 fields are in the embedded ffs.JsonFileEvent, v2 fields which have no v1 equivalent are kept beside them
+*/
+type fileEvent struct {
+	ffs.JsonFileEvent
+	RiskIndicators []string
+}
+
+//fileEventResponse is a single page of file events of either api version
+type fileEventResponse struct {
+	FileEvents  []fileEvent
+	NextPgToken string
+	Problems    []ffs.QueryProblem
+	TotalCount  *int64
+}
+
+/*
+ffsSearchURI - gets the file event search endpoint of an api version
+v1 searches at the ffsURI without /export on the end, v2 searches at /v2/file-events on the host of the ffsURI whatever path the ffsURI has
+*/
+func ffsSearchURI(ffsURI string, apiVersion string) string {
+	if apiVersion != "v2" {
+		return strings.TrimSuffix(ffsURI, "/export")
+	}
+
+	searchURL, err := url.Parse(ffsURI)
+
+	//the ffsURI is validated when the config is read
+	if err != nil {
+		return ffsURI
+	}
+
+	searchURL.Path = v2SearchPath
+	searchURL.RawPath = ""
+	searchURL.RawQuery = ""
+
+	return searchURL.String()
+}
+
+/*
+getJsonFileEvents - gets every page of file events for a query from the FFS API
+This mirrors ffs.GetJsonFileEvents, but takes the full Authorization header so that both v3_user_token and Bearer tokens can be used
+authorization - the Authorization header value from the auth session
+apiVersion - v1 or v2, v2 queries are sent to the v2 search endpoint with their terms translated and their events mapped back into v1 file events
+Returns
+*[]fileEvent - the file events from every page of the query
+error - any errors, in the same format as ffs.GetJsonFileEvents so that they can be checked by isRecoverableError
+*/
+func getJsonFileEvents(authorization string, ffsURI string, apiVersion string, query ffs.Query, debugging bool) (*[]fileEvent, error) {
+	var jsonFileEvents []fileEvent
+
+	//v2 has no export endpoint, its events are paged through the search endpoint
+	if apiVersion == "v2" {
+		ffsURI = ffsSearchURI(ffsURI, apiVersion)
+	}
+
+	for {
+		fileEventResponse, err := searchJsonFileEvents(authorization, ffsURI, apiVersion, query)
+
+		if err != nil {
+			return nil, err
+		}
+
+		jsonFileEvents = append(jsonFileEvents, fileEventResponse.FileEvents...)
+
+		if fileEventResponse.NextPgToken == "" {
+			return &jsonFileEvents, nil
+		}
+
+		if debugging {
+			log.Print("Next Page Token: ")
+			log.Println(fileEventResponse.NextPgToken)
+		}
+
+		query.PgToken = fileEventResponse.NextPgToken
+	}
+}
+
+/*
+searchJsonFileEvents - gets the single page of file events for a query starting at query.PgToken
+Problems reported by the FFS API are returned as an error
+*/
+func searchJsonFileEvents(authorization string, ffsURI string, apiVersion string, query ffs.Query) (*fileEventResponse, error) {
+	//Make sure the authorization is not ""
+	if authorization == "" {
+		return nil, errors.New("authorization cannot be blank")
+	}
+
+	if apiVersion == "v2" {
+		query = translateQueryToV2(query)
+	}
+
+	fileEventResponse, err := getJsonFileEventPage(authorization, ffsURI, apiVersion, query)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if fileEventResponse.Problems != nil {
+		problems, err := json.Marshal(fileEventResponse.Problems)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, errors.New(string(problems))
+	}
+
+	return fileEventResponse, nil
+}
+
+/*
+getJsonFileEventPage - gets a single page of file events from the FFS API
+Every request waits on the shared rate limiter first
+*/
+func getJsonFileEventPage(authorization string, ffsURI string, apiVersion string, query ffs.Query) (*fileEventResponse, error) {
+	//Validate query is valid JSON
+	ffsQuery, err := json.Marshal(query)
+	if err != nil {
+		return nil, errors.New("jsonQuery is not in a valid json format")
+	}
+
+	//Query ffsURI with the authorization and query body
+	req, err := http.NewRequest("POST", ffsURI, bytes.NewReader(ffsQuery))
+
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", authorization)
+
+	release := ffsRateLimiter.wait()
+	defer release()
+
+	resp, err := http.DefaultClient.Do(req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	//Make sure http status code is 200
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("Error with gathering file events POST: " + resp.Status)
+	}
+
+	if apiVersion != "v2" {
+		v1Response, err := ffs.GetJsonFileEventResponse(resp)
+
+		if err != nil {
+			return nil, err
+		}
+
+		response := fileEventResponse{
+			NextPgToken: v1Response.NextPgToken,
+			Problems:    v1Response.Problems,
+			TotalCount:  v1Response.TotalCount,
+		}
+		for _, event := range v1Response.FileEvents {
+			response.FileEvents = append(response.FileEvents, fileEvent{JsonFileEvent: event})
+		}
+
+		return &response, nil
+	}
+
+	//Read the v2 response and map its events into v1 file events
+	body, err := ioutil.ReadAll(resp.Body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var v2Response V2FileEventResponse
+	err = json.Unmarshal(body, &v2Response)
+
+	if err != nil {
+		return nil, err
+	}
+
+	response := fileEventResponse{
+		NextPgToken: v2Response.NextPgToken,
+		Problems:    v2Response.Problems,
+		TotalCount:  v2Response.TotalCount,
+	}
+	for _, event := range v2Response.FileEvents {
+		response.FileEvents = append(response.FileEvents, mapV2FileEvent(event))
+	}
+
+	return &response, nil
+}
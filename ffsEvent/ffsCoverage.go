@@ -0,0 +1,198 @@
+package ffsEvent
+
+import (
+	"github.com/BenB196/crashplan-ffs-puller/config"
+	"github.com/BenB196/crashplan-ffs-puller/eventOutput"
+	"github.com/BenB196/crashplan-ffs-puller/promMetrics"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+)
+
+//coverageLedger keeps track of the merged intervals of time which have been completed for an ffs query
+type coverageLedger struct {
+	mutex sync.Mutex
+	query config.FFSQuery
+	//from is where holes are looked for from, the query's configured start
+	from      time.Time
+	intervals []eventOutput.InProgressQuery
+}
+
+/*
+newCoverageLedger - loads the coverage ledger of an ffs query
+If the query has no ledger yet but has a last completed query (it was run by a version without a ledger),
+everything up to the last completed query is assumed to have been covered
+from - the start of the query's coverage, holes are looked for from its first completed interval if empty
+*/
+func newCoverageLedger(query config.FFSQuery, lastCompletedQuery eventOutput.InProgressQuery, from time.Time) (*coverageLedger, error) {
+	intervals, found, err := eventOutput.ReadCoverage(query)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ledger := &coverageLedger{
+		query:     query,
+		from:      from,
+		intervals: eventOutput.MergeQueryIntervals(intervals),
+	}
+
+	if !found && lastCompletedQuery != (eventOutput.InProgressQuery{}) {
+		defaultQueryTimes, err := getOnOrBeforeAndAfter(query)
+
+		if err != nil {
+			return nil, err
+		}
+
+		onOrAfter := defaultQueryTimes.OnOrAfter
+		if onOrAfter == (time.Time{}) || onOrAfter.After(lastCompletedQuery.OnOrAfter) {
+			onOrAfter = lastCompletedQuery.OnOrAfter
+		}
+
+		log.Println("No coverage found for ffs query: " + query.Name + ", assuming everything up to the last completed query has been covered")
+		ledger.intervals = []eventOutput.InProgressQuery{{
+			OnOrAfter:  onOrAfter,
+			OnOrBefore: lastCompletedQuery.OnOrBefore,
+		}}
+	}
+
+	err = eventOutput.WriteCoverage(query, ledger.intervals)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ledger, nil
+}
+
+/*
+add - records a completed window in the ledger and writes the ledger to file
+Windows recorded by another process since the file was last read, ex: a backfill run alongside the live tail, are merged in first so they are not overwritten
+*/
+func (ledger *coverageLedger) add(window eventOutput.InProgressQuery) error {
+	ledger.mutex.Lock()
+	defer ledger.mutex.Unlock()
+
+	err := ledger.load()
+
+	if err != nil {
+		return err
+	}
+
+	ledger.intervals = eventOutput.MergeQueryIntervals(append(ledger.intervals, window))
+
+	return eventOutput.WriteCoverage(ledger.query, ledger.intervals)
+}
+
+//load merges the intervals in the ledger's file into the ledger, the mutex must be held
+func (ledger *coverageLedger) load() error {
+	intervals, _, err := eventOutput.ReadCoverage(ledger.query)
+
+	if err != nil {
+		return err
+	}
+
+	ledger.intervals = eventOutput.MergeQueryIntervals(append(ledger.intervals, intervals...))
+
+	return nil
+}
+
+//reset clears the ledger, used when an ffs query is restarted from a new time
+func (ledger *coverageLedger) reset() {
+	ledger.mutex.Lock()
+	defer ledger.mutex.Unlock()
+
+	ledger.intervals = nil
+
+	err := eventOutput.WriteCoverage(ledger.query, ledger.intervals)
+
+	if err != nil {
+		panic(err)
+	}
+}
+
+//start returns the start of the first completed interval in the ledger, empty if nothing has been completed
+func (ledger *coverageLedger) start() time.Time {
+	ledger.mutex.Lock()
+	defer ledger.mutex.Unlock()
+
+	if len(ledger.intervals) == 0 {
+		return time.Time{}
+	}
+
+	return ledger.intervals[0].OnOrAfter
+}
+
+/*
+gaps - finds the holes in the ledger from the start of the query's coverage up to onOrBefore
+The ledger's file is read again first, so windows recorded by another process are not reported as holes
+If the query has no start, holes are looked for from its first completed interval
+inFlight - windows which are currently being fetched and should not be reported as holes
+*/
+func (ledger *coverageLedger) gaps(onOrBefore time.Time, inFlight []eventOutput.InProgressQuery) []eventOutput.InProgressQuery {
+	ledger.mutex.Lock()
+	defer ledger.mutex.Unlock()
+
+	//windows backfilled by another process are not holes
+	err := ledger.load()
+
+	if err != nil {
+		log.Println("error reading coverage for ffs query: " + ledger.query.Name + ", looking for holes in the coverage already read: " + err.Error())
+	}
+
+	from := ledger.from
+	if from == (time.Time{}) {
+		if len(ledger.intervals) == 0 {
+			return nil
+		}
+		from = ledger.intervals[0].OnOrAfter
+	}
+
+	span := eventOutput.InProgressQuery{
+		OnOrAfter:  from,
+		OnOrBefore: onOrBefore,
+	}
+
+	var covered []eventOutput.InProgressQuery
+	covered = append(covered, ledger.intervals...)
+	covered = append(covered, inFlight...)
+
+	return eventOutput.FindQueryIntervalGaps(span, covered)
+}
+
+/*
+auditCoverage - finds holes in the coverage of an ffs query up to its last completed query and re-runs queryFetcher for them
+Holes are fetched one window at a time so that the audit does not compete with the live tail for more than a single query
+*/
+func auditCoverage(query config.FFSQuery, ledger *coverageLedger, progress *queryProgress, session *authSession, configuration config.Config, maxTime time.Time, output searchOutput) {
+	lastCompletedQuery := progress.lastCompleted()
+	if lastCompletedQuery == (eventOutput.InProgressQuery{}) {
+		return
+	}
+
+	gaps := ledger.gaps(lastCompletedQuery.OnOrBefore, progress.inProgress())
+
+	var uncovered time.Duration
+	for _, gap := range gaps {
+		uncovered = uncovered + gap.OnOrBefore.Sub(gap.OnOrAfter) + time.Millisecond
+	}
+	promMetrics.SetUncoveredSeconds(query.Name, uncovered.Seconds())
+
+	if len(gaps) == 0 {
+		return
+	}
+
+	log.Println("Found " + strconv.Itoa(len(gaps)) + " holes totaling " + uncovered.String() + " in the coverage of ffs query: " + query.Name)
+
+	timeGap, _ := time.ParseDuration(query.TimeGap)
+	for _, gap := range gaps {
+		for _, window := range splitTimeRange(gap, timeGap) {
+			log.Println("Re-querying " + window.OnOrAfter.String() + " to " + window.OnOrBefore.String() + " for ffs query: " + query.Name)
+			windowQuery := setOnOrBeforeAndAfter(query, window.OnOrBefore, window.OnOrAfter)
+			queryFetcher(windowQuery, progress, session, configuration, maxTime, true, output, nil, ledger)
+		}
+	}
+
+	promMetrics.SetUncoveredSeconds(query.Name, 0)
+}
@@ -0,0 +1,127 @@
+package ffsEvent
+
+import (
+	"github.com/BenB196/crashplan-ffs-puller/eventOutput"
+	"reflect"
+	"testing"
+	"time"
+)
+
+//testWindow builds an InProgressQuery from two RFC3339 times
+func testWindow(t *testing.T, onOrAfter string, onOrBefore string) eventOutput.InProgressQuery {
+	t.Helper()
+
+	return eventOutput.InProgressQuery{OnOrAfter: testTime(t, onOrAfter), OnOrBefore: testTime(t, onOrBefore)}
+}
+
+func TestCoverageLedgerGaps(t *testing.T) {
+	covered := []eventOutput.InProgressQuery{
+		testWindow(t, "2020-01-01T01:00:00Z", "2020-01-01T02:00:00Z"),
+		testWindow(t, "2020-01-01T03:00:00Z", "2020-01-01T04:00:00Z"),
+	}
+	onOrBefore := testTime(t, "2020-01-01T05:00:00Z")
+
+	tests := []struct {
+		name      string
+		from      time.Time
+		intervals []eventOutput.InProgressQuery
+		inFlight  []eventOutput.InProgressQuery
+		want      []eventOutput.InProgressQuery
+	}{
+		{
+			name: "nothing completed and no start",
+			want: nil,
+		},
+		{
+			name:      "without a start holes are looked for from the first completed interval",
+			intervals: covered,
+			want: []eventOutput.InProgressQuery{
+				testWindow(t, "2020-01-01T02:00:00.001Z", "2020-01-01T02:59:59.999Z"),
+				testWindow(t, "2020-01-01T04:00:00.001Z", "2020-01-01T05:00:00Z"),
+			},
+		},
+		{
+			name:      "with a start the time before the first completed interval is a hole",
+			from:      testTime(t, "2020-01-01T00:00:00Z"),
+			intervals: covered,
+			want: []eventOutput.InProgressQuery{
+				testWindow(t, "2020-01-01T00:00:00Z", "2020-01-01T00:59:59.999Z"),
+				testWindow(t, "2020-01-01T02:00:00.001Z", "2020-01-01T02:59:59.999Z"),
+				testWindow(t, "2020-01-01T04:00:00.001Z", "2020-01-01T05:00:00Z"),
+			},
+		},
+		{
+			name:      "in flight windows are not holes",
+			intervals: covered,
+			inFlight:  []eventOutput.InProgressQuery{testWindow(t, "2020-01-01T02:00:00.001Z", "2020-01-01T02:59:59.999Z")},
+			want:      []eventOutput.InProgressQuery{testWindow(t, "2020-01-01T04:00:00.001Z", "2020-01-01T05:00:00Z")},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			query := testQuery("", "", "1h")
+			query.OutputLocation = t.TempDir() + "/"
+
+			ledger := &coverageLedger{query: query, from: test.from, intervals: test.intervals}
+
+			got := ledger.gaps(onOrBefore, test.inFlight)
+
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("gaps = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCoverageLedgerSharedWithBackfill(t *testing.T) {
+	query := testQuery("", "", "1h")
+	query.OutputLocation = t.TempDir() + "/"
+
+	tail, err := newCoverageLedger(query, eventOutput.InProgressQuery{}, time.Time{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, window := range []eventOutput.InProgressQuery{
+		testWindow(t, "2020-01-01T00:00:00Z", "2020-01-01T01:00:00Z"),
+		testWindow(t, "2020-01-01T03:00:00.001Z", "2020-01-01T04:00:00Z"),
+	} {
+		if err := tail.add(window); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	//a backfill in another process loads the same file and fills the hole
+	backfill, err := newCoverageLedger(query, eventOutput.InProgressQuery{}, time.Time{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := backfill.add(testWindow(t, "2020-01-01T01:00:00.001Z", "2020-01-01T03:00:00Z")); err != nil {
+		t.Fatal(err)
+	}
+
+	//the tail's audit no longer sees the hole, so it is not pulled again
+	if gaps := tail.gaps(testTime(t, "2020-01-01T04:00:00Z"), nil); len(gaps) != 0 {
+		t.Errorf("gaps = %v, want none after the backfill", gaps)
+	}
+
+	//and the tail's next window does not overwrite the backfilled one
+	if err := tail.add(testWindow(t, "2020-01-01T04:00:00.001Z", "2020-01-01T05:00:00Z")); err != nil {
+		t.Fatal(err)
+	}
+
+	coverage, _, err := eventOutput.ReadCoverage(query)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []eventOutput.InProgressQuery{testWindow(t, "2020-01-01T00:00:00Z", "2020-01-01T05:00:00Z")}
+	if !reflect.DeepEqual(coverage, want) {
+		t.Errorf("coverage = %v, want %v", coverage, want)
+	}
+}
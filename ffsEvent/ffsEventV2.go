@@ -0,0 +1,269 @@
+package ffsEvent
+
+import (
+	"github.com/BenB196/crashplan-ffs-go-pkg"
+	"github.com/BenB196/crashplan-ffs-puller/config"
+	"strings"
+)
+
+//Structs of the Code42 v2 file event schema
+type V2FileEventResponse struct {
+	FileEvents  []V2FileEvent      `json:"fileEvents,omitempty"`
+	NextPgToken string             `json:"nextPgToken,omitempty"`
+	Problems    []ffs.QueryProblem `json:"problems,omitempty"`
+	TotalCount  *int64             `json:"totalCount,omitempty"`
+}
+
+type V2FileEvent struct {
+	Timestamp   string        `json:"@timestamp,omitempty"`
+	Event       V2Event       `json:"event,omitempty"`
+	User        V2User        `json:"user,omitempty"`
+	File        V2File        `json:"file,omitempty"`
+	Source      V2Source      `json:"source,omitempty"`
+	Destination V2Destination `json:"destination,omitempty"`
+	Process     V2Process     `json:"process,omitempty"`
+	Risk        V2Risk        `json:"risk,omitempty"`
+}
+
+type V2Event struct {
+	Id        string   `json:"id,omitempty"`
+	Inserted  string   `json:"inserted,omitempty"`
+	Action    string   `json:"action,omitempty"`
+	Observer  string   `json:"observer,omitempty"`
+	ShareType []string `json:"shareType,omitempty"`
+}
+
+type V2User struct {
+	Email     string `json:"email,omitempty"`
+	Id        string `json:"id,omitempty"`
+	DeviceUid string `json:"deviceUid,omitempty"`
+}
+
+type V2File struct {
+	Name                string   `json:"name,omitempty"`
+	Directory           string   `json:"directory,omitempty"`
+	DirectoryId         []string `json:"directoryId,omitempty"`
+	Category            string   `json:"category,omitempty"`
+	CategoryByBytes     string   `json:"categoryByBytes,omitempty"`
+	CategoryByExtension string   `json:"categoryByExtension,omitempty"`
+	MimeTypeByBytes     string   `json:"mimeTypeByBytes,omitempty"`
+	MimeTypeByExtension string   `json:"mimeTypeByExtension,omitempty"`
+	SizeInBytes         *int64   `json:"sizeInBytes,omitempty"`
+	Owner               string   `json:"owner,omitempty"`
+	Created             string   `json:"created,omitempty"`
+	Modified            string   `json:"modified,omitempty"`
+	Hash                V2Hash   `json:"hash,omitempty"`
+	Id                  string   `json:"id,omitempty"`
+	Url                 string   `json:"url,omitempty"`
+	CloudDriveId        string   `json:"cloudDriveId,omitempty"`
+}
+
+type V2Hash struct {
+	Md5    string `json:"md5,omitempty"`
+	Sha256 string `json:"sha256,omitempty"`
+}
+
+type V2Source struct {
+	Category       string            `json:"category,omitempty"`
+	Name           string            `json:"name,omitempty"`
+	Domain         string            `json:"domain,omitempty"`
+	Ip             string            `json:"ip,omitempty"`
+	PrivateIp      []string          `json:"privateIp,omitempty"`
+	User           V2SourceUser      `json:"user,omitempty"`
+	Email          V2SourceEmail     `json:"email,omitempty"`
+	RemovableMedia *V2RemovableMedia `json:"removableMedia,omitempty"`
+	Tabs           []ffs.Tab         `json:"tabs,omitempty"`
+}
+
+type V2SourceUser struct {
+	Email []string `json:"email,omitempty"`
+}
+
+type V2SourceEmail struct {
+	Sender string `json:"sender,omitempty"`
+	From   string `json:"from,omitempty"`
+}
+
+type V2Destination struct {
+	Category       string             `json:"category,omitempty"`
+	Name           string             `json:"name,omitempty"`
+	User           V2DestinationUser  `json:"user,omitempty"`
+	Email          V2DestinationEmail `json:"email,omitempty"`
+	PrintJobName   string             `json:"printJobName,omitempty"`
+	PrinterName    string             `json:"printerName,omitempty"`
+	RemovableMedia *V2RemovableMedia  `json:"removableMedia,omitempty"`
+	Tabs           []ffs.Tab          `json:"tabs,omitempty"`
+}
+
+type V2DestinationUser struct {
+	Email []string `json:"email,omitempty"`
+}
+
+type V2DestinationEmail struct {
+	Recipients []string `json:"recipients,omitempty"`
+	Subject    string   `json:"subject,omitempty"`
+}
+
+type V2RemovableMedia struct {
+	Vendor       string   `json:"vendor,omitempty"`
+	Name         string   `json:"name,omitempty"`
+	SerialNumber string   `json:"serialNumber,omitempty"`
+	Capacity     *int64   `json:"capacity,omitempty"`
+	BusType      string   `json:"busType,omitempty"`
+	MediaName    string   `json:"mediaName,omitempty"`
+	VolumeName   []string `json:"volumeName,omitempty"`
+	PartitionId  []string `json:"partitionId,omitempty"`
+}
+
+type V2Process struct {
+	Executable string `json:"executable,omitempty"`
+	Owner      string `json:"owner,omitempty"`
+}
+
+type V2Risk struct {
+	Score      *int64        `json:"score,omitempty"`
+	Severity   string        `json:"severity,omitempty"`
+	Indicators []V2Indicator `json:"indicators,omitempty"`
+	Trusted    *bool         `json:"trusted,omitempty"`
+}
+
+type V2Indicator struct {
+	Name   string `json:"name,omitempty"`
+	Weight *int64 `json:"weight,omitempty"`
+}
+
+//v1 event types and their v2 event actions
+var v1ToV2EventTypes = map[string]string{
+	"CREATED":     "file-created",
+	"MODIFIED":    "file-modified",
+	"DELETED":     "file-deleted",
+	"READ_BY_APP": "application-read",
+	"EMAILED":     "file-emailed",
+	"PRINTED":     "file-printed",
+}
+
+/*
+translateQueryToV2 - converts the v1 terms and event type values of a query into their v2 equivalents
+The groups and filters are copied, so the query passed in is left untouched
+*/
+func translateQueryToV2(query ffs.Query) ffs.Query {
+	groups := make([]ffs.Group, len(query.Groups))
+	for i, group := range query.Groups {
+		filters := make([]ffs.SearchFilter, len(group.Filters))
+		for j, filter := range group.Filters {
+			if filter.Term == "eventType" {
+				if action, found := v1ToV2EventTypes[filter.Value]; found {
+					filter.Value = action
+				}
+			}
+			if term, found := config.V2Terms[filter.Term]; found {
+				filter.Term = term
+			}
+			filters[j] = filter
+		}
+		group.Filters = filters
+		groups[i] = group
+	}
+	query.Groups = groups
+
+	return query
+}
+
+//v2ToV1EventType converts a v2 event action back into a v1 event type, unknown actions are upper cased
+func v2ToV1EventType(action string) string {
+	for eventType, v2Action := range v1ToV2EventTypes {
+		if v2Action == action {
+			return eventType
+		}
+	}
+
+	return strings.ToUpper(strings.ReplaceAll(action, "-", "_"))
+}
+
+/*
+mapV2FileEvent - maps a v2 file event into the v1 file event, so that both api versions share the same output models
+The risk indicators are kept beside the v1 fields, other v2 fields which have no v1 equivalent are dropped
+*/
+func mapV2FileEvent(event V2FileEvent) fileEvent {
+	jsonFileEvent := ffs.JsonFileEvent{
+		EventId:                 event.Event.Id,
+		EventType:               v2ToV1EventType(event.Event.Action),
+		EventTimestamp:          event.Timestamp,
+		InsertionTimestamp:      event.Event.Inserted,
+		Source:                  event.Event.Observer,
+		SharingTypeAdded:        event.Event.ShareType,
+		DeviceUserName:          event.User.Email,
+		UserUid:                 event.User.Id,
+		DeviceUid:               event.User.DeviceUid,
+		FileName:                event.File.Name,
+		FilePath:                event.File.Directory,
+		DirectoryId:             event.File.DirectoryId,
+		FileCategory:            event.File.Category,
+		FileCategoryByBytes:     event.File.CategoryByBytes,
+		FileCategoryByExtension: event.File.CategoryByExtension,
+		MimeTypeByBytes:         event.File.MimeTypeByBytes,
+		MimeTypeByExtension:     event.File.MimeTypeByExtension,
+		FileSize:                event.File.SizeInBytes,
+		FileOwner:               event.File.Owner,
+		CreateTimestamp:         event.File.Created,
+		ModifyTimestamp:         event.File.Modified,
+		Md5Checksum:             event.File.Hash.Md5,
+		Sha256Checksum:          event.File.Hash.Sha256,
+		FileId:                  event.File.Id,
+		Url:                     event.File.Url,
+		CloudDriveId:            event.File.CloudDriveId,
+		OsHostName:              event.Source.Name,
+		DomainName:              event.Source.Domain,
+		PublicIpAddress:         event.Source.Ip,
+		PrivateIpAddresses:      event.Source.PrivateIp,
+		EmailSender:             event.Source.Email.Sender,
+		EmailFrom:               event.Source.Email.From,
+		DestinationCategory:     event.Destination.Category,
+		DestinationName:         event.Destination.Name,
+		SyncDestinationUsername: event.Destination.User.Email,
+		EmailRecipients:         event.Destination.Email.Recipients,
+		EmailSubject:            event.Destination.Email.Subject,
+		PrintJobName:            event.Destination.PrintJobName,
+		PrinterName:             event.Destination.PrinterName,
+		ProcessName:             event.Process.Executable,
+		ProcessOwner:            event.Process.Owner,
+		Trusted:                 event.Risk.Trusted,
+	}
+
+	//Tabs are on the destination for uploads and on the source for downloads
+	jsonFileEvent.Tabs = event.Destination.Tabs
+	if len(jsonFileEvent.Tabs) == 0 {
+		jsonFileEvent.Tabs = event.Source.Tabs
+	}
+	for _, tab := range jsonFileEvent.Tabs {
+		jsonFileEvent.WindowTitle = append(jsonFileEvent.WindowTitle, tab.Title)
+	}
+	if len(jsonFileEvent.Tabs) > 0 {
+		jsonFileEvent.TabUrl = jsonFileEvent.Tabs[0].Url
+	}
+
+	//Removable media is on the destination when copied to it and on the source when copied from it
+	removableMedia := event.Destination.RemovableMedia
+	if removableMedia == nil {
+		removableMedia = event.Source.RemovableMedia
+	}
+	if removableMedia != nil {
+		jsonFileEvent.RemovableMediaVendor = removableMedia.Vendor
+		jsonFileEvent.RemovableMediaName = removableMedia.Name
+		jsonFileEvent.RemovableMediaSerialNumber = removableMedia.SerialNumber
+		jsonFileEvent.RemovableMediaCapacity = removableMedia.Capacity
+		jsonFileEvent.RemovableMediaBusType = removableMedia.BusType
+		jsonFileEvent.RemovableMediaMediaName = removableMedia.MediaName
+		jsonFileEvent.RemovableMediaVolumeName = removableMedia.VolumeName
+		jsonFileEvent.RemovableMediaPartitionId = removableMedia.PartitionId
+	}
+
+	mapped := fileEvent{JsonFileEvent: jsonFileEvent}
+
+	//risk indicators are not exposure types, so they get their own field
+	for _, indicator := range event.Risk.Indicators {
+		mapped.RiskIndicators = append(mapped.RiskIndicators, indicator.Name)
+	}
+
+	return mapped
+}
@@ -0,0 +1,170 @@
+package ffsEvent
+
+import (
+	"github.com/BenB196/crashplan-ffs-go-pkg"
+	"reflect"
+	"testing"
+)
+
+func TestTranslateQueryToV2(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter ffs.SearchFilter
+		want   ffs.SearchFilter
+	}{
+		{
+			name:   "timestamp term",
+			filter: ffs.SearchFilter{Operator: "ON_OR_AFTER", Term: "insertionTimestamp", Value: "2020-01-01T00:00:00.000Z"},
+			want:   ffs.SearchFilter{Operator: "ON_OR_AFTER", Term: "event.inserted", Value: "2020-01-01T00:00:00.000Z"},
+		},
+		{
+			name:   "nested term",
+			filter: ffs.SearchFilter{Operator: "IS", Term: "removableMediaVendor", Value: "SanDisk"},
+			want:   ffs.SearchFilter{Operator: "IS", Term: "destination.removableMedia.vendor", Value: "SanDisk"},
+		},
+		{
+			name:   "event type value is translated to its action",
+			filter: ffs.SearchFilter{Operator: "IS", Term: "eventType", Value: "READ_BY_APP"},
+			want:   ffs.SearchFilter{Operator: "IS", Term: "event.action", Value: "application-read"},
+		},
+		{
+			name:   "unknown event type value is kept",
+			filter: ffs.SearchFilter{Operator: "IS", Term: "eventType", Value: "file-downloaded"},
+			want:   ffs.SearchFilter{Operator: "IS", Term: "event.action", Value: "file-downloaded"},
+		},
+		{
+			name:   "values of other terms are kept",
+			filter: ffs.SearchFilter{Operator: "IS", Term: "fileName", Value: "CREATED"},
+			want:   ffs.SearchFilter{Operator: "IS", Term: "file.name", Value: "CREATED"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			query := ffs.Query{Groups: []ffs.Group{{Filters: []ffs.SearchFilter{test.filter}, FilterClause: "AND"}}, GroupClause: "AND", PgSize: 100}
+
+			got := translateQueryToV2(query)
+
+			want := ffs.Query{Groups: []ffs.Group{{Filters: []ffs.SearchFilter{test.want}, FilterClause: "AND"}}, GroupClause: "AND", PgSize: 100}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("translateQueryToV2 = %+v, want %+v", got, want)
+			}
+
+			//the query passed in is left untouched
+			if query.Groups[0].Filters[0] != test.filter {
+				t.Errorf("query was changed to %+v", query.Groups[0].Filters[0])
+			}
+		})
+	}
+}
+
+func TestMapV2FileEvent(t *testing.T) {
+	capacity := int64(64)
+	score := int64(9)
+
+	tests := []struct {
+		name  string
+		event V2FileEvent
+		want  fileEvent
+	}{
+		{
+			name: "event, user, and file",
+			event: V2FileEvent{
+				Timestamp: "2020-01-01T00:00:00.000Z",
+				Event:     V2Event{Id: "1", Inserted: "2020-01-01T00:01:00.000Z", Action: "file-created", Observer: "Endpoint"},
+				User:      V2User{Email: "user@example.com", Id: "2", DeviceUid: "3"},
+				File:      V2File{Name: "a.txt", Directory: "/home/user/", Hash: V2Hash{Md5: "md5", Sha256: "sha256"}},
+			},
+			want: fileEvent{JsonFileEvent: ffs.JsonFileEvent{
+				EventId:            "1",
+				EventType:          "CREATED",
+				EventTimestamp:     "2020-01-01T00:00:00.000Z",
+				InsertionTimestamp: "2020-01-01T00:01:00.000Z",
+				Source:             "Endpoint",
+				DeviceUserName:     "user@example.com",
+				UserUid:            "2",
+				DeviceUid:          "3",
+				FileName:           "a.txt",
+				FilePath:           "/home/user/",
+				Md5Checksum:        "md5",
+				Sha256Checksum:     "sha256",
+			}},
+		},
+		{
+			name:  "unknown action is upper cased",
+			event: V2FileEvent{Event: V2Event{Action: "file-downloaded"}},
+			want:  fileEvent{JsonFileEvent: ffs.JsonFileEvent{EventType: "FILE_DOWNLOADED"}},
+		},
+		{
+			name: "risk indicators get their own field, not the exposure",
+			event: V2FileEvent{Event: V2Event{Action: "file-created"}, Risk: V2Risk{
+				Score:      &score,
+				Indicators: []V2Indicator{{Name: "Remote operations"}, {Name: "File mismatch"}},
+			}},
+			want: fileEvent{JsonFileEvent: ffs.JsonFileEvent{EventType: "CREATED"}, RiskIndicators: []string{"Remote operations", "File mismatch"}},
+		},
+		{
+			name: "removable media and tabs from the source",
+			event: V2FileEvent{Event: V2Event{Action: "file-created"}, Source: V2Source{
+				RemovableMedia: &V2RemovableMedia{Vendor: "SanDisk", Capacity: &capacity},
+				Tabs:           []ffs.Tab{{Title: "Downloads", Url: "https://example.com/a.txt"}},
+			}},
+			want: fileEvent{JsonFileEvent: ffs.JsonFileEvent{
+				EventType:              "CREATED",
+				RemovableMediaVendor:   "SanDisk",
+				RemovableMediaCapacity: &capacity,
+				Tabs:                   []ffs.Tab{{Title: "Downloads", Url: "https://example.com/a.txt"}},
+				WindowTitle:            []string{"Downloads"},
+				TabUrl:                 "https://example.com/a.txt",
+			}},
+		},
+		{
+			name: "destination removable media and tabs are used over the source",
+			event: V2FileEvent{
+				Event:       V2Event{Action: "file-created"},
+				Source:      V2Source{RemovableMedia: &V2RemovableMedia{Vendor: "Source"}, Tabs: []ffs.Tab{{Title: "Source"}}},
+				Destination: V2Destination{RemovableMedia: &V2RemovableMedia{Vendor: "Destination"}, Tabs: []ffs.Tab{{Title: "Destination", Url: "https://example.com"}}},
+			},
+			want: fileEvent{JsonFileEvent: ffs.JsonFileEvent{
+				EventType:            "CREATED",
+				RemovableMediaVendor: "Destination",
+				Tabs:                 []ffs.Tab{{Title: "Destination", Url: "https://example.com"}},
+				WindowTitle:          []string{"Destination"},
+				TabUrl:               "https://example.com",
+			}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := mapV2FileEvent(test.event)
+
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("mapV2FileEvent\n got %+v\nwant %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFFSSearchURI(t *testing.T) {
+	tests := []struct {
+		ffsURI     string
+		apiVersion string
+		want       string
+	}{
+		{ffsURI: "https://example.com/forensic-search/queryservice/api/v1/fileevent/export", apiVersion: "v1", want: "https://example.com/forensic-search/queryservice/api/v1/fileevent"},
+		{ffsURI: "https://example.com/forensic-search/queryservice/api/v1/fileevent", apiVersion: "v1", want: "https://example.com/forensic-search/queryservice/api/v1/fileevent"},
+		{ffsURI: "https://api.us.code42.com/v2/file-events", apiVersion: "v2", want: "https://api.us.code42.com/v2/file-events"},
+		{ffsURI: "https://api.us.code42.com/v2/file-events/export", apiVersion: "v2", want: "https://api.us.code42.com/v2/file-events"},
+		{ffsURI: "https://api.us.code42.com/forensic-search/queryservice/api/v1/fileevent/export?a=b", apiVersion: "v2", want: "https://api.us.code42.com/v2/file-events"},
+		{ffsURI: "https://api.us.code42.com:8443", apiVersion: "v2", want: "https://api.us.code42.com:8443/v2/file-events"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.apiVersion+" "+test.ffsURI, func(t *testing.T) {
+			if got := ffsSearchURI(test.ffsURI, test.apiVersion); got != test.want {
+				t.Errorf("ffsSearchURI = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
@@ -2,15 +2,12 @@ package ffsEvent
 
 import (
 	"bufio"
-	"context"
 	"encoding/json"
-	"github.com/BenB196/crashplan-ffs-go-pkg"
 	"github.com/BenB196/crashplan-ffs-puller/config"
 	"github.com/BenB196/crashplan-ffs-puller/elasticsearch"
 	"github.com/BenB196/crashplan-ffs-puller/eventOutput"
 	"github.com/BenB196/crashplan-ffs-puller/promMetrics"
 	"github.com/BenB196/ip-api-go-pkg"
-	"github.com/olivere/elastic/v7"
 	"log"
 	"path/filepath"
 	"strconv"
@@ -19,14 +16,115 @@ import (
 	"time"
 )
 
-func queryFetcher(query config.FFSQuery, inProgressQueries *[]eventOutput.InProgressQuery, authData ffs.AuthData, configuration config.Config, lastCompletedQuery *eventOutput.InProgressQuery, maxTime time.Time, cleanUpQuery bool, client *elastic.Client, ctx context.Context, quit chan<- struct{}, retryCount int, retryQuery bool) {
+//Number of events per page for search mode queries which do not set a pgSize
+const defaultSearchPageSize = 10000
+
+/*
+queryProgress holds the in progress queries and the last completed query of an ffs query
+They are shared by the query's tail, catch up, and coverage audit goroutines, so they are only read and written with the mutex held
+*/
+type queryProgress struct {
+	mutex              sync.Mutex
+	inProgressQueries  []eventOutput.InProgressQuery
+	lastCompletedQuery eventOutput.InProgressQuery
+}
+
+//inProgress returns a copy of the in progress queries
+func (progress *queryProgress) inProgress() []eventOutput.InProgressQuery {
+	progress.mutex.Lock()
+	defer progress.mutex.Unlock()
+
+	return append([]eventOutput.InProgressQuery(nil), progress.inProgressQueries...)
+}
+
+//lastCompleted returns the last completed query
+func (progress *queryProgress) lastCompleted() eventOutput.InProgressQuery {
+	progress.mutex.Lock()
+	defer progress.mutex.Unlock()
+
+	return progress.lastCompletedQuery
+}
+
+/*
+next - works out the next window of the live tail and adds it to the in progress queries
+Working out the window and adding it happen under one lock, so that two tail goroutines never pick the same window
+Returns
+config.FFSQuery - the query with the next window's times
+*eventOutput.InProgressQuery - the next window
+bool - whether the max time has been reached
+error - errWindowNotReady if the next window cannot be pulled yet, or any other errors which have been caught
+*/
+func (progress *queryProgress) next(query config.FFSQuery, maxTime time.Time) (config.FFSQuery, *eventOutput.InProgressQuery, bool, error) {
+	progress.mutex.Lock()
+	defer progress.mutex.Unlock()
+
+	query, done, err := calculateTimeStamps(progress.inProgressQueries, progress.lastCompletedQuery, query, maxTime)
+
+	if err != nil || done {
+		return query, nil, done, err
+	}
+
+	window, err := getOnOrBeforeAndAfter(query)
+
+	if err != nil {
+		return query, nil, false, err
+	}
+
+	progress.inProgressQueries = append(progress.inProgressQueries, *window)
+
+	//Write in progress queries to file
+	err = eventOutput.WriteInProgressQueries(query, progress.inProgressQueries)
+
+	return query, window, false, err
+}
+
+/*
+complete - records a window as completed, moving the last completed query forward if it is the newest window
+and removing the in progress query with exactly the same times, windows which only share a boundary with it are kept
+Returns
+error - any errors which have been caught
+*/
+func (progress *queryProgress) complete(query config.FFSQuery, window eventOutput.InProgressQuery) error {
+	progress.mutex.Lock()
+	defer progress.mutex.Unlock()
+
+	//Check if this query is the newest completed query, if it is, set last completed query to query times
+	if progress.lastCompletedQuery.OnOrBefore.Sub(window.OnOrAfter) <= 0 {
+		progress.lastCompletedQuery = window
+
+		err := eventOutput.WriteLastCompletedQuery(query, window)
+		if err != nil {
+			return err
+		}
+	}
+
+	//Remove from in progress query slice
+	var inProgressQueries []eventOutput.InProgressQuery
+	for _, inProgressQuery := range progress.inProgressQueries {
+		if inProgressQuery != window {
+			inProgressQueries = append(inProgressQueries, inProgressQuery)
+		}
+	}
+	progress.inProgressQueries = inProgressQueries
+
+	//Write in progress queries to file
+	return eventOutput.WriteInProgressQueries(query, progress.inProgressQueries)
+}
+
+func queryFetcher(query config.FFSQuery, progress *queryProgress, session *authSession, configuration config.Config, maxTime time.Time, cleanUpQuery bool, output searchOutput, quit chan<- struct{}, ledger *coverageLedger) {
 	startTime := time.Now()
+	var inProgressQuery *eventOutput.InProgressQuery
 	var done bool
 	var err error
-	//Increment time
+	//Increment time and add the window to the in progress queries
 	//Only if it is not a catchup query (in progress queries when the app died)
-	if !cleanUpQuery && !retryQuery {
-		query, done, err = calculateTimeStamps(*inProgressQueries, *lastCompletedQuery, query, maxTime)
+	if !cleanUpQuery {
+		query, inProgressQuery, done, err = progress.next(query, maxTime)
+
+		//Skip this interval if the next query is not ready to be pulled yet
+		if err == errWindowNotReady {
+			return
+		}
 
 		if err != nil {
 			panic(err)
@@ -43,59 +141,146 @@ func queryFetcher(query config.FFSQuery, inProgressQueries *[]eventOutput.InProg
 	cleanUpQueryTime := time.Now()
 
 	//increase in progress queries
-	if !retryQuery {
-		promMetrics.IncreaseInProgressQueries()
-	}
+	promMetrics.IncreaseInProgressQueries()
 
-	//Add query interval to in progress query list
-	inProgressQuery, err := getOnOrBeforeAndAfter(query)
-	if err != nil {
-		panic(err)
+	if cleanUpQuery {
+		inProgressQuery, err = getOnOrBeforeAndAfter(query)
+		if err != nil {
+			panic(err)
+		}
 	}
 
 	onOrBeforeAndAfterTime := time.Now()
 
-	if !cleanUpQuery && !retryQuery {
-		*inProgressQueries = append(*inProgressQueries, *inProgressQuery)
+	notInProgressTime := time.Now()
+
+	stats := processWindow(query, *inProgressQuery, session, configuration, output)
 
-		//Write in progress queries to file
-		err := eventOutput.WriteInProgressQueries(query, *inProgressQueries)
+	outputTime := time.Now()
+
+	//Record the window in the coverage ledger
+	if ledger != nil {
+		err = ledger.add(*inProgressQuery)
 
 		if err != nil {
 			panic(err)
 		}
 	}
 
-	notInProgressTime := time.Now()
+	writeLastCompletedQueryTime := time.Now()
 
-	fileEvents, _, err := ffs.GetJsonFileEvents(authData, configuration.FFSURI, query.Query, "", configuration.Debugging)
+	err = progress.complete(query, *inProgressQuery)
 
-	getFileEventsTime := time.Now()
+	removeInProgressQueryTime := time.Now()
 
 	if err != nil {
-		log.Println("error getting file events for ffs query: " + query.Name)
-		//check if recoverable errors are thrown
-		if strings.Contains(err.Error(), "Error with gathering file events POST: 500 Internal Server Error") || (strings.Contains(err.Error(), "stream error: stream ID") && (strings.Contains(err.Error(), "INTERNAL_ERROR") || strings.Contains(err.Error(), "PROTOCOL_ERROR"))) || strings.Contains(err.Error(), "read: connection reset by peer") || strings.Contains(err.Error(), "POST: 400 Bad Request") || strings.Contains(err.Error(), "unexpected EOF") || strings.Contains(err.Error(), "POST: 504 Gateway Timeout") || (strings.Contains(err.Error(), "record on line ") && strings.Contains(err.Error(), ": wrong number of fields") || (strings.Contains(err.Error(), "record on line") && strings.Contains(err.Error(), "; parse error on line") && strings.Contains(err.Error(), ", column") && strings.Contains(err.Error(), ": extraneous or missing \" in quoted-field"))) {
-			//allow for 10 retries before killing to save resource overload.
-			log.Println("Attempting to recover from error: " + err.Error() + ". Retry number: " + strconv.Itoa(retryCount))
-			if retryCount <= 10 {
-				queryInterval, _ := time.ParseDuration(query.Interval)
-				//sleep before retry to reduce chance of hitting max queries per minute
-				time.Sleep(queryInterval)
-				retryCount = retryCount + 1
-				queryFetcher(query, inProgressQueries, authData, configuration, lastCompletedQuery, maxTime, cleanUpQuery, client, ctx, quit, retryCount, true)
-				return
-			} else {
-				//panic passed 10 retries
-				panic("Failed on retry of query 10 times. Panicking to prevent unrecoverable resource utilization for ffs query: " + query.Name)
-			}
-		} else {
-			//panic if unrecoverable/unknown error
-			panic(err)
+		panic(err)
+	}
+
+	promMetrics.IncrementEventsProcessed(stats.events)
+	promMetrics.DecreaseInProgressQueries()
+	endTime := time.Now()
+	duration := endTime.Sub(startTime)
+	cleanupDuration := cleanUpQueryTime.Sub(startTime)
+	onOrBeforeAndAfterDuration := onOrBeforeAndAfterTime.Sub(cleanUpQueryTime)
+	notInProgressDuration := notInProgressTime.Sub(onOrBeforeAndAfterTime)
+	writeLastCompletedQueryDuration := writeLastCompletedQueryTime.Sub(outputTime)
+	removeInProgressQueryDuration := removeInProgressQueryTime.Sub(writeLastCompletedQueryTime)
+	log.Println("Number of events for query: " + query.Name + " - " + strconv.Itoa(stats.events) +
+		" - Clean Up Duration: " + cleanupDuration.String() + " - " +
+		"On Or Before And After Duration: " + onOrBeforeAndAfterDuration.String() + " - Not In-progress Duration: " +
+		notInProgressDuration.String() + " - Get File Events Duration: " + stats.getFileEvents.String() +
+		" - Enrichment Duration: " + stats.enrichment.String() + " - Output Duration: " + stats.output.String() +
+		" - Write Last Completed Query Duration: " + writeLastCompletedQueryDuration.String() +
+		" - Remove In Progress Query Duration: " + removeInProgressQueryDuration.String() + " - Duration: " + duration.String())
+}
+
+//windowStats keeps track of the number of events in a window and how long each stage of processing it took
+type windowStats struct {
+	events        int
+	getFileEvents time.Duration
+	enrichment    time.Duration
+	output        time.Duration
+}
+
+/*
+processWindow - fetches, enriches, and outputs the file events of a single query window
+This does not touch any of the in progress or last completed query state, that is left up to the caller
+query - ffs query with its ON_OR_AFTER and ON_OR_BEFORE already set to the window
+inProgressQuery - the window being processed
+Returns
+windowStats - the number of events processed and the stage durations
+*/
+func processWindow(query config.FFSQuery, inProgressQuery eventOutput.InProgressQuery, session *authSession, configuration config.Config, output searchOutput) windowStats {
+	if query.FetchMode == "search" {
+		return processWindowPages(query, inProgressQuery, session, configuration, output)
+	}
+
+	startTime := time.Now()
+
+	//Each attempt waits for the shared scheduler to hand this query a fetch slot
+	fileEvents := getFileEventsWithRetry(query, session, configuration)
+
+	getFileEventsDuration := time.Since(startTime)
+
+	stats := outputEvents(query, inProgressQuery, fileEvents, configuration, output)
+	stats.getFileEvents = getFileEventsDuration
+
+	return stats
+}
+
+/*
+processWindowPages - fetches, enriches, and outputs the file events of a single query window one page at a time
+After each page is output the token of the next page is checkpointed, so a window which was interrupted picks up from the page it stopped on
+*/
+func processWindowPages(query config.FFSQuery, inProgressQuery eventOutput.InProgressQuery, session *authSession, configuration config.Config, output searchOutput) windowStats {
+	var stats windowStats
+
+	pgToken, page := getPageCheckpoint(query, inProgressQuery)
+	if page > 1 {
+		log.Println("Resuming ffs query: " + query.Name + " at page " + strconv.Itoa(page) + " of window " + inProgressQuery.OnOrAfter.String() + " to " + inProgressQuery.OnOrBefore.String())
+	}
+
+	for {
+		startTime := time.Now()
+
+		//Each attempt waits for the shared scheduler to hand this query a fetch slot
+		fileEventResponse := getFileEventPageWithRetry(query, session, configuration, pgToken)
+
+		getFileEventsDuration := time.Since(startTime)
+
+		//Each page is output to its own file
+		pageQuery := query
+		pageQuery.Query.PgNum = page
+		pageStats := outputEvents(pageQuery, inProgressQuery, &fileEventResponse.FileEvents, configuration, output)
+
+		stats.events = stats.events + pageStats.events
+		stats.getFileEvents = stats.getFileEvents + getFileEventsDuration
+		stats.enrichment = stats.enrichment + pageStats.enrichment
+		stats.output = stats.output + pageStats.output
+
+		if fileEventResponse.NextPgToken == "" {
+			clearPageCheckpoint(query, inProgressQuery)
+			return stats
 		}
+
+		pgToken = fileEventResponse.NextPgToken
+		page++
+		setPageCheckpoint(query, inProgressQuery, pgToken, page)
 	}
+}
 
-	retryGetFileEventsTime := time.Now()
+/*
+outputEvents - enriches and outputs a set of file events for a query window
+Returns
+windowStats - the number of events output and the enrichment and output durations
+*/
+func outputEvents(query config.FFSQuery, inProgressQuery eventOutput.InProgressQuery, fileEvents *[]fileEvent, configuration config.Config, output searchOutput) windowStats {
+	var stats windowStats
+	var err error
+
+	getFileEventsTime := time.Now()
+	stats.events = len(*fileEvents)
 
 	//Write events
 	var ffsEvents []eventOutput.FFSEvent
@@ -441,6 +626,7 @@ func queryFetcher(query config.FFSQuery, inProgressQueries *[]eventOutput.InProg
 						CloudDriveId:         ffsEvent.CloudDriveId,
 						DetectionSourceAlias: ffsEvent.DetectionSourceAlias,
 						Exposure:             ffsEvent.Exposure,
+						RiskIndicators:       ffsEvent.RiskIndicators,
 						Process:              process,
 						RemovableMedia: &eventOutput.Code42RemovableMedia{
 							Vendor:       ffsEvent.RemovableMediaVendor,
@@ -504,58 +690,43 @@ func queryFetcher(query config.FFSQuery, inProgressQueries *[]eventOutput.InProg
 			if err != nil {
 				panic(err)
 			}
-		case "elastic":
-			//setup bulk processor
-			var processor *elastic.BulkProcessor
-			processor, err = client.BulkProcessor().Name(query.Name + "BGWorker").Workers(2).Do(ctx)
-
+		case "elastic", "opensearch":
+			//the elastic and opensearch outputs share their index names, the bulk queue is shared by all of the query's windows
 			var elasticWg sync.WaitGroup
 
-			//get index name based off of query end time
-			if query.Elasticsearch.IndexTimeGen == "timeNow" || query.Elasticsearch.IndexTimeGen == "onOrBefore" {
+			//get index name based off of query end time, or the data stream or ilm/ism write alias which roll over on their own
+			if query.Elasticsearch.DataStream.Enabled || elasticsearch.UsesWriteAlias(query.Elasticsearch) || query.Elasticsearch.IndexTimeGen == "timeNow" || query.Elasticsearch.IndexTimeGen == "onOrBefore" {
 				var indexName string
-				if query.Elasticsearch.IndexTimeGen == "timeNow" {
+				if query.Elasticsearch.DataStream.Enabled {
+					indexName = elasticsearch.BuildDataStreamName(query.Elasticsearch)
+				} else if elasticsearch.UsesWriteAlias(query.Elasticsearch) {
+					indexName = query.Elasticsearch.IndexName
+				} else if query.Elasticsearch.IndexTimeGen == "timeNow" {
 					indexName = elasticsearch.BuildIndexName(query.Elasticsearch)
 				} else {
 					indexName = elasticsearch.BuildIndexNameWithTime(query.Elasticsearch, inProgressQuery.OnOrBefore)
 				}
 
-				//check if index exists if not create
-				exists, err := client.IndexExists(indexName).Do(ctx)
-
-				if err != nil {
-					//TODO handle err
-					log.Println("error checking if elastic index exists: " + indexName)
-					panic(err)
-				}
-
-				if !exists {
-					//create index
-					var createIndex *elastic.IndicesCreateResult
-					if !query.Elasticsearch.UseCustomIndexPattern {
-						createIndex, err = client.CreateIndex(indexName).BodyString(elasticsearch.BuildIndexPattern(query.Elasticsearch)).Do(ctx)
-					} else {
-						createIndex, err = client.CreateIndex(indexName).Do(ctx)
-					}
+				//make sure the index exists, the data stream is created by its template and the write alias is bootstrapped on startup
+				if !query.Elasticsearch.DataStream.Enabled && !elasticsearch.UsesWriteAlias(query.Elasticsearch) {
+					err = output.EnsureIndex(indexName)
 
 					if err != nil {
 						//TODO handle err
-						log.Println("error creating elastic index: " + indexName)
-						log.Println(elasticsearch.BuildIndexPattern(query.Elasticsearch))
 						panic(err)
 					}
-
-					if !createIndex.Acknowledged {
-						//TODO handle the creation not being acknowledged
-						panic("elasticsearch index creation failed for: " + indexName)
-					}
 				}
+
 				if query.EsStandardized == "" {
 					elasticWg.Add(len(ffsEvents))
 					go func() {
 						for _, ffsEvent := range ffsEvents {
-							r := elastic.NewBulkIndexRequest().Index(indexName).Doc(ffsEvent)
-							processor.Add(r)
+							err := output.Add(indexName, ffsEvent)
+
+							if err != nil {
+								//TODO handle err
+								panic(err)
+							}
 							elasticWg.Done()
 						}
 					}()
@@ -563,8 +734,12 @@ func queryFetcher(query config.FFSQuery, inProgressQueries *[]eventOutput.InProg
 					elasticWg.Add(len(elasticFFSEvents))
 					go func() {
 						for _, elasticFileEvent := range elasticFFSEvents {
-							r := elastic.NewBulkIndexRequest().Index(indexName).Doc(elasticFileEvent)
-							processor.Add(r)
+							err := output.Add(indexName, elasticFileEvent)
+
+							if err != nil {
+								//TODO handle err
+								panic(err)
+							}
 							elasticWg.Done()
 						}
 					}()
@@ -572,11 +747,11 @@ func queryFetcher(query config.FFSQuery, inProgressQueries *[]eventOutput.InProg
 
 				elasticWg.Wait()
 
-				err = processor.Flush()
+				err = output.Flush()
 
 				if err != nil {
 					//TODO handle err
-					log.Println("error flushing elastic bulk request")
+					log.Println("error flushing " + query.OutputType + " bulk request")
 					panic(err)
 				}
 			} else {
@@ -633,41 +808,18 @@ func queryFetcher(query config.FFSQuery, inProgressQueries *[]eventOutput.InProg
 
 				elasticWg.Wait()
 
-				//check if indexes exist
+				//make sure the indexes exist
 				elasticWg.Add(len(requiredIndexTimestamps))
 				go func() {
 					for timestamp, _ := range requiredIndexTimestamps {
 						//generate indexName
 						indexName := elasticsearch.BuildIndexNameWithTime(query.Elasticsearch, timestamp)
-						exists, err := client.IndexExists(indexName).Do(ctx)
+						err := output.EnsureIndex(indexName)
 
 						if err != nil {
 							//TODO handle err
-							log.Println("error checking if elastic index exists: " + indexName)
 							panic(err)
 						}
-
-						if !exists {
-							//create index
-							var createIndex *elastic.IndicesCreateResult
-							if !query.Elasticsearch.UseCustomIndexPattern {
-								createIndex, err = client.CreateIndex(indexName).BodyString(elasticsearch.BuildIndexPattern(query.Elasticsearch)).Do(ctx)
-							} else {
-								createIndex, err = client.CreateIndex(indexName).Do(ctx)
-							}
-
-							if err != nil {
-								//TODO handle err
-								log.Println("error creating elastic index: " + indexName)
-								log.Println(elasticsearch.BuildIndexPattern(query.Elasticsearch))
-								panic(err)
-							}
-
-							if !createIndex.Acknowledged {
-								//TODO handle the creation not being acknowledged
-								panic("elasticsearch index creation failed for: " + indexName)
-							}
-						}
 						elasticWg.Done()
 					}
 				}()
@@ -700,8 +852,12 @@ func queryFetcher(query config.FFSQuery, inProgressQueries *[]eventOutput.InProg
 								indexTime, _ = time.Parse(query.Elasticsearch.IndexTimeAppend, eventTimestamp.Format(query.Elasticsearch.IndexTimeAppend))
 							}
 							indexName := elasticsearch.BuildIndexNameWithTime(query.Elasticsearch, indexTime)
-							r := elastic.NewBulkIndexRequest().Index(indexName).Doc(ffsEvent)
-							processor.Add(r)
+							err := output.Add(indexName, ffsEvent)
+
+							if err != nil {
+								//TODO handle err
+								panic(err)
+							}
 							elasticWg.Done()
 						}
 					}()
@@ -716,30 +872,28 @@ func queryFetcher(query config.FFSQuery, inProgressQueries *[]eventOutput.InProg
 								indexTime, _ = time.Parse(query.Elasticsearch.IndexTimeAppend, elasticFileEvent.Event.Created.Format(query.Elasticsearch.IndexTimeAppend))
 							}
 							indexName := elasticsearch.BuildIndexNameWithTime(query.Elasticsearch, indexTime)
-							r := elastic.NewBulkIndexRequest().Index(indexName).Doc(elasticFileEvent)
-							processor.Add(r)
+							err := output.Add(indexName, elasticFileEvent)
+
+							if err != nil {
+								//TODO handle err
+								panic(err)
+							}
 							elasticWg.Done()
 						}
 					}()
 				}
 				elasticWg.Wait()
 
-				err = processor.Flush()
+				err = output.Flush()
 
 				if err != nil {
 					//TODO handle err
-					log.Println("error flushing elastic bulk request")
+					log.Println("error flushing " + query.OutputType + " bulk request")
 					panic(err)
 				}
 			}
 
-			err = processor.Close()
-
-			if err != nil {
-				//TODO handle error
-				log.Println("error closing elastic bulk request")
-				panic(err)
-			}
+			output.ExportStats()
 		case "logstash":
 			var logstashWg sync.WaitGroup
 
@@ -837,56 +991,100 @@ func queryFetcher(query config.FFSQuery, inProgressQueries *[]eventOutput.InProg
 		enrichmentTime = time.Now()
 	}
 	outputTime := time.Now()
+	stats.enrichment = enrichmentTime.Sub(getFileEventsTime)
+	stats.output = outputTime.Sub(enrichmentTime)
 
-	//Check if this query is the newest completed query, if it is, set last completed query to query times
-	if lastCompletedQuery.OnOrBefore.Sub(inProgressQuery.OnOrAfter) <= 0 {
-		*lastCompletedQuery = *inProgressQuery
+	return stats
+}
+
+/*
+getFileEventsWithRetry - gets all of the file events for a query, retrying on known recoverable errors
+*/
+func getFileEventsWithRetry(query config.FFSQuery, session *authSession, configuration config.Config) *[]fileEvent {
+	var fileEvents *[]fileEvent
+
+	retryFFSRequest(query, session, func(authorization string) error {
+		var err error
+		fileEvents, err = getJsonFileEvents(authorization, configuration.FFSURI, configuration.APIVersion, query.Query, configuration.Debugging)
+		return err
+	})
+
+	return fileEvents
+}
+
+/*
+getFileEventPageWithRetry - gets a single page of file events for a search mode query, retrying on known recoverable errors
+pgToken - the token of the page to get, empty for the first page
+*/
+func getFileEventPageWithRetry(query config.FFSQuery, session *authSession, configuration config.Config, pgToken string) *fileEventResponse {
+	var response *fileEventResponse
+
+	pageQuery := query.Query
+	pageQuery.PgToken = pgToken
+	if pageQuery.PgSize == 0 {
+		pageQuery.PgSize = defaultSearchPageSize
+	}
+
+	searchURI := ffsSearchURI(configuration.FFSURI, configuration.APIVersion)
+
+	retryFFSRequest(query, session, func(authorization string) error {
+		var err error
+		response, err = searchJsonFileEvents(authorization, searchURI, configuration.APIVersion, pageQuery)
+		return err
+	})
+
+	return response
+}
+
+/*
+retryFFSRequest - makes a request to the FFS API, retrying up to 10 times on known recoverable errors
+The auth token is read from the session on every attempt, so a token refreshed part way through a retry chain is picked up
+Each attempt holds a fetch slot from the shared scheduler, which is given back while waiting to retry so that other queries can use it
+If the auth token is rejected it is dropped from the session before retrying
+Panics on unknown errors or once the retries are exhausted
+request - makes the request with the given Authorization header value
+*/
+func retryFFSRequest(query config.FFSQuery, session *authSession, request func(authorization string) error) {
+	for retryCount := 0; ; retryCount++ {
+		authorization, err := session.get()
 
-		err := eventOutput.WriteLastCompletedQuery(query, *inProgressQuery)
 		if err != nil {
+			log.Println("error getting auth data for ffs query: " + query.Name)
 			panic(err)
 		}
-	}
 
-	writeLastCompletedQueryTime := time.Now()
+		ffsWindowScheduler.run(query, func() {
+			err = request(authorization)
+		})
 
-	//Remove from in progress query slice
-	temp := *inProgressQueries
-	tempInProgress := temp[:0]
-	for _, query := range temp {
-		if query.OnOrAfter != inProgressQuery.OnOrAfter && query.OnOrBefore != inProgressQuery.OnOrBefore {
-			tempInProgress = append(tempInProgress, query)
+		if err == nil {
+			return
 		}
-	}
-	*inProgressQueries = tempInProgress
 
-	//Write in progress queries to file
-	err = eventOutput.WriteInProgressQueries(query, *inProgressQueries)
+		log.Println("error getting file events for ffs query: " + query.Name)
+		if isUnauthorizedError(err) {
+			//drop the rejected token so that the retry gets a new one
+			session.invalidate(authorization)
+		} else if !isRecoverableError(err) {
+			//check if recoverable errors are thrown
+			//panic if unrecoverable/unknown error
+			panic(err)
+		}
 
-	removeInProgressQueryTime := time.Now()
+		//allow for 10 retries before killing to save resource overload.
+		log.Println("Attempting to recover from error: " + err.Error() + ". Retry number: " + strconv.Itoa(retryCount))
+		if retryCount >= 10 {
+			//panic passed 10 retries
+			panic("Failed on retry of query 10 times. Panicking to prevent unrecoverable resource utilization for ffs query: " + query.Name)
+		}
 
-	if err != nil {
-		panic(err)
+		queryInterval, _ := time.ParseDuration(query.Interval)
+		//sleep before retry to reduce chance of hitting max queries per minute
+		time.Sleep(queryInterval)
 	}
-
-	promMetrics.IncrementEventsProcessed(len(*fileEvents))
-	promMetrics.DecreaseInProgressQueries()
-	endTime := time.Now()
-	duration := endTime.Sub(startTime)
-	cleanupDuration := cleanUpQueryTime.Sub(startTime)
-	onOrBeforeAndAfterDuration := onOrBeforeAndAfterTime.Sub(cleanUpQueryTime)
-	notInProgressDuration := notInProgressTime.Sub(onOrBeforeAndAfterTime)
-	getFileEventsDuration := getFileEventsTime.Sub(notInProgressTime)
-	retryGetFileEventsDuration := retryGetFileEventsTime.Sub(getFileEventsTime)
-	enrichmentDuration := enrichmentTime.Sub(retryGetFileEventsTime)
-	outputDuration := outputTime.Sub(enrichmentTime)
-	writeLastCompletedQueryDuration := writeLastCompletedQueryTime.Sub(outputTime)
-	removeInProgressQueryDuration := removeInProgressQueryTime.Sub(writeLastCompletedQueryTime)
-	log.Println("Number of events for query: " + query.Name + " - " + strconv.Itoa(len(*fileEvents)) +
-		" - Clean Up Duration: " + cleanupDuration.String() + " - " +
-		"On Or Before And After Duration: " + onOrBeforeAndAfterDuration.String() + " - Not In-progress Duration: " +
-		notInProgressDuration.String() + " - Get File Events Duration: " + getFileEventsDuration.String() + " - Retry Get File Events Duration: " +
-		retryGetFileEventsDuration.String() + " - Enrichment Duration: " + enrichmentDuration.String() + " - Output Duration: " + outputDuration.String() +
-		" - Write Last Completed Query Duration: " + writeLastCompletedQueryDuration.String() +
-		" - Remove In Progress Query Duration: " + removeInProgressQueryDuration.String() + " - Duration: " + duration.String())
 }
+
+//isRecoverableError checks if an error returned from the FFS API is one which is worth retrying
+func isRecoverableError(err error) bool {
+	return strings.Contains(err.Error(), "Error with gathering file events POST: 500 Internal Server Error") || (strings.Contains(err.Error(), "stream error: stream ID") && (strings.Contains(err.Error(), "INTERNAL_ERROR") || strings.Contains(err.Error(), "PROTOCOL_ERROR"))) || strings.Contains(err.Error(), "read: connection reset by peer") || strings.Contains(err.Error(), "POST: 400 Bad Request") || strings.Contains(err.Error(), "unexpected EOF") || strings.Contains(err.Error(), "POST: 504 Gateway Timeout") || (strings.Contains(err.Error(), "record on line ") && strings.Contains(err.Error(), ": wrong number of fields") || (strings.Contains(err.Error(), "record on line") && strings.Contains(err.Error(), "; parse error on line") && strings.Contains(err.Error(), ", column") && strings.Contains(err.Error(), ": extraneous or missing \" in quoted-field")))
+}
\ No newline at end of file
@@ -0,0 +1,161 @@
+package ffsEvent
+
+import (
+	"errors"
+	"github.com/BenB196/crashplan-ffs-puller/config"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+//testTokenServer is a stand-in for the Code42 token endpoint, which hands out token-1, token-2, ... in order
+type testTokenServer struct {
+	mutex  sync.Mutex
+	issued int
+}
+
+func (server *testTokenServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	server.issued++
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write([]byte(`{"access_token":"token-` + strconv.Itoa(server.issued) + `","token_type":"bearer","expires_in":3600}`))
+}
+
+func newTestSession(t *testing.T) (*authSession, *testTokenServer) {
+	tokenServer := &testTokenServer{}
+	server := httptest.NewServer(tokenServer)
+	t.Cleanup(server.Close)
+
+	return &authSession{
+		authURI:  server.URL + "/c42api/v3/auth/jwt?useBody=true",
+		authType: "apiClient",
+		username: "client",
+		password: "secret",
+	}, tokenServer
+}
+
+func TestRetryFFSRequest(t *testing.T) {
+	query := config.FFSQuery{Name: "test", Interval: "1ms"}
+
+	t.Run("rejected token is refreshed before the retry", func(t *testing.T) {
+		session, tokenServer := newTestSession(t)
+
+		var sent []string
+		retryFFSRequest(query, session, func(authorization string) error {
+			sent = append(sent, authorization)
+			if authorization == "Bearer token-1" {
+				return errors.New("Error with gathering file events POST: 401 Unauthorized")
+			}
+			return nil
+		})
+
+		if len(sent) != 2 || sent[0] != "Bearer token-1" || sent[1] != "Bearer token-2" {
+			t.Errorf("sent %v, want [Bearer token-1 Bearer token-2]", sent)
+		}
+
+		if tokenServer.issued != 2 {
+			t.Errorf("issued %d tokens, want 2", tokenServer.issued)
+		}
+	})
+
+	t.Run("token rotated by another query mid retry is picked up", func(t *testing.T) {
+		session, _ := newTestSession(t)
+
+		var sent []string
+		retryFFSRequest(query, session, func(authorization string) error {
+			sent = append(sent, authorization)
+			if len(sent) == 1 {
+				//another query sharing the session has its token rejected and refreshes it while this one waits to retry
+				session.invalidate(authorization)
+				if _, err := session.get(); err != nil {
+					t.Fatal(err)
+				}
+				return errors.New("Error with gathering file events POST: 500 Internal Server Error")
+			}
+			return nil
+		})
+
+		if len(sent) != 2 || sent[0] != "Bearer token-1" || sent[1] != "Bearer token-2" {
+			t.Errorf("sent %v, want [Bearer token-1 Bearer token-2]", sent)
+		}
+	})
+
+	t.Run("stale rejection does not drop a rotated token", func(t *testing.T) {
+		session, tokenServer := newTestSession(t)
+
+		stale, err := session.get()
+		if err != nil {
+			t.Fatal(err)
+		}
+		session.invalidate(stale)
+
+		var sent []string
+		retryFFSRequest(query, session, func(authorization string) error {
+			sent = append(sent, authorization)
+			if len(sent) == 1 {
+				//a request sent with the old token is rejected after the session already moved on
+				session.invalidate(stale)
+				return errors.New("Error with gathering file events POST: 500 Internal Server Error")
+			}
+			return nil
+		})
+
+		if len(sent) != 2 || sent[0] != "Bearer token-2" || sent[1] != "Bearer token-2" {
+			t.Errorf("sent %v, want [Bearer token-2 Bearer token-2]", sent)
+		}
+
+		if tokenServer.issued != 2 {
+			t.Errorf("issued %d tokens, want 2", tokenServer.issued)
+		}
+	})
+}
+
+func TestRetryFFSRequestReleasesSlotWhileWaiting(t *testing.T) {
+	previous := ffsWindowScheduler
+	ffsWindowScheduler = &windowScheduler{slots: 1, queues: map[string]*windowQueue{}}
+	defer func() { ffsWindowScheduler = previous }()
+
+	session, _ := newTestSession(t)
+	retrying := config.FFSQuery{Name: "retrying", Interval: "200ms", Weight: 1}
+	other := config.FFSQuery{Name: "other", Weight: 1}
+
+	var mutex sync.Mutex
+	var order []string
+	record := func(event string) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		order = append(order, event)
+	}
+
+	failed := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		attempts := 0
+		retryFFSRequest(retrying, session, func(authorization string) error {
+			attempts++
+			record("retrying attempt " + strconv.Itoa(attempts))
+			if attempts == 1 {
+				close(failed)
+				return errors.New("Error with gathering file events POST: 500 Internal Server Error")
+			}
+			return nil
+		})
+	}()
+
+	<-failed
+	//the only slot is free while the first query sleeps before its retry
+	ffsWindowScheduler.run(other, func() {
+		record("other")
+	})
+	<-done
+
+	want := []string{"retrying attempt 1", "other", "retrying attempt 2"}
+	if len(order) != len(want) || order[0] != want[0] || order[1] != want[1] || order[2] != want[2] {
+		t.Errorf("order = %v, want %v", order, want)
+	}
+}
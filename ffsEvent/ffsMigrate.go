@@ -0,0 +1,48 @@
+package ffsEvent
+
+import (
+	"context"
+	"errors"
+	"github.com/BenB196/crashplan-ffs-puller/config"
+	"github.com/BenB196/crashplan-ffs-puller/elasticsearch"
+	"github.com/BenB196/crashplan-ffs-puller/opensearch"
+)
+
+/*
+MigrateIndices - reindexes the indices of an ffs query in a time range through a transform, see elasticsearch.MigrateIndices
+Returns
+error - any errors which have been caught
+*/
+func MigrateIndices(query config.FFSQuery, options elasticsearch.MigrateOptions) error {
+	ctx := context.Background()
+
+	var transport elasticsearch.Transport
+	switch query.OutputType {
+	case "elastic":
+		elasticClient, err := elasticsearch.BuildElasticClient(query.Elasticsearch)
+
+		if err != nil {
+			return errors.New("error building elastic client: " + err.Error())
+		}
+
+		transport = elasticsearch.NewTransport(elasticClient)
+	case "opensearch":
+		openSearchClient, err := opensearch.BuildOpenSearchClient(query.Elasticsearch)
+
+		if err != nil {
+			return errors.New("error building opensearch client: " + err.Error())
+		}
+
+		_, err = openSearchClient.CheckCompatibility(ctx)
+
+		if err != nil {
+			return errors.New("error checking opensearch server: " + err.Error())
+		}
+
+		transport = openSearchClient
+	default:
+		return errors.New("error: ffs query: " + query.Name + " has output type: " + query.OutputType + ", migrate-index only supports elastic and opensearch")
+	}
+
+	return elasticsearch.MigrateIndices(transport, ctx, query.Elasticsearch, query.EsStandardized, options)
+}
@@ -0,0 +1,82 @@
+package ffsEvent
+
+import (
+	"github.com/BenB196/crashplan-ffs-puller/config"
+	"github.com/BenB196/crashplan-ffs-puller/eventOutput"
+	"sync"
+)
+
+//pageCheckpointMutex guards the page checkpoint files, as the windows of a query are processed in parallel
+var pageCheckpointMutex sync.Mutex
+
+/*
+getPageCheckpoint - gets where a search mode window left off
+Returns
+string - the token of the next page to get, empty to start from the first page
+int - the number of the next page, starting at 1
+*/
+func getPageCheckpoint(query config.FFSQuery, window eventOutput.InProgressQuery) (string, int) {
+	pageCheckpointMutex.Lock()
+	defer pageCheckpointMutex.Unlock()
+
+	pageCheckpoints, err := eventOutput.ReadPageCheckpoints(query)
+
+	if err != nil {
+		panic(err)
+	}
+
+	for _, pageCheckpoint := range pageCheckpoints {
+		if pageCheckpoint.OnOrAfter.Equal(window.OnOrAfter) && pageCheckpoint.OnOrBefore.Equal(window.OnOrBefore) {
+			return pageCheckpoint.PgToken, pageCheckpoint.Page
+		}
+	}
+
+	return "", 1
+}
+
+//setPageCheckpoint saves the token and number of the next page of a search mode window
+func setPageCheckpoint(query config.FFSQuery, window eventOutput.InProgressQuery, pgToken string, page int) {
+	updatePageCheckpoints(query, window, &eventOutput.PageCheckpoint{
+		OnOrAfter:  window.OnOrAfter,
+		OnOrBefore: window.OnOrBefore,
+		PgToken:    pgToken,
+		Page:       page,
+	})
+}
+
+//clearPageCheckpoint removes the checkpoint of a search mode window once all of its pages have been output
+func clearPageCheckpoint(query config.FFSQuery, window eventOutput.InProgressQuery) {
+	updatePageCheckpoints(query, window, nil)
+}
+
+//updatePageCheckpoints replaces the checkpoint of a window, removing it if pageCheckpoint is nil
+func updatePageCheckpoints(query config.FFSQuery, window eventOutput.InProgressQuery, pageCheckpoint *eventOutput.PageCheckpoint) {
+	pageCheckpointMutex.Lock()
+	defer pageCheckpointMutex.Unlock()
+
+	pageCheckpoints, err := eventOutput.ReadPageCheckpoints(query)
+
+	if err != nil {
+		panic(err)
+	}
+
+	var updatedPageCheckpoints []eventOutput.PageCheckpoint
+	for _, existing := range pageCheckpoints {
+		if !existing.OnOrAfter.Equal(window.OnOrAfter) || !existing.OnOrBefore.Equal(window.OnOrBefore) {
+			updatedPageCheckpoints = append(updatedPageCheckpoints, existing)
+		}
+	}
+	if pageCheckpoint != nil {
+		updatedPageCheckpoints = append(updatedPageCheckpoints, *pageCheckpoint)
+	}
+
+	if len(updatedPageCheckpoints) == 0 && len(pageCheckpoints) == 0 {
+		return
+	}
+
+	err = eventOutput.WritePageCheckpoints(query, updatedPageCheckpoints)
+
+	if err != nil {
+		panic(err)
+	}
+}
@@ -1,19 +1,20 @@
 package ffsEvent
 
 import (
-	"context"
-	"fmt"
-	"github.com/BenB196/crashplan-ffs-go-pkg"
 	"github.com/BenB196/crashplan-ffs-puller/config"
-	"github.com/BenB196/crashplan-ffs-puller/elasticsearch"
 	"github.com/BenB196/crashplan-ffs-puller/eventOutput"
-	"github.com/olivere/elastic/v7"
 	"log"
 	"sync"
 	"time"
 )
 
-func FFSQuery(configuration config.Config, query config.FFSQuery) {
+func FFSQuery(configuration config.Config, query config.FFSQuery, resumeOptions ResumeOptions) {
+
+	//Queries on a cron or once schedule pull fixed windows when the schedule fires instead of tailing
+	if query.Schedule.Type != "continuous" {
+		scheduledQuery(configuration, query)
+		return
+	}
 
 	//Initialize query waitGroup
 	var wgQuery sync.WaitGroup
@@ -47,79 +48,114 @@ func FFSQuery(configuration config.Config, query config.FFSQuery) {
 		panic(err)
 	}
 
-	//Get initial authData
-	authData, err := ffs.GetAuthData(configuration.AuthURI, query.Username, query.Password)
+	//Handle setting the initial ON_OR_BEFORE and ON_OR_AFTER depending on the saved lastCompletedQuery
+	var discardProgress bool
+	lastCompletedQuery, discardProgress, err = getResumePoint(query, lastCompletedQuery, resumeOptions)
 
 	if err != nil {
-		log.Println("error getting auth data for ffs query: " + query.Name)
+		log.Println("error getting resume point for ffs query: " + query.Name)
 		panic(err)
 	}
 
-	//Make quit chan to close go routines
-	quit := make(chan struct{})
+	if discardProgress {
+		log.Println("Discarding stored progress for ffs query: " + query.Name)
+		inProgressQueries = discardInProgressQueries(query, inProgressQueries)
 
-	//Init goroutine for getting authData ever 55 minutes
-	//Handle getting API AuthTokens every 55 minutes
-	authTimeTicker := time.NewTicker(55 * time.Minute)
-	go func() {
-		for {
-			select {
-			case <-authTimeTicker.C:
-				authData, err = ffs.GetAuthData(configuration.AuthURI, query.Username, query.Password)
+		err = eventOutput.WriteInProgressQueries(query, inProgressQueries)
 
-				if err != nil {
-					log.Println("error with getting authentication data for ffs query: " + query.Name)
-					panic(err)
-				}
-			case <-quit:
-				authTimeTicker.Stop()
-				return
-			}
+		if err != nil {
+			panic(err)
 		}
-	}()
-
-	//Init elastic client if output type == elastic
-	var elasticClient *elastic.Client
-	var ctx context.Context
-
-	if query.OutputType == "elastic" {
-		//Create context
-		ctx = context.Background()
 
-		//Create elastic client
-		elasticClient, err = elasticsearch.BuildElasticClient(query.Elasticsearch)
+		err = eventOutput.WriteLastCompletedQuery(query, lastCompletedQuery)
 
 		if err != nil {
-			//TODO handle error
-			log.Println("error building elastic client")
 			panic(err)
 		}
 
-		//get elastic info
-		info, code, err := elasticClient.Ping(elasticsearch.Balance(query.Elasticsearch.ElasticURL)).Do(ctx)
+		err = eventOutput.WritePageCheckpoints(query, nil)
 
 		if err != nil {
-			//TODO handle error
-			log.Println("error reaching elastic server")
 			panic(err)
 		}
+	}
+
+	//Nothing left to do if the query has already reached its max time
+	if maxTime != (time.Time{}) && len(inProgressQueries) == 0 && !lastCompletedQuery.OnOrBefore.Before(maxTime) {
+		log.Println("ffs query: " + query.Name + " has already reached its ON_OR_BEFORE time, not running it")
+		return
+	}
 
-		fmt.Printf("Elasticsearch returned with code %d and version %s\n", code, info.Version.Number)
+	//Holes are looked for from where the query was configured or told to start, only falling back to its first completed window if it has no start
+	coverageStart := defaultQueryTimes.OnOrAfter
+	if resumeOptions.StartFrom != (time.Time{}) {
+		coverageStart = resumeOptions.StartFrom
+	}
+
+	//Keep track of every interval of time which has been completed, so that holes can be found and re-queried
+	ledger, err := newCoverageLedger(query, lastCompletedQuery, coverageStart)
+
+	if err != nil {
+		log.Println("error getting coverage for ffs query: " + query.Name)
+		panic(err)
+	}
+
+	//with the audit on, the time between ON_OR_AFTER and the first completed query is a hole which the audit re-queries
+	auditInterval, _ := time.ParseDuration(query.AuditInterval)
+
+	if discardProgress {
+		ledger.reset()
+	} else if ledgerStart := ledger.start(); ledgerStart != (time.Time{}) && defaultQueryTimes.OnOrAfter != (time.Time{}) && defaultQueryTimes.OnOrAfter.Before(ledgerStart) && auditInterval <= 0 {
+		log.Println("ON_OR_AFTER for ffs query: " + query.Name + " is before its first completed query, use the backfill command to pull " + defaultQueryTimes.OnOrAfter.String() + " to " + ledgerStart.String())
+	}
+
+	//Auth tokens are shared with every other query using the same credentials and refreshed as they near expiry
+	session := getAuthSession(configuration.AuthURI, query.AuthType, query.Username, query.Password)
+
+	//Get initial authData, so that bad credentials fail on startup
+	_, err = session.get()
+
+	if err != nil {
+		log.Println("error getting auth data for ffs query: " + query.Name)
+		panic(err)
+	}
+
+	//Make quit chan to close go routines
+	quit := make(chan struct{})
+
+	//Init the elastic or opensearch output if the output type is elastic or opensearch
+	output := initSearchOutput(query)
+
+	//The in progress and last completed queries are shared by the tail, catch up, and audit goroutines
+	progress := &queryProgress{
+		inProgressQueries:  inProgressQueries,
+		lastCompletedQuery: lastCompletedQuery,
 	}
 
 	//Handle old in progress queries that never completed when programmed died
-	if inProgressQueries != nil && len(inProgressQueries) > 0 {
+	if len(inProgressQueries) > 0 {
 		go func() {
 			for _, inProgressQuery := range inProgressQueries {
-				query = setOnOrBeforeAndAfter(query, inProgressQuery.OnOrBefore, inProgressQuery.OnOrAfter)
-				queryFetcher(query, &inProgressQueries, *authData, configuration, &lastCompletedQuery, maxTime, true, elasticClient, ctx, nil, 0, false)
+				catchUpQuery := setOnOrBeforeAndAfter(query, inProgressQuery.OnOrBefore, inProgressQuery.OnOrAfter)
+				queryFetcher(catchUpQuery, progress, session, configuration, maxTime, true, output, nil, ledger)
 			}
 		}()
 	}
 
-	//Handle setting the initial ON_OR_BEFORE and ON_OR_AFTER depending on the saved lastCompletedQuery
-	if lastCompletedQuery != (eventOutput.InProgressQuery{}) {
-		//TODO handle setting correct times
+	//Periodically audit the coverage for holes and re-query them
+	if auditInterval > 0 {
+		auditTimeTicker := time.NewTicker(auditInterval)
+		go func() {
+			for {
+				select {
+				case <-auditTimeTicker.C:
+					auditCoverage(query, ledger, progress, session, configuration, maxTime, output)
+				case <-quit:
+					auditTimeTicker.Stop()
+					return
+				}
+			}
+		}()
 	}
 
 	queryInterval, _ := time.ParseDuration(query.Interval)
@@ -129,8 +165,9 @@ func FFSQuery(configuration config.Config, query config.FFSQuery) {
 		for {
 			select {
 			case <-queryIntervalTimeTicker.C:
-				if *query.MaxConcurrentQueries == -1 || len(inProgressQueries) <= *query.MaxConcurrentQueries {
-					go queryFetcher(query, &inProgressQueries, *authData, configuration, &lastCompletedQuery, maxTime, false, elasticClient, ctx, quit, 0, false)
+				//in progress queries include windows still waiting on the shared scheduler, so a query cannot pile up a backlog in the queue
+				if *query.MaxConcurrentQueries == -1 || len(progress.inProgress()) <= *query.MaxConcurrentQueries {
+					go queryFetcher(query, progress, session, configuration, maxTime, false, output, quit, ledger)
 				} else {
 					log.Println("Rate limiting query: " + query.Name)
 				}
@@ -0,0 +1,86 @@
+package ffsEvent
+
+import (
+	"github.com/BenB196/crashplan-ffs-puller/config"
+	"github.com/BenB196/crashplan-ffs-puller/promMetrics"
+	"sync"
+	"time"
+)
+
+/*
+rateLimiter is a token bucket shared by every ffs query, so that the process as a whole stays under the FFS API request limits
+Tokens refill at requestsPerMinute, up to a minute's worth, and at most maxConcurrent requests can be in flight at once
+*/
+type rateLimiter struct {
+	mutex      sync.Mutex
+	interval   time.Duration
+	capacity   float64
+	tokens     float64
+	last       time.Time
+	concurrent chan struct{}
+}
+
+//ffsRateLimiter is applied to every call to the FFS API, it does not limit anything until InitRateLimiter is called
+var ffsRateLimiter = &rateLimiter{}
+
+/*
+InitRateLimiter - sets up the process wide FFS API rate limit from the configuration
+Must be called before any ffs queries are started
+*/
+func InitRateLimiter(configuration config.Config) {
+	limiter := &rateLimiter{}
+
+	if configuration.RateLimit.RequestsPerMinute > 0 {
+		limiter.interval = time.Minute / time.Duration(configuration.RateLimit.RequestsPerMinute)
+		limiter.capacity = float64(configuration.RateLimit.RequestsPerMinute)
+		limiter.tokens = limiter.capacity
+		limiter.last = time.Now()
+	}
+
+	if configuration.RateLimit.MaxConcurrentRequests > 0 {
+		limiter.concurrent = make(chan struct{}, configuration.RateLimit.MaxConcurrentRequests)
+	}
+
+	ffsRateLimiter = limiter
+}
+
+/*
+wait - blocks until a request is allowed to be made
+Returns
+func() - must be called once the request has completed to free up its concurrent request slot
+*/
+func (limiter *rateLimiter) wait() func() {
+	startTime := time.Now()
+
+	if limiter.interval > 0 {
+		limiter.mutex.Lock()
+		now := time.Now()
+		limiter.tokens = limiter.tokens + float64(now.Sub(limiter.last))/float64(limiter.interval)
+		if limiter.tokens > limiter.capacity {
+			limiter.tokens = limiter.capacity
+		}
+		limiter.last = now
+
+		//Reserve a token, going into debt if there are none so that waiting requests are served in order
+		var delay time.Duration
+		if limiter.tokens < 1 {
+			delay = time.Duration((1 - limiter.tokens) * float64(limiter.interval))
+		}
+		limiter.tokens--
+		limiter.mutex.Unlock()
+
+		time.Sleep(delay)
+	}
+
+	if limiter.concurrent != nil {
+		limiter.concurrent <- struct{}{}
+	}
+
+	promMetrics.ObserveRateLimitWait(time.Since(startTime).Seconds())
+
+	return func() {
+		if limiter.concurrent != nil {
+			<-limiter.concurrent
+		}
+	}
+}
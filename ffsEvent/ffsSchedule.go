@@ -0,0 +1,101 @@
+package ffsEvent
+
+import (
+	"github.com/BenB196/crashplan-ffs-puller/config"
+	"github.com/BenB196/crashplan-ffs-puller/eventOutput"
+	"github.com/BenB196/crashplan-ffs-puller/utils"
+	"log"
+	"time"
+)
+
+/*
+scheduledQuery - runs an ffs query on a cron or once schedule instead of continuously tailing it
+Each time the schedule fires, the window which ends delay before the fire time and starts window before that is pulled
+The last completed window is stored so that a restart does not pull the same window twice,
+and runs which were missed while the application was down are caught up from it
+*/
+func scheduledQuery(configuration config.Config, query config.FFSQuery) {
+	//Keep track of the last successfully completed window
+	lastCompletedQuery, err := eventOutput.ReadLastCompletedQuery(query)
+
+	if err != nil {
+		log.Println("error getting old last completed query")
+		panic(err)
+	}
+
+	location, _ := time.LoadLocation(query.Schedule.Timezone)
+	window, _ := time.ParseDuration(query.Schedule.Window)
+	delay, _ := time.ParseDuration(query.Schedule.Delay)
+	timeGap, _ := time.ParseDuration(query.TimeGap)
+
+	var cronSchedule *utils.CronSchedule
+	if query.Schedule.Type == "cron" {
+		cronSchedule, err = utils.ParseCron(query.Schedule.Cron)
+
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	//Runs can be far apart, the session refreshes the token when a run needs it
+	session := getAuthSession(configuration.AuthURI, query.AuthType, query.Username, query.Password)
+
+	//Init the elastic or opensearch output if the output type is elastic or opensearch
+	output := initSearchOutput(query)
+
+	//Start from the run which pulled the last completed window, so that runs missed while down are caught up straight away
+	fireTime := time.Now().In(location)
+	if lastCompletedQuery != (eventOutput.InProgressQuery{}) {
+		fireTime = lastCompletedQuery.OnOrBefore.Add(1 * time.Millisecond).Add(delay).In(location)
+	}
+
+	for {
+		if query.Schedule.Type == "once" {
+			//validated when the config is read
+			fireTime, _ = query.Schedule.AtTime()
+		} else {
+			fireTime = cronSchedule.Next(fireTime)
+
+			if fireTime == (time.Time{}) {
+				log.Println("Schedule for ffs query: " + query.Name + " does not run again")
+				return
+			}
+		}
+
+		scheduledWindow := eventOutput.InProgressQuery{
+			OnOrAfter:  fireTime.Add(-delay).Add(-window).UTC().Truncate(time.Millisecond),
+			OnOrBefore: fireTime.Add(-delay).Add(-1 * time.Millisecond).UTC().Truncate(time.Millisecond),
+		}
+
+		//Skip windows which have already been pulled, ex: a once query which ran before a restart
+		if !lastCompletedQuery.OnOrBefore.Before(scheduledWindow.OnOrBefore) {
+			if query.Schedule.Type == "once" {
+				log.Println("ffs query: " + query.Name + " has already run its once schedule")
+				return
+			}
+			continue
+		}
+
+		if fireTime.Before(time.Now()) {
+			log.Println("Catching up missed run of ffs query: " + query.Name + " at " + fireTime.String() + " for " + scheduledWindow.OnOrAfter.String() + " to " + scheduledWindow.OnOrBefore.String())
+		} else {
+			log.Println("Next run of ffs query: " + query.Name + " at " + fireTime.String() + " for " + scheduledWindow.OnOrAfter.String() + " to " + scheduledWindow.OnOrBefore.String())
+			time.Sleep(time.Until(fireTime))
+		}
+
+		runWindows(query, splitTimeRange(scheduledWindow, timeGap), session, configuration, output, func(window eventOutput.InProgressQuery) {})
+
+		lastCompletedQuery = scheduledWindow
+
+		err = eventOutput.WriteLastCompletedQuery(query, lastCompletedQuery)
+
+		if err != nil {
+			panic(err)
+		}
+
+		if query.Schedule.Type == "once" {
+			log.Println("ffs query: " + query.Name + " has completed its once schedule")
+			return
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package ffsEvent
+
+import (
+	"context"
+	"fmt"
+	"github.com/BenB196/crashplan-ffs-puller/config"
+	"github.com/BenB196/crashplan-ffs-puller/elasticsearch"
+	"github.com/BenB196/crashplan-ffs-puller/opensearch"
+	"log"
+)
+
+//searchOutput is the elastic or opensearch output of an ffs query, which share the fetcher's index naming
+type searchOutput interface {
+	//EnsureIndex makes sure an index exists, creating it if it does not
+	EnsureIndex(indexName string) error
+	//Add queues an event to be sent to an index
+	Add(indexName string, doc interface{}) error
+	//Flush sends every queued event
+	Flush() error
+	//ExportStats sets the bulk metrics of the query
+	ExportStats()
+}
+
+/*
+initSearchOutput - builds the elastic or opensearch output of an ffs query, installing its pipeline, lifecycle policy, templates, and write alias
+Returns
+searchOutput - the output, nil if the output type is not elastic or opensearch
+*/
+func initSearchOutput(query config.FFSQuery) searchOutput {
+	switch query.OutputType {
+	case "elastic":
+		return initElasticOutput(query)
+	case "opensearch":
+		return initOpenSearchOutput(query)
+	default:
+		return nil
+	}
+}
+
+/*
+initElasticOutput - builds and pings the elastic client for an ffs query, and installs what its indices need
+Returns
+*elasticsearch.Output - the elastic output
+*/
+func initElasticOutput(query config.FFSQuery) *elasticsearch.Output {
+	//Create context
+	ctx := context.Background()
+
+	//Create elastic client
+	elasticClient, err := elasticsearch.BuildElasticClient(query.Elasticsearch)
+
+	if err != nil {
+		//TODO handle error
+		log.Println("error building elastic client")
+		panic(err)
+	}
+
+	//get elastic info
+	elasticURLs, _ := elasticsearch.BuildElasticURLs(query.Elasticsearch)
+	info, code, err := elasticClient.Ping(elasticsearch.Balance(elasticURLs)).Do(ctx)
+
+	if err != nil {
+		//TODO handle error
+		log.Println("error reaching elastic server")
+		panic(err)
+	}
+
+	fmt.Printf("Elasticsearch returned with code %d and version %s\n", code, info.Version.Number)
+
+	transport := elasticsearch.NewTransport(elasticClient)
+
+	//install the query's ingest pipeline before any events are sent through it
+	if query.Elasticsearch.PipelineFile != "" {
+		err = elasticsearch.InstallPipeline(transport, ctx, query.Elasticsearch)
+
+		if err != nil {
+			//TODO handle error
+			log.Println("error installing elastic ingest pipeline")
+			panic(err)
+		}
+	}
+
+	//install the query's ilm policy, which the index template refers to
+	if query.Elasticsearch.ILM.Enabled {
+		err = elasticsearch.InstallLifecyclePolicy(elasticClient, ctx, query.Elasticsearch)
+
+		if err != nil {
+			//TODO handle error
+			log.Println("error installing elastic ilm policy")
+			panic(err)
+		}
+	}
+
+	installTemplatesAndWriteAlias(transport, ctx, query)
+
+	output, err := elasticsearch.NewOutput(elasticClient, ctx, query.Name, query.Elasticsearch)
+
+	if err != nil {
+		//TODO handle error
+		log.Println("error starting elastic output")
+		panic(err)
+	}
+
+	return output
+}
+
+/*
+initOpenSearchOutput - builds the opensearch client for an ffs query, checks that the cluster is a supported opensearch, and installs what its indices need
+Returns
+*opensearch.Output - the opensearch output
+*/
+func initOpenSearchOutput(query config.FFSQuery) *opensearch.Output {
+	//Create context
+	ctx := context.Background()
+
+	//Create opensearch client
+	openSearchClient, err := opensearch.BuildOpenSearchClient(query.Elasticsearch)
+
+	if err != nil {
+		//TODO handle error
+		log.Println("error building opensearch client")
+		panic(err)
+	}
+
+	version, err := openSearchClient.CheckCompatibility(ctx)
+
+	if err != nil {
+		//TODO handle error
+		log.Println("error checking opensearch server")
+		panic(err)
+	}
+
+	fmt.Printf("OpenSearch returned with version %s\n", version)
+
+	//install the query's ingest pipeline before any events are sent through it
+	if query.Elasticsearch.PipelineFile != "" {
+		err = elasticsearch.InstallPipeline(openSearchClient, ctx, query.Elasticsearch)
+
+		if err != nil {
+			//TODO handle error
+			log.Println("error installing opensearch ingest pipeline")
+			panic(err)
+		}
+	}
+
+	//install the query's ism policy before the first index is created, so that its ism_template attaches it
+	if query.Elasticsearch.ISM.Enabled {
+		err = opensearch.InstallISMPolicy(openSearchClient, ctx, query.Elasticsearch)
+
+		if err != nil {
+			//TODO handle error
+			log.Println("error installing opensearch ism policy")
+			panic(err)
+		}
+	}
+
+	installTemplatesAndWriteAlias(openSearchClient, ctx, query)
+
+	return opensearch.NewOutput(openSearchClient, ctx, query.Name, query.Elasticsearch)
+}
+
+//installTemplatesAndWriteAlias installs the index templates of an ffs query and bootstraps its write alias, which are shared by elastic and opensearch
+func installTemplatesAndWriteAlias(transport elasticsearch.Transport, ctx context.Context, query config.FFSQuery) {
+	//install the query's index templates, unless they are managed outside of the puller
+	if !query.Elasticsearch.UseCustomIndexPattern {
+		err := elasticsearch.InstallIndexTemplates(transport, ctx, query.Elasticsearch, query.EsStandardized)
+
+		if err != nil {
+			//TODO handle error
+			log.Println("error installing " + query.OutputType + " index templates")
+			panic(err)
+		}
+	}
+
+	//the first index behind the write alias must be created after the templates, so that it gets the lifecycle policy
+	if elasticsearch.UsesWriteAlias(query.Elasticsearch) {
+		err := elasticsearch.BootstrapWriteAlias(transport, ctx, query.Elasticsearch)
+
+		if err != nil {
+			//TODO handle error
+			log.Println("error bootstrapping " + query.OutputType + " write alias")
+			panic(err)
+		}
+	}
+}
@@ -14,9 +14,16 @@ import (
 	"time"
 )
 
-func getOnOrTime(beforeAfter string, query ffs.Query) (time.Time, error) {
+/*
+getOnOrTime - gets the ON_OR_BEFORE or ON_OR_AFTER time of a query
+Only filters on the windowing term are looked at, any other date filters in the query are left alone
+*/
+func getOnOrTime(beforeAfter string, term string, query ffs.Query) (time.Time, error) {
 	for _, group := range query.Groups {
 		for _, filter := range group.Filters {
+			if filter.Term != term {
+				continue
+			}
 			if beforeAfter == "before" && filter.Operator == "ON_OR_BEFORE" {
 				if filter.Value == "" || filter.Value == (time.Time{}.String()) {
 					return time.Time{}, nil
@@ -37,13 +44,13 @@ func getOnOrTime(beforeAfter string, query ffs.Query) (time.Time, error) {
 }
 
 func getOnOrBeforeAndAfter(query config.FFSQuery) (*eventOutput.InProgressQuery, error) {
-	onOrAfter, err := getOnOrTime("after", query.Query)
+	onOrAfter, err := getOnOrTime("after", query.TimestampTerm, query.Query)
 
 	if err != nil {
 		return nil, errors.New("error parsing onOrAfter time for ffs query: " + query.Name + " " + err.Error())
 	}
 
-	onOrBefore, err := getOnOrTime("before", query.Query)
+	onOrBefore, err := getOnOrTime("before", query.TimestampTerm, query.Query)
 
 	if err != nil {
 		return nil, errors.New("error parsing onOrBefore time for ffs query: " + query.Name + " " + err.Error())
@@ -55,9 +62,16 @@ func getOnOrBeforeAndAfter(query config.FFSQuery) (*eventOutput.InProgressQuery,
 	}, nil
 }
 
-func setOnOrTime(beforeAfter string, query ffs.Query, timeStamp time.Time) ffs.Query {
+/*
+setOnOrTime - sets the ON_OR_BEFORE or ON_OR_AFTER time of a query
+Only filters on the windowing term are rewritten, any other date filters in the query are left intact
+*/
+func setOnOrTime(beforeAfter string, term string, query ffs.Query, timeStamp time.Time) ffs.Query {
 	for k, group := range query.Groups {
 		for i, filter := range group.Filters {
+			if filter.Term != term {
+				continue
+			}
 			if beforeAfter == "before" && filter.Operator == "ON_OR_BEFORE" {
 				query.Groups[k].Filters[i].Value = timeStamp.Format("2006-01-02T15:04:05.000Z")
 			} else if beforeAfter == "after" && filter.Operator == "ON_OR_AFTER" {
@@ -70,8 +84,16 @@ func setOnOrTime(beforeAfter string, query ffs.Query, timeStamp time.Time) ffs.Q
 }
 
 func setOnOrBeforeAndAfter(query config.FFSQuery, beforeTime time.Time, afterTime time.Time) config.FFSQuery {
-	query.Query = setOnOrTime("before", query.Query, beforeTime)
-	query.Query = setOnOrTime("after", query.Query, afterTime)
+	//Copy the groups and filters so that queries running in parallel do not overwrite each others times
+	groups := make([]ffs.Group, len(query.Query.Groups))
+	for i, group := range query.Query.Groups {
+		groups[i] = group
+		groups[i].Filters = append([]ffs.SearchFilter(nil), group.Filters...)
+	}
+	query.Query.Groups = groups
+
+	query.Query = setOnOrTime("before", query.TimestampTerm, query.Query, beforeTime)
+	query.Query = setOnOrTime("after", query.TimestampTerm, query.Query, afterTime)
 
 	return query
 }
@@ -95,6 +117,9 @@ func setOnOrBeforeAndAfter(query config.FFSQuery, beforeTime time.Time, afterTim
 //then compare last in progress query to last completed query and see which is newer
 //else set time based off of last in progress query + time gap
 
+//errWindowNotReady is returned by calculateTimeStamps when the next query would start within the 15 minute no go window
+var errWindowNotReady = errors.New("next query window is not ready to be pulled yet")
+
 func calculateTimeStamps(inProgressQueries []eventOutput.InProgressQuery, lastCompletedQuery eventOutput.InProgressQuery, query config.FFSQuery, maxTime time.Time) (config.FFSQuery, bool, error) {
 	//Create variable which will be used to store the latest query to have run
 	var lastQueryInterval eventOutput.InProgressQuery
@@ -118,14 +143,16 @@ func calculateTimeStamps(inProgressQueries []eventOutput.InProgressQuery, lastCo
 				return query, false, err
 			}
 			if currentQuery.OnOrAfter == (time.Time{}) {
+				//Pretend the last query ended one time gap ago, so the first query ends at time.Now
 				lastQueryInterval = eventOutput.InProgressQuery{
-					OnOrAfter:  timeNow.Add(-timeGap),
-					OnOrBefore: timeNow.Add(timeGap),
+					OnOrAfter:  timeNow.Add(-timeGap).Add(-timeGap),
+					OnOrBefore: timeNow.Add(-timeGap),
 				}
 			} else {
+				//Pretend the last query ended 1ms before ON_OR_AFTER, so the first query starts at ON_OR_AFTER
 				lastQueryInterval = eventOutput.InProgressQuery{
-					OnOrAfter:  currentQuery.OnOrAfter.Add(1 * time.Millisecond),
-					OnOrBefore: currentQuery.OnOrAfter.Add(1 * time.Millisecond).Add(timeGap),
+					OnOrAfter:  currentQuery.OnOrAfter.Add(-1 * time.Millisecond).Add(-timeGap),
+					OnOrBefore: currentQuery.OnOrAfter.Add(-1 * time.Millisecond),
 				}
 			}
 		}
@@ -152,6 +179,11 @@ func calculateTimeStamps(inProgressQueries []eventOutput.InProgressQuery, lastCo
 		}
 	}
 
+	//Wait if the whole query is within the 15 minute no go window
+	if !done && newOnOrAfter.After(timeNow) {
+		return query, false, errWindowNotReady
+	}
+
 	//Truncate time if within the 15 minute no go window
 	if timeNow.Sub(newOnOrBefore) <= 0 {
 		newOnOrBefore = timeNow
@@ -161,6 +193,95 @@ func calculateTimeStamps(inProgressQueries []eventOutput.InProgressQuery, lastCo
 	return setOnOrBeforeAndAfter(query, newOnOrBefore, newOnOrAfter), done, nil
 }
 
+/*
+splitTimeRange - splits a time range into consecutive windows no longer than windowSize
+Windows follow the same layout as the live tail, each starting 1ms after the previous one ends
+*/
+func splitTimeRange(timeRange eventOutput.InProgressQuery, windowSize time.Duration) []eventOutput.InProgressQuery {
+	var windows []eventOutput.InProgressQuery
+
+	for onOrAfter := timeRange.OnOrAfter; !onOrAfter.After(timeRange.OnOrBefore); {
+		onOrBefore := onOrAfter.Add(windowSize)
+		if onOrBefore.After(timeRange.OnOrBefore) {
+			onOrBefore = timeRange.OnOrBefore
+		}
+
+		windows = append(windows, eventOutput.InProgressQuery{
+			OnOrAfter:  onOrAfter,
+			OnOrBefore: onOrBefore,
+		})
+
+		onOrAfter = onOrBefore.Add(1 * time.Millisecond)
+	}
+
+	return windows
+}
+
+//ResumeOptions are command line overrides for where ffs queries start from when the application starts
+type ResumeOptions struct {
+	ResetCheckpoint bool
+	StartFrom       time.Time
+}
+
+/*
+getResumePoint - works out where an ffs query should start from when the application starts
+In order of precedence:
+1. startFrom is set - start from startFrom, discarding the stored progress
+2. resetCheckpoint is set - start from the config's ON_OR_AFTER (time.Now if empty), discarding the stored progress
+3. There is no stored last completed query - start from the config's ON_OR_AFTER (time.Now if empty)
+4. The stored last completed query is behind the config's ON_OR_AFTER (the start time was moved forward) - start from the config's ON_OR_AFTER, discarding the stored progress
+5. The stored last completed query is ahead of the config's ON_OR_AFTER - resume from the stored last completed query
+The config's ON_OR_BEFORE is always the max time, if the resume point is past it the query is already done
+Returns
+eventOutput.InProgressQuery - the last completed query to resume from, empty if the config's ON_OR_AFTER should be used
+bool - whether the stored in progress queries, last completed query, and coverage should be discarded
+error - any errors which have been caught
+*/
+func getResumePoint(query config.FFSQuery, lastCompletedQuery eventOutput.InProgressQuery, options ResumeOptions) (eventOutput.InProgressQuery, bool, error) {
+	if options.StartFrom != (time.Time{}) {
+		//Pretend the last query ended 1ms before the start time, so the first query starts at it
+		startFrom := options.StartFrom.Add(-1 * time.Millisecond)
+		return eventOutput.InProgressQuery{
+			OnOrAfter:  startFrom,
+			OnOrBefore: startFrom,
+		}, true, nil
+	}
+
+	if options.ResetCheckpoint {
+		return eventOutput.InProgressQuery{}, true, nil
+	}
+
+	if lastCompletedQuery == (eventOutput.InProgressQuery{}) {
+		return eventOutput.InProgressQuery{}, false, nil
+	}
+
+	defaultQueryTimes, err := getOnOrBeforeAndAfter(query)
+
+	if err != nil {
+		return eventOutput.InProgressQuery{}, false, err
+	}
+
+	if defaultQueryTimes.OnOrAfter.After(lastCompletedQuery.OnOrBefore) {
+		return eventOutput.InProgressQuery{}, true, nil
+	}
+
+	return lastCompletedQuery, false, nil
+}
+
+/*
+discardInProgressQueries - drops the stored in progress queries of an ffs query whose progress is discarded
+The dropped windows will not be pulled by the query, so each one is logged for it to be backfilled if needed
+Returns
+[]eventOutput.InProgressQuery - the in progress queries to keep, always none
+*/
+func discardInProgressQueries(query config.FFSQuery, inProgressQueries []eventOutput.InProgressQuery) []eventOutput.InProgressQuery {
+	for _, inProgressQuery := range inProgressQueries {
+		log.Println("Dropping in progress window: " + inProgressQuery.OnOrAfter.String() + " to " + inProgressQuery.OnOrBefore.String() + " for ffs query: " + query.Name + ", use the backfill command to pull it")
+	}
+
+	return nil
+}
+
 func getNewerTimeQuery(lastInProgressQuery eventOutput.InProgressQuery, lastCompletedQuery eventOutput.InProgressQuery) eventOutput.InProgressQuery {
 	if lastCompletedQuery.OnOrBefore.Sub(lastInProgressQuery.OnOrAfter) <= 0 {
 		return lastInProgressQuery
@@ -0,0 +1,294 @@
+package ffsEvent
+
+import (
+	"github.com/BenB196/crashplan-ffs-go-pkg"
+	"github.com/BenB196/crashplan-ffs-puller/config"
+	"github.com/BenB196/crashplan-ffs-puller/eventOutput"
+	"testing"
+	"time"
+)
+
+//testTime parses an RFC3339 time, failing the test if it is bad
+func testTime(t *testing.T, value string) time.Time {
+	t.Helper()
+
+	parsed, err := time.Parse(time.RFC3339Nano, value)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return parsed
+}
+
+//testQuery builds an ffs query windowed on insertionTimestamp, empty times are left empty like in the config
+func testQuery(onOrAfter string, onOrBefore string, timeGap string) config.FFSQuery {
+	return config.FFSQuery{
+		Name:          "test",
+		TimeGap:       timeGap,
+		TimestampTerm: "insertionTimestamp",
+		Query: ffs.Query{
+			Groups: []ffs.Group{{
+				Filters: []ffs.SearchFilter{
+					{Term: "insertionTimestamp", Operator: "ON_OR_AFTER", Value: onOrAfter},
+					{Term: "insertionTimestamp", Operator: "ON_OR_BEFORE", Value: onOrBefore},
+				},
+				FilterClause: "AND",
+			}},
+			GroupClause: "AND",
+		},
+	}
+}
+
+func TestCalculateTimeStamps(t *testing.T) {
+	window := func(onOrAfter string, onOrBefore string) eventOutput.InProgressQuery {
+		return eventOutput.InProgressQuery{OnOrAfter: testTime(t, onOrAfter), OnOrBefore: testTime(t, onOrBefore)}
+	}
+
+	tests := []struct {
+		name               string
+		query              config.FFSQuery
+		inProgressQueries  []eventOutput.InProgressQuery
+		lastCompletedQuery eventOutput.InProgressQuery
+		maxTime            string
+		want               eventOutput.InProgressQuery
+		wantDone           bool
+	}{
+		{
+			name:  "first query starts at the config start",
+			query: testQuery("2020-01-01T00:00:00.000Z", "", "1h"),
+			want:  window("2020-01-01T00:00:00.000Z", "2020-01-01T01:00:00.000Z"),
+		},
+		{
+			name:  "config start moved forward starts at the new config start",
+			query: testQuery("2020-06-01T00:00:00.000Z", "", "1h"),
+			want:  window("2020-06-01T00:00:00.000Z", "2020-06-01T01:00:00.000Z"),
+		},
+		{
+			name:               "resumes 1ms after the last completed query",
+			query:              testQuery("2020-01-01T00:00:00.000Z", "", "1h"),
+			lastCompletedQuery: window("2020-01-02T00:00:00.000Z", "2020-01-02T01:00:00.000Z"),
+			want:               window("2020-01-02T01:00:00.001Z", "2020-01-02T02:00:00.001Z"),
+		},
+		{
+			name:              "without a last completed query follows the last in progress query",
+			query:             testQuery("2020-01-01T00:00:00.000Z", "", "1h"),
+			inProgressQueries: []eventOutput.InProgressQuery{window("2020-01-03T00:00:00.000Z", "2020-01-03T01:00:00.000Z")},
+			want:              window("2020-01-03T01:00:00.001Z", "2020-01-03T02:00:00.001Z"),
+		},
+		{
+			name:               "follows an in progress query newer than the last completed query",
+			query:              testQuery("2020-01-01T00:00:00.000Z", "", "1h"),
+			inProgressQueries:  []eventOutput.InProgressQuery{window("2020-01-03T00:00:00.000Z", "2020-01-03T01:00:00.000Z")},
+			lastCompletedQuery: window("2020-01-02T00:00:00.000Z", "2020-01-02T01:00:00.000Z"),
+			want:               window("2020-01-03T01:00:00.001Z", "2020-01-03T02:00:00.001Z"),
+		},
+		{
+			name:               "follows a last completed query newer than the in progress query",
+			query:              testQuery("2020-01-01T00:00:00.000Z", "", "1h"),
+			inProgressQueries:  []eventOutput.InProgressQuery{window("2020-01-02T00:00:00.000Z", "2020-01-02T01:00:00.000Z")},
+			lastCompletedQuery: window("2020-01-03T00:00:00.000Z", "2020-01-03T01:00:00.000Z"),
+			want:               window("2020-01-03T01:00:00.001Z", "2020-01-03T02:00:00.001Z"),
+		},
+		{
+			name:               "window is cut short at the max time",
+			query:              testQuery("2020-01-01T00:00:00.000Z", "2020-01-01T01:30:00.000Z", "1h"),
+			lastCompletedQuery: window("2020-01-01T00:00:00.000Z", "2020-01-01T01:00:00.000Z"),
+			maxTime:            "2020-01-01T01:30:00.000Z",
+			want:               window("2020-01-01T01:00:00.001Z", "2020-01-01T01:30:00.000Z"),
+		},
+		{
+			name:               "done once the max time is reached",
+			query:              testQuery("2020-01-01T00:00:00.000Z", "2020-01-01T01:00:00.000Z", "1h"),
+			lastCompletedQuery: window("2020-01-01T00:00:00.000Z", "2020-01-01T01:00:00.000Z"),
+			maxTime:            "2020-01-01T01:00:00.000Z",
+			wantDone:           true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var maxTime time.Time
+			if test.maxTime != "" {
+				maxTime = testTime(t, test.maxTime)
+			}
+
+			query, done, err := calculateTimeStamps(test.inProgressQueries, test.lastCompletedQuery, test.query, maxTime)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if done != test.wantDone {
+				t.Fatalf("done = %v, want %v", done, test.wantDone)
+			}
+
+			if done {
+				return
+			}
+
+			got, err := getOnOrBeforeAndAfter(query)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if *got != test.want {
+				t.Errorf("window = %v to %v, want %v to %v", got.OnOrAfter, got.OnOrBefore, test.want.OnOrAfter, test.want.OnOrBefore)
+			}
+		})
+	}
+}
+
+func TestCalculateTimeStampsNoGoWindow(t *testing.T) {
+	//Code42 events are only ready to be pulled 15 minutes after they happen
+	noGo := time.Now().UTC().Add(-15 * time.Minute)
+
+	t.Run("window starting in the no go window is not ready", func(t *testing.T) {
+		start := noGo.Add(5 * time.Minute).Format("2006-01-02T15:04:05.000Z")
+
+		_, _, err := calculateTimeStamps(nil, eventOutput.InProgressQuery{}, testQuery(start, "", "1h"), time.Time{})
+
+		if err != errWindowNotReady {
+			t.Fatalf("err = %v, want %v", err, errWindowNotReady)
+		}
+	})
+
+	t.Run("window ending in the no go window is cut short", func(t *testing.T) {
+		start := noGo.Add(-5 * time.Minute).Format("2006-01-02T15:04:05.000Z")
+
+		query, _, err := calculateTimeStamps(nil, eventOutput.InProgressQuery{}, testQuery(start, "", "1h"), time.Time{})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, _ := getOnOrBeforeAndAfter(query)
+
+		if got.OnOrBefore.After(time.Now().UTC().Add(-15*time.Minute)) || got.OnOrBefore.Before(noGo.Add(-time.Second)) {
+			t.Errorf("ON_OR_BEFORE = %v, want about %v", got.OnOrBefore, noGo)
+		}
+	})
+}
+
+func TestGetNewerTimeQuery(t *testing.T) {
+	older := eventOutput.InProgressQuery{OnOrAfter: testTime(t, "2020-01-01T00:00:00Z"), OnOrBefore: testTime(t, "2020-01-01T01:00:00Z")}
+	newer := eventOutput.InProgressQuery{OnOrAfter: testTime(t, "2020-01-01T01:00:00.001Z"), OnOrBefore: testTime(t, "2020-01-01T02:00:00.001Z")}
+	overlapping := eventOutput.InProgressQuery{OnOrAfter: testTime(t, "2020-01-01T00:30:00Z"), OnOrBefore: testTime(t, "2020-01-01T01:30:00Z")}
+	touching := eventOutput.InProgressQuery{OnOrAfter: testTime(t, "2020-01-01T01:00:00Z"), OnOrBefore: testTime(t, "2020-01-01T02:00:00Z")}
+
+	tests := []struct {
+		name                string
+		lastInProgressQuery eventOutput.InProgressQuery
+		lastCompletedQuery  eventOutput.InProgressQuery
+		want                eventOutput.InProgressQuery
+	}{
+		{name: "in progress query after the last completed query", lastInProgressQuery: newer, lastCompletedQuery: older, want: newer},
+		{name: "in progress query before the last completed query", lastInProgressQuery: older, lastCompletedQuery: newer, want: newer},
+		{name: "in progress query starting where the last completed query ends", lastInProgressQuery: touching, lastCompletedQuery: older, want: touching},
+		{name: "in progress query overlapping the last completed query", lastInProgressQuery: overlapping, lastCompletedQuery: older, want: older},
+		{name: "same query", lastInProgressQuery: older, lastCompletedQuery: older, want: older},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := getNewerTimeQuery(test.lastInProgressQuery, test.lastCompletedQuery); got != test.want {
+				t.Errorf("getNewerTimeQuery = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestGetResumePoint(t *testing.T) {
+	stored := eventOutput.InProgressQuery{OnOrAfter: testTime(t, "2020-03-01T00:00:00Z"), OnOrBefore: testTime(t, "2020-03-01T01:00:00Z")}
+	startFrom := testTime(t, "2020-05-01T00:00:00Z")
+
+	tests := []struct {
+		name               string
+		query              config.FFSQuery
+		lastCompletedQuery eventOutput.InProgressQuery
+		options            ResumeOptions
+		want               eventOutput.InProgressQuery
+		wantDiscard        bool
+	}{
+		{
+			name:  "no stored checkpoint starts from the config",
+			query: testQuery("2020-01-01T00:00:00.000Z", "", "1h"),
+		},
+		{
+			name:               "stored checkpoint ahead of the config start resumes from the checkpoint",
+			query:              testQuery("2020-01-01T00:00:00.000Z", "", "1h"),
+			lastCompletedQuery: stored,
+			want:               stored,
+		},
+		{
+			name:               "config start moved back before the checkpoint resumes from the checkpoint",
+			query:              testQuery("2019-01-01T00:00:00.000Z", "", "1h"),
+			lastCompletedQuery: stored,
+			want:               stored,
+		},
+		{
+			name:               "stored checkpoint behind the config start discards it",
+			query:              testQuery("2020-04-01T00:00:00.000Z", "", "1h"),
+			lastCompletedQuery: stored,
+			wantDiscard:        true,
+		},
+		{
+			name:               "no config start resumes from the checkpoint",
+			query:              testQuery("", "", "1h"),
+			lastCompletedQuery: stored,
+			want:               stored,
+		},
+		{
+			name:               "reset checkpoint starts from the config",
+			query:              testQuery("2020-01-01T00:00:00.000Z", "", "1h"),
+			lastCompletedQuery: stored,
+			options:            ResumeOptions{ResetCheckpoint: true},
+			wantDiscard:        true,
+		},
+		{
+			name:               "start from starts 1ms after the pretend last completed query",
+			query:              testQuery("2020-01-01T00:00:00.000Z", "", "1h"),
+			lastCompletedQuery: stored,
+			options:            ResumeOptions{StartFrom: startFrom},
+			want:               eventOutput.InProgressQuery{OnOrAfter: startFrom.Add(-time.Millisecond), OnOrBefore: startFrom.Add(-time.Millisecond)},
+			wantDiscard:        true,
+		},
+		{
+			name:        "start from wins over reset checkpoint",
+			query:       testQuery("2020-01-01T00:00:00.000Z", "", "1h"),
+			options:     ResumeOptions{ResetCheckpoint: true, StartFrom: startFrom},
+			want:        eventOutput.InProgressQuery{OnOrAfter: startFrom.Add(-time.Millisecond), OnOrBefore: startFrom.Add(-time.Millisecond)},
+			wantDiscard: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, discard, err := getResumePoint(test.query, test.lastCompletedQuery, test.options)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != test.want {
+				t.Errorf("resume point = %v, want %v", got, test.want)
+			}
+
+			if discard != test.wantDiscard {
+				t.Errorf("discard = %v, want %v", discard, test.wantDiscard)
+			}
+		})
+	}
+}
+
+func TestDiscardInProgressQueries(t *testing.T) {
+	inProgressQueries := []eventOutput.InProgressQuery{
+		{OnOrAfter: testTime(t, "2020-01-01T00:00:00Z"), OnOrBefore: testTime(t, "2020-01-01T01:00:00Z")},
+		{OnOrAfter: testTime(t, "2020-01-01T01:00:00.001Z"), OnOrBefore: testTime(t, "2020-01-01T02:00:00.001Z")},
+	}
+
+	if kept := discardInProgressQueries(testQuery("", "", "1h"), inProgressQueries); len(kept) != 0 {
+		t.Errorf("kept %d in progress queries when discarding, want 0", len(kept))
+	}
+}
@@ -0,0 +1,112 @@
+package ffsEvent
+
+import (
+	"github.com/BenB196/crashplan-ffs-puller/config"
+	"github.com/BenB196/crashplan-ffs-puller/promMetrics"
+	"sync"
+)
+
+/*
+windowScheduler queues the window fetches of every ffs query and hands out a fixed number of fetch slots between them
+Queries with a higher priority are always served first, queries with the same priority share the slots in proportion to their weight
+*/
+type windowScheduler struct {
+	mutex   sync.Mutex
+	slots   int
+	running int
+	queues  map[string]*windowQueue
+	//pass of the last dispatched fetch, used to stop a query which has been idle from jumping ahead of busy ones
+	pass float64
+}
+
+//windowQueue is the queue of fetches waiting for a single ffs query
+type windowQueue struct {
+	priority int
+	weight   int
+	pass     float64
+	waiting  []chan struct{}
+}
+
+//ffsWindowScheduler is shared by every ffs query, it does not limit anything until InitWindowScheduler is called
+var ffsWindowScheduler = &windowScheduler{queues: map[string]*windowQueue{}}
+
+/*
+InitWindowScheduler - sets up the process wide window fetch scheduler from the configuration
+Must be called before any ffs queries are started
+*/
+func InitWindowScheduler(configuration config.Config) {
+	ffsWindowScheduler = &windowScheduler{
+		slots:  configuration.Scheduler.MaxConcurrentWindows,
+		queues: map[string]*windowQueue{},
+	}
+}
+
+/*
+run - waits for a fetch slot for the query and then runs fetch, blocking until it has completed
+*/
+func (scheduler *windowScheduler) run(query config.FFSQuery, fetch func()) {
+	if scheduler.slots < 1 {
+		fetch()
+		return
+	}
+
+	granted := make(chan struct{})
+
+	scheduler.mutex.Lock()
+	queue, found := scheduler.queues[query.Name]
+	if !found {
+		queue = &windowQueue{}
+		scheduler.queues[query.Name] = queue
+	}
+	queue.priority = query.Priority
+	queue.weight = query.Weight
+	if len(queue.waiting) == 0 && queue.pass < scheduler.pass {
+		queue.pass = scheduler.pass
+	}
+	queue.waiting = append(queue.waiting, granted)
+	promMetrics.SetQueuedWindows(query.Name, len(queue.waiting))
+	scheduler.dispatch()
+	scheduler.mutex.Unlock()
+
+	<-granted
+
+	defer func() {
+		scheduler.mutex.Lock()
+		scheduler.running--
+		scheduler.dispatch()
+		scheduler.mutex.Unlock()
+	}()
+
+	fetch()
+}
+
+//dispatch grants free slots to the waiting fetches, must be called with the mutex held
+func (scheduler *windowScheduler) dispatch() {
+	for scheduler.running < scheduler.slots {
+		var nextName string
+		var next *windowQueue
+		for name, queue := range scheduler.queues {
+			if len(queue.waiting) == 0 {
+				continue
+			}
+			if next == nil || queue.priority > next.priority ||
+				(queue.priority == next.priority && (queue.pass < next.pass || (queue.pass == next.pass && name < nextName))) {
+				nextName = name
+				next = queue
+			}
+		}
+
+		if next == nil {
+			return
+		}
+
+		granted := next.waiting[0]
+		next.waiting = next.waiting[1:]
+		scheduler.pass = next.pass
+		next.pass = next.pass + 1/float64(next.weight)
+		scheduler.running++
+		promMetrics.SetQueuedWindows(nextName, len(next.waiting))
+
+		close(granted)
+	}
+}
@@ -1,13 +1,17 @@
 package main
 
 import (
+	"errors"
 	"flag"
+	"fmt"
 	"github.com/BenB196/crashplan-ffs-puller/config"
+	"github.com/BenB196/crashplan-ffs-puller/elasticsearch"
 	"github.com/BenB196/crashplan-ffs-puller/ffsEvent"
 	"github.com/BenB196/crashplan-ffs-puller/ip-api-local"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"log"
 	"net/http"
+	"os"
 	"strconv"
 	"sync"
 	"time"
@@ -15,10 +19,29 @@ import (
 
 func main() {
 
+	//Handle subcommands before the default flags are parsed
+	if len(os.Args) > 1 && os.Args[1] == "backfill" {
+		runBackfill(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "migrate-index" {
+		runMigrateIndex(os.Args[2:])
+		return
+	}
+
 	//Get Config location and get config struct
 	var configLocation string
 	flag.StringVar(&configLocation,"config","","Configuation File Location. REQUIRED") //TODO improve usage description
 
+	//Get overrides for where queries start from
+	var resetCheckpoint bool
+	var startFrom string
+	flag.BoolVar(&resetCheckpoint, "reset-checkpoint", false, "Discard the stored progress of every query and start from the ON_OR_AFTER in the config")
+	flag.StringVar(&startFrom, "start-from", "", "Discard the stored progress of every query and start from this time, in RFC3339 format")
+
+	//Print the effective config and exit, for debugging defaults and profiles
+	var printConfig bool
+	flag.BoolVar(&printConfig, "print-config", false, "Print the config with defaults and profiles applied to each query, with passwords masked, and exit")
 
 	//Parse Flags
 	flag.Parse()
@@ -28,6 +51,21 @@ func main() {
 		panic("config flag missing, required.")
 	}
 
+	resumeOptions := ffsEvent.ResumeOptions{
+		ResetCheckpoint: resetCheckpoint,
+	}
+
+	if startFrom != "" {
+		startFromTime, err := time.Parse(time.RFC3339Nano, startFrom)
+
+		if err != nil {
+			panic(errors.New("error: bad start-from time provided: " + err.Error()))
+		}
+
+		//FFS queries only go down to the millisecond
+		resumeOptions.StartFrom = startFromTime.UTC().Truncate(time.Millisecond)
+	}
+
 	//Get config struct
 	configuration, err := config.ReadConfig(configLocation)
 
@@ -36,10 +74,49 @@ func main() {
 		panic(err)
 	}
 
+	if printConfig {
+		configJson, err := config.MaskedConfigJson(*configuration)
+
+		if err != nil {
+			panic(err)
+		}
+
+		fmt.Println(string(configJson))
+		return
+	}
+
 	//Print Auth and FFS URIs for debugging
 	log.Println(configuration.AuthURI)
 	log.Println(configuration.FFSURI)
 
+	initIpApiCache(*configuration)
+	ffsEvent.InitRateLimiter(*configuration)
+	ffsEvent.InitWindowScheduler(*configuration)
+
+	//Spawn goroutines for each ffs query provided
+	var wg sync.WaitGroup
+	wg.Add(len(configuration.FFSQueries))
+	go func() {
+		for _, query := range configuration.FFSQueries {
+			go ffsEvent.FFSQuery(*configuration, query, resumeOptions)
+			wg.Done()
+		}
+	}()
+
+	if configuration.Prometheus.Enabled {
+		//startup prometheus metrics port
+		http.Handle("/metrics",promhttp.Handler())
+
+		log.Fatal(http.ListenAndServe(":" + strconv.Itoa(configuration.Prometheus.Port), nil))
+	}
+
+	wg.Wait()
+}
+
+/*
+initIpApiCache - reads the persisted ip-api cache and starts writing it on its interval, if enabled
+*/
+func initIpApiCache(configuration config.Config) {
 	if configuration.IPAPI.Enabled && configuration.IPAPI.LocalCache.Enabled &&
 		configuration.IPAPI.LocalCache.Persist {
 		//read ip-api proxy if enabled
@@ -56,25 +133,175 @@ func main() {
 			}
 		}()
 	}
+}
 
+/*
+runBackfill - runs the backfill subcommand, which pulls a fixed time range for a single ffs query and exits
+args - the command line arguments following "backfill"
+*/
+func runBackfill(args []string) {
+	backfillFlags := flag.NewFlagSet("backfill", flag.ExitOnError)
 
+	var configLocation string
+	var queryName string
+	var start string
+	var end string
+	var window time.Duration
+	var resume bool
+	backfillFlags.StringVar(&configLocation, "config", "", "Configuation File Location. REQUIRED")
+	backfillFlags.StringVar(&queryName, "query", "", "Name of the ffs query to backfill. REQUIRED")
+	backfillFlags.StringVar(&start, "start", "", "Start of the time range to backfill, in RFC3339 format. REQUIRED unless resuming")
+	backfillFlags.StringVar(&end, "end", "", "End of the time range to backfill, in RFC3339 format. Default: the end of the saved backfill with the same start, or 15 minutes ago")
+	backfillFlags.DurationVar(&window, "window", 0, "Size of each backfill window, in a Golang duration format. Default: the query's timeGap")
+	backfillFlags.BoolVar(&resume, "resume", false, "Resume the interrupted backfill of the query instead of starting a new one")
 
-	//Spawn goroutines for each ffs query provided
-	var wg sync.WaitGroup
-	wg.Add(len(configuration.FFSQueries))
-	go func() {
-		for _, query := range configuration.FFSQueries {
-			go ffsEvent.FFSQuery(*configuration, query)
-			wg.Done()
+	//Parse Flags
+	_ = backfillFlags.Parse(args)
+
+	if configLocation == "" {
+		panic("config flag missing, required.")
+	}
+
+	if queryName == "" {
+		panic("query flag missing, required.")
+	}
+
+	//Get config struct
+	configuration, err := config.ReadConfig(configLocation)
+
+	if err != nil {
+		log.Println("Error parsing config file.")
+		panic(err)
+	}
+
+	var query *config.FFSQuery
+	for i := range configuration.FFSQueries {
+		if configuration.FFSQueries[i].Name == queryName {
+			query = &configuration.FFSQueries[i]
 		}
-	}()
+	}
 
-	if configuration.Prometheus.Enabled {
-		//startup prometheus metrics port
-		http.Handle("/metrics",promhttp.Handler())
+	if query == nil {
+		panic(errors.New("error: no ffs query named: " + queryName + ", found in config"))
+	}
 
-		log.Fatal(http.ListenAndServe(":" + strconv.Itoa(configuration.Prometheus.Port), nil))
+	var onOrAfter time.Time
+	var onOrBefore time.Time
+	if !resume {
+		if start == "" {
+			panic("start flag missing, required unless resuming.")
+		}
+
+		onOrAfter, err = time.Parse(time.RFC3339Nano, start)
+
+		if err != nil {
+			panic(errors.New("error: bad start time provided: " + err.Error()))
+		}
+
+		//an empty end is resolved by the backfill, from its saved progress or the current time
+		if end != "" {
+			onOrBefore, err = time.Parse(time.RFC3339Nano, end)
+
+			if err != nil {
+				panic(errors.New("error: bad end time provided: " + err.Error()))
+			}
+		}
+
+		//FFS queries only go down to the millisecond
+		onOrAfter = onOrAfter.UTC().Truncate(time.Millisecond)
+		onOrBefore = onOrBefore.UTC().Truncate(time.Millisecond)
 	}
 
-	wg.Wait()
-}
\ No newline at end of file
+	initIpApiCache(*configuration)
+	ffsEvent.InitRateLimiter(*configuration)
+	ffsEvent.InitWindowScheduler(*configuration)
+
+	err = ffsEvent.Backfill(*configuration, *query, onOrAfter, onOrBefore, window, resume)
+
+	if err != nil {
+		panic(err)
+	}
+
+	//Make sure the ip-api cache is written before exiting
+	if configuration.IPAPI.Enabled && configuration.IPAPI.LocalCache.Enabled &&
+		configuration.IPAPI.LocalCache.Persist {
+		ip_api_local.WriteCache(&configuration.IPAPI.LocalCache.WriteLocation)
+	}
+}
+
+/*
+runMigrateIndex - runs the migrate-index subcommand, which reindexes the indices of a single ffs query in a time range into the current mapping and exits
+args - the command line arguments following "migrate-index"
+*/
+func runMigrateIndex(args []string) {
+	migrateFlags := flag.NewFlagSet("migrate-index", flag.ExitOnError)
+
+	var configLocation string
+	var queryName string
+	var start string
+	var end string
+	var options elasticsearch.MigrateOptions
+	migrateFlags.StringVar(&configLocation, "config", "", "Configuation File Location. REQUIRED")
+	migrateFlags.StringVar(&queryName, "query", "", "Name of the ffs query whose indices are migrated. REQUIRED")
+	migrateFlags.StringVar(&start, "start", "", "Start of the time range of indices to migrate, in RFC3339 format. REQUIRED")
+	migrateFlags.StringVar(&end, "end", "", "End of the time range of indices to migrate, in RFC3339 format. Default: now")
+	migrateFlags.StringVar(&options.Transform, "transform", "none", "Name of the transform each event is run through")
+	migrateFlags.IntVar(&options.BatchSize, "batch-size", 1000, "Number of events read and written in each request")
+	migrateFlags.BoolVar(&options.DryRun, "dry-run", false, "Only log which indices would be migrated")
+
+	//Parse Flags
+	_ = migrateFlags.Parse(args)
+
+	if configLocation == "" {
+		panic("config flag missing, required.")
+	}
+
+	if queryName == "" {
+		panic("query flag missing, required.")
+	}
+
+	if start == "" {
+		panic("start flag missing, required.")
+	}
+
+	//Get config struct
+	configuration, err := config.ReadConfig(configLocation)
+
+	if err != nil {
+		log.Println("Error parsing config file.")
+		panic(err)
+	}
+
+	var query *config.FFSQuery
+	for i := range configuration.FFSQueries {
+		if configuration.FFSQueries[i].Name == queryName {
+			query = &configuration.FFSQueries[i]
+		}
+	}
+
+	if query == nil {
+		panic(errors.New("error: no ffs query named: " + queryName + ", found in config"))
+	}
+
+	options.Start, err = time.Parse(time.RFC3339Nano, start)
+
+	if err != nil {
+		panic(errors.New("error: bad start time provided: " + err.Error()))
+	}
+
+	if end == "" {
+		options.End = time.Now()
+	} else {
+		options.End, err = time.Parse(time.RFC3339Nano, end)
+
+		if err != nil {
+			panic(errors.New("error: bad end time provided: " + err.Error()))
+		}
+	}
+
+	err = ffsEvent.MigrateIndices(*query, options)
+
+	if err != nil {
+		panic(err)
+	}
+}
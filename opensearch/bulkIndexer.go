@@ -0,0 +1,221 @@
+package opensearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/BenB196/crashplan-ffs-puller/config"
+	"github.com/BenB196/crashplan-ffs-puller/promMetrics"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+/*
+BulkIndexer queues the events of an ffs query and sends them to opensearch in bulk requests
+A bulk request is sent once the bulk actions or size are reached, the flush interval passes, or the indexer is flushed
+*/
+type BulkIndexer struct {
+	client    *Client
+	queryName string
+	pipeline  string
+	actions   int
+	size      int
+	mutex     sync.Mutex
+	buffer    bytes.Buffer
+	queued    int64
+	committed int64
+	failed    int64
+	indexed   int64
+	//the first failed bulk request or rejected event, which is kept so that every later flush fails instead of completing a window without its events
+	err error
+}
+
+//sharedBulkIndexers holds the bulk indexer of each ffs query, which lives for as long as the puller runs
+var sharedBulkIndexers = struct {
+	mutex    sync.Mutex
+	indexers map[string]*BulkIndexer
+}{indexers: map[string]*BulkIndexer{}}
+
+/*
+GetBulkIndexer - gets the bulk indexer of an ffs query, starting it on first use
+*/
+func GetBulkIndexer(client *Client, queryName string, elasticConfig config.Elasticsearch) *BulkIndexer {
+	sharedBulkIndexers.mutex.Lock()
+	defer sharedBulkIndexers.mutex.Unlock()
+
+	if indexer, found := sharedBulkIndexers.indexers[queryName]; found {
+		return indexer
+	}
+
+	indexer := &BulkIndexer{
+		client:    client,
+		queryName: queryName,
+		pipeline:  elasticConfig.Pipeline,
+		actions:   elasticConfig.Bulk.Actions,
+		size:      elasticConfig.Bulk.Size,
+	}
+
+	//validated when the config is read
+	if elasticConfig.Bulk.FlushInterval != "" {
+		flushInterval, _ := time.ParseDuration(elasticConfig.Bulk.FlushInterval)
+		go indexer.flushEvery(flushInterval)
+	}
+
+	sharedBulkIndexers.indexers[queryName] = indexer
+
+	return indexer
+}
+
+/*
+Add - queues an event, sending the queued events if a bulk limit is reached
+Returns
+error - any errors which have been caught
+*/
+func (indexer *BulkIndexer) Add(ctx context.Context, indexName string, doc interface{}) error {
+	action := map[string]interface{}{"_index": indexName}
+	if indexer.pipeline != "" {
+		action["pipeline"] = indexer.pipeline
+	}
+
+	actionBytes, err := json.Marshal(map[string]interface{}{"index": action})
+
+	if err != nil {
+		return err
+	}
+
+	docBytes, err := json.Marshal(doc)
+
+	if err != nil {
+		return err
+	}
+
+	indexer.mutex.Lock()
+	defer indexer.mutex.Unlock()
+
+	indexer.buffer.Write(actionBytes)
+	indexer.buffer.WriteByte('\n')
+	indexer.buffer.Write(docBytes)
+	indexer.buffer.WriteByte('\n')
+	indexer.queued++
+
+	if indexer.queued >= int64(indexer.actions) || indexer.buffer.Len() >= indexer.size {
+		return indexer.flush(ctx)
+	}
+
+	return nil
+}
+
+/*
+Flush - sends every queued event
+Returns
+error - any errors which have been caught
+*/
+func (indexer *BulkIndexer) Flush(ctx context.Context) error {
+	indexer.mutex.Lock()
+	defer indexer.mutex.Unlock()
+
+	err := indexer.flush(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	//events sent by an earlier flush, ex: on the flush interval, may have been rejected
+	return indexer.err
+}
+
+/*
+ExportStats - sets the bulk metrics of the ffs query from the stats of its bulk indexer
+*/
+func (indexer *BulkIndexer) ExportStats() {
+	indexer.mutex.Lock()
+	defer indexer.mutex.Unlock()
+
+	promMetrics.SetBulkStats(indexer.queryName, indexer.queued, indexer.committed, indexer.failed, indexer.indexed)
+}
+
+//flushEvery flushes the queued events on an interval
+func (indexer *BulkIndexer) flushEvery(flushInterval time.Duration) {
+	for range time.Tick(flushInterval) {
+		err := indexer.Flush(context.Background())
+
+		if err != nil {
+			log.Println("error flushing opensearch bulk request for ffs query: " + indexer.queryName + ", " + err.Error())
+		}
+	}
+}
+
+//flush sends the queued events in a single bulk request, must be called with the mutex held
+func (indexer *BulkIndexer) flush(ctx context.Context) error {
+	if indexer.queued == 0 {
+		return nil
+	}
+
+	queued := indexer.queued
+	body := make([]byte, indexer.buffer.Len())
+	copy(body, indexer.buffer.Bytes())
+	indexer.buffer.Reset()
+	indexer.queued = 0
+
+	_, responseBody, err := indexer.client.performRequest(ctx, http.MethodPost, "/_bulk", "application/x-ndjson", body, nil)
+
+	if err != nil {
+		indexer.failed += queued
+		return indexer.fail(errors.New("error sending opensearch bulk request: " + err.Error()))
+	}
+
+	indexer.committed++
+
+	var response struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Status int `json:"status"`
+			Error  *struct {
+				Type   string `json:"type"`
+				Reason string `json:"reason"`
+			} `json:"error"`
+		} `json:"items"`
+	}
+	err = json.Unmarshal(responseBody, &response)
+
+	if err != nil {
+		return indexer.fail(errors.New("error reading opensearch bulk response: " + err.Error()))
+	}
+
+	var failed int64
+	var firstError string
+	for _, item := range response.Items {
+		for _, result := range item {
+			if result.Error == nil {
+				indexer.indexed++
+				continue
+			}
+
+			failed++
+			if firstError == "" {
+				firstError = result.Error.Type + ": " + result.Error.Reason
+			}
+		}
+	}
+
+	//rejected documents fail the flush, so the windows they came from are not completed
+	if failed > 0 {
+		indexer.failed += failed
+		return indexer.fail(errors.New("opensearch bulk request for ffs query: " + indexer.queryName + " had " + strconv.FormatInt(failed, 10) + " failed documents, first error: " + firstError))
+	}
+
+	return nil
+}
+
+//fail records the first failure of the indexer and returns err, must be called with the mutex held
+func (indexer *BulkIndexer) fail(err error) error {
+	if indexer.err == nil {
+		indexer.err = err
+	}
+
+	return err
+}
@@ -0,0 +1,225 @@
+package opensearch
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/BenB196/crashplan-ffs-puller/config"
+	"github.com/BenB196/crashplan-ffs-puller/elasticsearch"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//minimumMajorVersion is the first opensearch version with composable index templates and the _plugins ism api
+const minimumMajorVersion = 1
+
+/*
+Client is a thin opensearch client over net/http
+It only checks the distribution of the cluster it talks to, so it keeps working with opensearch versions which the elastic client rejects
+*/
+type Client struct {
+	urls           []string
+	httpClient     *http.Client
+	authorization  string
+	gzip           bool
+	maxRetries     int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+}
+
+/*
+BuildOpenSearchClient - builds the opensearch client of an ffs query from the connection, auth, tls, and retry options of its elasticsearch block
+Returns
+*Client - the opensearch client
+error - any errors which have been caught
+*/
+func BuildOpenSearchClient(elasticConfig config.Elasticsearch) (*Client, error) {
+	httpClient, err := elasticsearch.BuildHttpClient(elasticConfig.TLS)
+
+	if err != nil {
+		return nil, errors.New("error: failed to create opensearch client: " + err.Error())
+	}
+
+	var urls []string
+	for _, openSearchURL := range elasticConfig.ElasticURL {
+		urls = append(urls, strings.TrimSuffix(openSearchURL, "/"))
+	}
+
+	var authorization string
+	if elasticConfig.BasicAuth.User != "" {
+		authorization = "Basic " + base64.StdEncoding.EncodeToString([]byte(elasticConfig.BasicAuth.User+":"+elasticConfig.BasicAuth.Password))
+	} else if elasticConfig.BearerToken != "" {
+		authorization = "Bearer " + elasticConfig.BearerToken
+	}
+
+	initialBackoff, maxBackoff := elasticsearch.BuildRetryBackoffs(elasticConfig.Retry)
+
+	return &Client{
+		urls:           urls,
+		httpClient:     httpClient,
+		authorization:  authorization,
+		gzip:           elasticConfig.Bulk.Gzip,
+		maxRetries:     elasticConfig.Retry.MaxRetries,
+		initialBackoff: initialBackoff,
+		maxBackoff:     maxBackoff,
+	}, nil
+}
+
+/*
+CheckCompatibility - gets the version of the cluster and checks that it is opensearch, and new enough for the templates and ism
+Returns
+string - the version of the cluster
+error - any errors which have been caught
+*/
+func (client *Client) CheckCompatibility(ctx context.Context) (string, error) {
+	_, responseBody, err := client.PerformRequest(ctx, http.MethodGet, "/", nil)
+
+	if err != nil {
+		return "", errors.New("error reaching opensearch server: " + err.Error())
+	}
+
+	var info struct {
+		Version struct {
+			Distribution string `json:"distribution"`
+			Number       string `json:"number"`
+		} `json:"version"`
+	}
+	err = json.Unmarshal(responseBody, &info)
+
+	if err != nil {
+		return "", errors.New("error reading opensearch server info: " + err.Error())
+	}
+
+	//elasticsearch does not set a distribution
+	if info.Version.Distribution != "opensearch" {
+		return "", errors.New("error: the cluster is not opensearch, version: " + info.Version.Number + ", use the elastic output type for elasticsearch")
+	}
+
+	majorVersion, err := strconv.Atoi(strings.SplitN(info.Version.Number, ".", 2)[0])
+
+	if err != nil {
+		return "", errors.New("error reading opensearch version: " + info.Version.Number)
+	}
+
+	if majorVersion < minimumMajorVersion {
+		return "", errors.New("error: opensearch version: " + info.Version.Number + " is not supported, the minimum version is " + strconv.Itoa(minimumMajorVersion) + ".0")
+	}
+
+	return info.Version.Number, nil
+}
+
+/*
+PerformRequest - sends a request to opensearch, body is sent as json unless it is a string
+Responses with a status code in ignoreErrors are returned without an error
+Returns
+int - the status code of the response
+[]byte - the body of the response
+error - any errors which have been caught
+*/
+func (client *Client) PerformRequest(ctx context.Context, method string, path string, body interface{}, ignoreErrors ...int) (int, []byte, error) {
+	var bodyBytes []byte
+	var err error
+
+	switch requestBody := body.(type) {
+	case nil:
+	case string:
+		bodyBytes = []byte(requestBody)
+	default:
+		bodyBytes, err = json.Marshal(requestBody)
+
+		if err != nil {
+			return 0, nil, err
+		}
+	}
+
+	return client.performRequest(ctx, method, path, "application/json", bodyBytes, ignoreErrors)
+}
+
+//performRequest sends a request to a random node, retrying connection errors and overloaded nodes with an exponential backoff
+func (client *Client) performRequest(ctx context.Context, method string, path string, contentType string, body []byte, ignoreErrors []int) (int, []byte, error) {
+	if client.gzip && len(body) > 0 {
+		var compressed bytes.Buffer
+		writer := gzip.NewWriter(&compressed)
+		_, _ = writer.Write(body)
+		_ = writer.Close()
+		body = compressed.Bytes()
+	}
+
+	wait := client.initialBackoff
+	for retry := 0; ; retry++ {
+		statusCode, responseBody, err := client.send(ctx, method, elasticsearch.Balance(client.urls)+path, contentType, body)
+
+		retryable := err != nil || statusCode == http.StatusTooManyRequests || statusCode == http.StatusBadGateway || statusCode == http.StatusServiceUnavailable || statusCode == http.StatusGatewayTimeout
+		if retryable && retry < client.maxRetries {
+			select {
+			case <-ctx.Done():
+				return 0, nil, ctx.Err()
+			case <-time.After(wait):
+			}
+
+			wait *= 2
+			if wait > client.maxBackoff {
+				wait = client.maxBackoff
+			}
+			continue
+		}
+
+		if err != nil {
+			return 0, nil, err
+		}
+
+		if statusCode >= 200 && statusCode < 300 {
+			return statusCode, responseBody, nil
+		}
+
+		for _, ignoreError := range ignoreErrors {
+			if statusCode == ignoreError {
+				return statusCode, responseBody, nil
+			}
+		}
+
+		return statusCode, responseBody, errors.New("opensearch: error " + strconv.Itoa(statusCode) + " (" + http.StatusText(statusCode) + "): " + string(responseBody))
+	}
+}
+
+//send sends a single request
+func (client *Client) send(ctx context.Context, method string, requestURL string, contentType string, body []byte) (int, []byte, error) {
+	request, err := http.NewRequestWithContext(ctx, method, requestURL, bytes.NewReader(body))
+
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if len(body) > 0 {
+		request.Header.Set("Content-Type", contentType)
+		if client.gzip {
+			request.Header.Set("Content-Encoding", "gzip")
+		}
+	}
+
+	if client.authorization != "" {
+		request.Header.Set("Authorization", client.authorization)
+	}
+
+	response, err := client.httpClient.Do(request)
+
+	if err != nil {
+		return 0, nil, err
+	}
+
+	defer response.Body.Close()
+
+	responseBody, err := ioutil.ReadAll(response.Body)
+
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return response.StatusCode, responseBody, nil
+}
@@ -0,0 +1,150 @@
+package opensearch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/BenB196/crashplan-ffs-puller/config"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+//ismTemplatePriority is the priority of the policy's ism_template, which attaches it to new indices
+const ismTemplatePriority = 100
+
+/*
+BuildISMPolicy - builds the ism policy of an ffs query from its hot, warm, and delete phases
+Each phase is an ism state, and moves to the next state once the index is older than the next phase's minAge
+Returns
+map[string]interface{} - the policy body
+*/
+func BuildISMPolicy(elasticConfig config.Elasticsearch) map[string]interface{} {
+	ism := elasticConfig.ISM
+
+	rollover := map[string]interface{}{}
+	if ism.Hot.RolloverMaxSize != "" {
+		rollover["min_size"] = ism.Hot.RolloverMaxSize
+	}
+	if ism.Hot.RolloverMaxAge != "" {
+		rollover["min_index_age"] = ism.Hot.RolloverMaxAge
+	}
+
+	hot := map[string]interface{}{
+		"name":        "hot",
+		"actions":     []interface{}{map[string]interface{}{"rollover": rollover}},
+		"transitions": []interface{}{},
+	}
+	states := []map[string]interface{}{hot}
+
+	if ism.Warm.MinAge != "" {
+		var actions []interface{}
+		if ism.Warm.NumberOfReplicas != nil {
+			actions = append(actions, map[string]interface{}{
+				"replica_count": map[string]interface{}{
+					"number_of_replicas": *ism.Warm.NumberOfReplicas,
+				},
+			})
+		}
+		if ism.Warm.ShrinkShards > 0 {
+			actions = append(actions, map[string]interface{}{
+				"shrink": map[string]interface{}{
+					"num_new_shards": ism.Warm.ShrinkShards,
+				},
+			})
+		}
+		if ism.Warm.ForceMergeSegments > 0 {
+			actions = append(actions, map[string]interface{}{
+				"force_merge": map[string]interface{}{
+					"max_num_segments": ism.Warm.ForceMergeSegments,
+				},
+			})
+		}
+		if actions == nil {
+			actions = []interface{}{}
+		}
+
+		states = append(states, map[string]interface{}{
+			"name":        "warm",
+			"actions":     actions,
+			"transitions": []interface{}{},
+			"min_age":     ism.Warm.MinAge,
+		})
+	}
+
+	if ism.Delete.MinAge != "" {
+		states = append(states, map[string]interface{}{
+			"name":        "delete",
+			"actions":     []interface{}{map[string]interface{}{"delete": map[string]interface{}{}}},
+			"transitions": []interface{}{},
+			"min_age":     ism.Delete.MinAge,
+		})
+	}
+
+	//each state moves to the next one, the min_age of a state is only used to build the transition into it
+	for i := 0; i < len(states)-1; i++ {
+		states[i]["transitions"] = []interface{}{
+			map[string]interface{}{
+				"state_name": states[i+1]["name"],
+				"conditions": map[string]interface{}{
+					"min_index_age": states[i+1]["min_age"],
+				},
+			},
+		}
+	}
+	for _, state := range states {
+		delete(state, "min_age")
+	}
+
+	return map[string]interface{}{
+		"policy": map[string]interface{}{
+			"description":   "crashplan-ffs-puller policy for " + elasticConfig.IndexName,
+			"default_state": "hot",
+			"states":        states,
+			"ism_template": []interface{}{
+				map[string]interface{}{
+					"index_patterns": []string{elasticConfig.IndexName + "-*"},
+					"priority":       ismTemplatePriority,
+				},
+			},
+		},
+	}
+}
+
+/*
+InstallISMPolicy - creates or updates the ism policy of an ffs query
+Returns
+error - any errors which have been caught
+*/
+func InstallISMPolicy(client *Client, ctx context.Context, elasticConfig config.Elasticsearch) error {
+	path := "/_plugins/_ism/policies/" + url.PathEscape(elasticConfig.ISM.PolicyName)
+
+	statusCode, responseBody, err := client.PerformRequest(ctx, http.MethodGet, path, nil, http.StatusNotFound)
+
+	if err != nil {
+		return errors.New("error getting opensearch ism policy: " + elasticConfig.ISM.PolicyName + ", " + err.Error())
+	}
+
+	//existing policies can only be updated with the sequence number and primary term they were read with
+	if statusCode != http.StatusNotFound {
+		var installed struct {
+			SeqNo       int64 `json:"_seq_no"`
+			PrimaryTerm int64 `json:"_primary_term"`
+		}
+		err = json.Unmarshal(responseBody, &installed)
+
+		if err != nil {
+			return errors.New("error getting opensearch ism policy: " + elasticConfig.ISM.PolicyName + ", " + err.Error())
+		}
+
+		path += "?if_seq_no=" + strconv.FormatInt(installed.SeqNo, 10) + "&if_primary_term=" + strconv.FormatInt(installed.PrimaryTerm, 10)
+	}
+
+	_, _, err = client.PerformRequest(ctx, http.MethodPut, path, BuildISMPolicy(elasticConfig))
+
+	if err != nil {
+		return errors.New("error installing opensearch ism policy: " + elasticConfig.ISM.PolicyName + ", " + err.Error())
+	}
+
+	return nil
+}
@@ -0,0 +1,49 @@
+package opensearch
+
+import (
+	"context"
+	"github.com/BenB196/crashplan-ffs-puller/config"
+	"github.com/BenB196/crashplan-ffs-puller/elasticsearch"
+)
+
+//Output sends the events of an ffs query to opensearch through the query's shared bulk indexer
+type Output struct {
+	client        *Client
+	ctx           context.Context
+	queryName     string
+	elasticConfig config.Elasticsearch
+	indexer       *BulkIndexer
+}
+
+/*
+NewOutput - builds the opensearch output of an ffs query, starting its bulk indexer on first use
+*/
+func NewOutput(client *Client, ctx context.Context, queryName string, elasticConfig config.Elasticsearch) *Output {
+	return &Output{
+		client:        client,
+		ctx:           ctx,
+		queryName:     queryName,
+		elasticConfig: elasticConfig,
+		indexer:       GetBulkIndexer(client, queryName, elasticConfig),
+	}
+}
+
+//EnsureIndex makes sure an index exists through the query's index cache, which is shared with the elastic output
+func (output *Output) EnsureIndex(indexName string) error {
+	return elasticsearch.GetIndexCache(output.queryName, output.elasticConfig).EnsureIndex(output.client, output.ctx, indexName)
+}
+
+//Add queues an event in the bulk indexer, which sends it once a bulk limit is reached or the output is flushed
+func (output *Output) Add(indexName string, doc interface{}) error {
+	return output.indexer.Add(output.ctx, indexName, doc)
+}
+
+//Flush sends every queued event
+func (output *Output) Flush() error {
+	return output.indexer.Flush(output.ctx)
+}
+
+//ExportStats sets the bulk metrics of the query
+func (output *Output) ExportStats() {
+	output.indexer.ExportStats()
+}
@@ -14,6 +14,53 @@ var (
 		Name: "crashplan_ffs_puller_in_progress_queries",
 		Help: "The current number of in progress queries",
 	})
+	uncoveredSeconds = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "crashplan_ffs_puller_uncovered_seconds",
+		Help: "The number of seconds between the start of a query and its last completed query which have not been fetched",
+	},
+		[]string{"query"},
+	)
+	queuedWindows = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "crashplan_ffs_puller_queued_windows",
+		Help: "The current number of query windows waiting on the scheduler for a fetch slot",
+	},
+		[]string{"query"},
+	)
+	rateLimitWait = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "crashplan_ffs_puller_rate_limit_wait_seconds",
+		Help:    "The time requests to the FFS API spent waiting on the rate limiter",
+		Buckets: []float64{0.01, 0.1, 0.5, 1, 5, 15, 30, 60, 120},
+	})
+	indicesCreated = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "crashplan_ffs_puller_elastic_indices_created_total",
+		Help: "The total number of elasticsearch indices created by the puller",
+	},
+		[]string{"query"},
+	)
+	bulkQueued = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "crashplan_ffs_puller_bulk_queued_documents",
+		Help: "The current number of documents queued in the elasticsearch bulk processor",
+	},
+		[]string{"query"},
+	)
+	bulkCommitted = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "crashplan_ffs_puller_bulk_committed_requests",
+		Help: "The number of bulk requests committed by the elasticsearch bulk processor since the puller started",
+	},
+		[]string{"query"},
+	)
+	bulkFailed = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "crashplan_ffs_puller_bulk_failed_documents",
+		Help: "The number of documents which failed in the elasticsearch bulk processor since the puller started",
+	},
+		[]string{"query"},
+	)
+	bulkIndexed = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "crashplan_ffs_puller_bulk_indexed_documents",
+		Help: "The number of documents indexed by the elasticsearch bulk processor since the puller started",
+	},
+		[]string{"query"},
+	)
 	requestsProcessed = promauto.NewCounter(prometheus.CounterOpts{
 		Name: "ip_api_proxy_requests_total",
 		Help: "The total number of requests processed",
@@ -114,6 +161,29 @@ func DecreaseInProgressQueries() {
 	inProgressQueries.Dec()
 }
 
+func SetUncoveredSeconds(queryName string, seconds float64) {
+	uncoveredSeconds.With(prometheus.Labels{"query": queryName}).Set(seconds)
+}
+
+func SetQueuedWindows(queryName string, queued int) {
+	queuedWindows.With(prometheus.Labels{"query": queryName}).Set(float64(queued))
+}
+
+func ObserveRateLimitWait(seconds float64) {
+	rateLimitWait.Observe(seconds)
+}
+
+func IncrementIndicesCreated(queryName string) {
+	indicesCreated.With(prometheus.Labels{"query": queryName}).Inc()
+}
+
+func SetBulkStats(queryName string, queued int64, committed int64, failed int64, indexed int64) {
+	bulkQueued.With(prometheus.Labels{"query": queryName}).Set(float64(queued))
+	bulkCommitted.With(prometheus.Labels{"query": queryName}).Set(float64(committed))
+	bulkFailed.With(prometheus.Labels{"query": queryName}).Set(float64(failed))
+	bulkIndexed.With(prometheus.Labels{"query": queryName}).Set(float64(indexed))
+}
+
 func IncrementRequestsProcessed() {
 	requestsProcessed.Inc()
 }
@@ -0,0 +1,203 @@
+package utils
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//CronSchedule is a parsed standard 5 field cron expression (minute hour day-of-month month day-of-week)
+type CronSchedule struct {
+	minutes     map[int]bool
+	hours       map[int]bool
+	daysOfMonth map[int]bool
+	months      map[int]bool
+	daysOfWeek  map[int]bool
+	//Standard cron matches either the day of month or the day of week if both are restricted
+	anyDayOfMonth bool
+	anyDayOfWeek  bool
+}
+
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var cronMonthNames = map[string]int{"JAN": 1, "FEB": 2, "MAR": 3, "APR": 4, "MAY": 5, "JUN": 6, "JUL": 7, "AUG": 8, "SEP": 9, "OCT": 10, "NOV": 11, "DEC": 12}
+
+var cronDayNames = map[string]int{"SUN": 0, "MON": 1, "TUE": 2, "WED": 3, "THU": 4, "FRI": 5, "SAT": 6}
+
+//ParseCron - parses a standard 5 field cron expression, or one of the @yearly, @monthly, @weekly, @daily, @midnight, @hourly descriptors
+//Each field supports *, single values, ranges (1-5), steps (*/15, 9-17/2), lists (1,15), and month/day names (JAN, MON)
+func ParseCron(expression string) (*CronSchedule, error) {
+	expression = strings.TrimSpace(expression)
+	if descriptor, found := cronDescriptors[strings.ToLower(expression)]; found {
+		expression = descriptor
+	}
+
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return nil, errors.New("error: cron expression: " + expression + ", must have 5 fields (minute hour day-of-month month day-of-week)")
+	}
+
+	var schedule CronSchedule
+	var err error
+
+	if schedule.minutes, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, errors.New("error: bad minute field in cron expression: " + expression + ", " + err.Error())
+	}
+	if schedule.hours, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return nil, errors.New("error: bad hour field in cron expression: " + expression + ", " + err.Error())
+	}
+	if schedule.daysOfMonth, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return nil, errors.New("error: bad day of month field in cron expression: " + expression + ", " + err.Error())
+	}
+	if schedule.months, err = parseCronField(fields[3], 1, 12, cronMonthNames); err != nil {
+		return nil, errors.New("error: bad month field in cron expression: " + expression + ", " + err.Error())
+	}
+	//Allow 7 for Sunday as well as 0
+	if schedule.daysOfWeek, err = parseCronField(fields[4], 0, 7, cronDayNames); err != nil {
+		return nil, errors.New("error: bad day of week field in cron expression: " + expression + ", " + err.Error())
+	}
+	if schedule.daysOfWeek[7] {
+		schedule.daysOfWeek[0] = true
+	}
+
+	schedule.anyDayOfMonth = strings.HasPrefix(fields[2], "*")
+	schedule.anyDayOfWeek = strings.HasPrefix(fields[4], "*")
+
+	return &schedule, nil
+}
+
+func parseCronField(field string, min int, max int, names map[string]int) (map[int]bool, error) {
+	values := map[int]bool{}
+
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		hasStep := strings.Contains(part, "/")
+		if hasStep {
+			stepParts := strings.SplitN(part, "/", 2)
+			var err error
+			step, err = strconv.Atoi(stepParts[1])
+			if err != nil || step < 1 {
+				return nil, errors.New("invalid step: " + stepParts[1])
+			}
+			part = stepParts[0]
+		}
+
+		start, end := min, max
+		if part != "*" {
+			rangeParts := strings.SplitN(part, "-", 2)
+			var err error
+			start, err = parseCronValue(rangeParts[0], names)
+			if err != nil {
+				return nil, err
+			}
+			if len(rangeParts) == 2 {
+				end, err = parseCronValue(rangeParts[1], names)
+				if err != nil {
+					return nil, err
+				}
+			} else if hasStep {
+				//a single value with a step runs from the value to the max
+				end = max
+			} else {
+				end = start
+			}
+		}
+
+		if start < min || end > max || start > end {
+			return nil, errors.New("value out of range: " + part + ", must be between " + strconv.Itoa(min) + " and " + strconv.Itoa(max))
+		}
+
+		for value := start; value <= end; value += step {
+			values[value] = true
+		}
+	}
+
+	return values, nil
+}
+
+func parseCronValue(value string, names map[string]int) (int, error) {
+	if names != nil {
+		if number, found := names[strings.ToUpper(value)]; found {
+			return number, nil
+		}
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, errors.New("invalid value: " + value)
+	}
+
+	return number, nil
+}
+
+func (schedule *CronSchedule) matchesDay(t time.Time) bool {
+	dayOfMonth := schedule.daysOfMonth[t.Day()]
+	dayOfWeek := schedule.daysOfWeek[int(t.Weekday())]
+
+	if schedule.anyDayOfMonth && schedule.anyDayOfWeek {
+		return true
+	} else if schedule.anyDayOfMonth {
+		return dayOfWeek
+	} else if schedule.anyDayOfWeek {
+		return dayOfMonth
+	}
+
+	return dayOfMonth || dayOfWeek
+}
+
+/*
+Next - gets the next time after t that the schedule fires, in t's location
+The schedule is matched against the local clock, so around daylight saving changes:
+times which are skipped fire the same time after the change instead (ex: 02:30 fires at 03:30 when 02:00 jumps to 03:00)
+times which are repeated only fire the first time
+Returns the zero time if the schedule does not fire within the next 5 years (ex: 30th of February)
+*/
+func (schedule *CronSchedule) Next(t time.Time) time.Time {
+	//Walk the local clock in UTC, which has no daylight saving changes to skip or repeat times
+	clock := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC).Add(time.Minute)
+	limit := clock.AddDate(5, 0, 0)
+
+	for clock.Before(limit) {
+		if !schedule.months[int(clock.Month())] {
+			clock = time.Date(clock.Year(), clock.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !schedule.matchesDay(clock) {
+			clock = time.Date(clock.Year(), clock.Month(), clock.Day()+1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !schedule.hours[clock.Hour()] {
+			clock = clock.Truncate(time.Hour).Add(time.Hour)
+			continue
+		}
+		if !schedule.minutes[clock.Minute()] {
+			clock = clock.Add(time.Minute)
+			continue
+		}
+
+		next := time.Date(clock.Year(), clock.Month(), clock.Day(), clock.Hour(), clock.Minute(), 0, 0, t.Location())
+
+		//the clock time was skipped, move it forward by as much as the clock jumped
+		nextClock := time.Date(next.Year(), next.Month(), next.Day(), next.Hour(), next.Minute(), 0, 0, time.UTC)
+		next = next.Add(clock.Sub(nextClock))
+
+		//the clock time is repeated and its first time has already passed
+		if !next.After(t) {
+			clock = clock.Add(time.Minute)
+			continue
+		}
+
+		return next
+	}
+
+	return time.Time{}
+}
@@ -0,0 +1,226 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		expression string
+		wantErr    bool
+	}{
+		{expression: "* * * * *"},
+		{expression: "0 0 1 1 *"},
+		{expression: "*/15 9-17/2 1,15 JAN-MAR MON-FRI"},
+		{expression: "0 0 * * 7"},
+		{expression: "@daily"},
+		{expression: "@HOURLY"},
+		{expression: "* * * *", wantErr: true},
+		{expression: "* * * * * *", wantErr: true},
+		{expression: "60 * * * *", wantErr: true},
+		{expression: "* 24 * * *", wantErr: true},
+		{expression: "* * 0 * *", wantErr: true},
+		{expression: "* * * 13 *", wantErr: true},
+		{expression: "* * * * 8", wantErr: true},
+		{expression: "5-1 * * * *", wantErr: true},
+		{expression: "*/0 * * * *", wantErr: true},
+		{expression: "*/x * * * *", wantErr: true},
+		{expression: "a * * * *", wantErr: true},
+		{expression: "* * * FOO *", wantErr: true},
+		{expression: "@fortnightly", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expression, func(t *testing.T) {
+			_, err := ParseCron(test.expression)
+
+			if (err != nil) != test.wantErr {
+				t.Errorf("ParseCron(%q) error = %v, want error %v", test.expression, err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+
+	if err != nil {
+		t.Skip("no timezone data: " + err.Error())
+	}
+
+	utc := func(year int, month time.Month, day int, hour int, minute int) time.Time {
+		return time.Date(year, month, day, hour, minute, 0, 0, time.UTC)
+	}
+	ny := func(year int, month time.Month, day int, hour int, minute int) time.Time {
+		return time.Date(year, month, day, hour, minute, 0, 0, newYork)
+	}
+
+	tests := []struct {
+		name       string
+		expression string
+		from       time.Time
+		want       []time.Time
+	}{
+		{
+			name:       "every minute",
+			expression: "* * * * *",
+			from:       utc(2021, 1, 1, 10, 0).Add(30 * time.Second),
+			want:       []time.Time{utc(2021, 1, 1, 10, 1), utc(2021, 1, 1, 10, 2)},
+		},
+		{
+			name:       "single minute and hour",
+			expression: "30 2 * * *",
+			from:       utc(2021, 1, 1, 3, 0),
+			want:       []time.Time{utc(2021, 1, 2, 2, 30), utc(2021, 1, 3, 2, 30)},
+		},
+		{
+			name:       "never fires at the time it starts from",
+			expression: "0 0 * * *",
+			from:       utc(2021, 1, 1, 0, 0),
+			want:       []time.Time{utc(2021, 1, 2, 0, 0)},
+		},
+		{
+			name:       "minute step",
+			expression: "*/20 * * * *",
+			from:       utc(2021, 1, 1, 10, 5),
+			want:       []time.Time{utc(2021, 1, 1, 10, 20), utc(2021, 1, 1, 10, 40), utc(2021, 1, 1, 11, 0)},
+		},
+		{
+			name:       "range with a step",
+			expression: "0 9-17/4 * * *",
+			from:       utc(2021, 1, 1, 10, 0),
+			want:       []time.Time{utc(2021, 1, 1, 13, 0), utc(2021, 1, 1, 17, 0), utc(2021, 1, 2, 9, 0)},
+		},
+		{
+			name:       "single value with a step runs to the max",
+			expression: "50/5 * * * *",
+			from:       utc(2021, 1, 1, 10, 0),
+			want:       []time.Time{utc(2021, 1, 1, 10, 50), utc(2021, 1, 1, 10, 55), utc(2021, 1, 1, 11, 50)},
+		},
+		{
+			name:       "list",
+			expression: "0 0 1,15 * *",
+			from:       utc(2021, 1, 2, 0, 0),
+			want:       []time.Time{utc(2021, 1, 15, 0, 0), utc(2021, 2, 1, 0, 0)},
+		},
+		{
+			name:       "month names",
+			expression: "0 0 1 MAR,SEP *",
+			from:       utc(2021, 1, 1, 0, 0),
+			want:       []time.Time{utc(2021, 3, 1, 0, 0), utc(2021, 9, 1, 0, 0), utc(2022, 3, 1, 0, 0)},
+		},
+		{
+			name:       "day of week names",
+			expression: "0 8 * * MON-FRI",
+			//2021-01-01 is a Friday
+			from: utc(2021, 1, 1, 9, 0),
+			want: []time.Time{utc(2021, 1, 4, 8, 0), utc(2021, 1, 5, 8, 0)},
+		},
+		{
+			name:       "7 is Sunday",
+			expression: "0 0 * * 7",
+			from:       utc(2021, 1, 1, 0, 0),
+			want:       []time.Time{utc(2021, 1, 3, 0, 0), utc(2021, 1, 10, 0, 0)},
+		},
+		{
+			name:       "day of month and day of week both restricted fire on either",
+			expression: "0 0 13 * FRI",
+			//2021-08-13 is a Friday
+			from: utc(2021, 8, 1, 0, 0),
+			want: []time.Time{utc(2021, 8, 6, 0, 0), utc(2021, 8, 13, 0, 0), utc(2021, 8, 20, 0, 0), utc(2021, 8, 27, 0, 0), utc(2021, 9, 3, 0, 0), utc(2021, 9, 10, 0, 0), utc(2021, 9, 13, 0, 0)},
+		},
+		{
+			name:       "day of month only when day of week is any",
+			expression: "0 0 31 * *",
+			from:       utc(2021, 1, 31, 0, 0),
+			want:       []time.Time{utc(2021, 3, 31, 0, 0), utc(2021, 5, 31, 0, 0)},
+		},
+		{
+			name:       "yearly descriptor",
+			expression: "@yearly",
+			from:       utc(2021, 6, 1, 0, 0),
+			want:       []time.Time{utc(2022, 1, 1, 0, 0)},
+		},
+		{
+			name:       "29th of February",
+			expression: "0 0 29 2 *",
+			from:       utc(2021, 1, 1, 0, 0),
+			want:       []time.Time{utc(2024, 2, 29, 0, 0), utc(2028, 2, 29, 0, 0)},
+		},
+		{
+			name:       "never fires",
+			expression: "0 0 30 2 *",
+			from:       utc(2021, 1, 1, 0, 0),
+			want:       []time.Time{{}},
+		},
+		{
+			name:       "in the location of the time",
+			expression: "0 9 * * *",
+			from:       ny(2021, 1, 1, 10, 0),
+			want:       []time.Time{ny(2021, 1, 2, 9, 0), ny(2021, 1, 3, 9, 0)},
+		},
+		{
+			name:       "daylight saving starts, skipped time fires after the jump",
+			expression: "30 2 * * *",
+			from:       ny(2021, 3, 13, 12, 0),
+			//02:00 EST jumps to 03:00 EDT on 2021-03-14
+			want: []time.Time{ny(2021, 3, 14, 3, 30), ny(2021, 3, 15, 2, 30)},
+		},
+		{
+			name:       "daylight saving starts, hourly skips the missing hour",
+			expression: "0 * * * *",
+			from:       ny(2021, 3, 14, 0, 30),
+			want:       []time.Time{ny(2021, 3, 14, 1, 0), ny(2021, 3, 14, 3, 0), ny(2021, 3, 14, 4, 0)},
+		},
+		{
+			name:       "daylight saving ends, repeated time only fires once",
+			expression: "30 1 * * *",
+			from:       ny(2021, 11, 6, 12, 0),
+			//01:59 EDT falls back to 01:00 EST on 2021-11-07
+			want: []time.Time{ny(2021, 11, 7, 1, 30), ny(2021, 11, 8, 1, 30)},
+		},
+		{
+			name:       "daylight saving ends, hourly is an hour apart in wall time",
+			expression: "0 * * * *",
+			from:       ny(2021, 11, 7, 0, 30),
+			want:       []time.Time{ny(2021, 11, 7, 1, 0), ny(2021, 11, 7, 2, 0)},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			schedule, err := ParseCron(test.expression)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			next := test.from
+			for _, want := range test.want {
+				next = schedule.Next(next)
+
+				if !next.Equal(want) {
+					t.Fatalf("Next = %v, want %v", next, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCronNextFromRepeatedHour(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+
+	if err != nil {
+		t.Skip("no timezone data: " + err.Error())
+	}
+
+	schedule, _ := ParseCron("*/30 * * * *")
+
+	//01:10 EST, the second time 01:10 happens on 2021-11-07
+	from := time.Date(2021, 11, 7, 1, 10, 0, 0, newYork).Add(time.Hour)
+
+	if next := schedule.Next(from); !next.Equal(time.Date(2021, 11, 7, 2, 0, 0, 0, newYork)) || !next.After(from) {
+		t.Errorf("Next = %v, want 02:00 EST", next)
+	}
+}